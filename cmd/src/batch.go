@@ -18,10 +18,17 @@ The commands are:
 
 	apply                 applies a batch spec to create or update a batch
 	                      change
+	cache                 manages the execution cache
+	changesets            retries, detaches or publishes the changesets of a
+	                      batch change
+	close                 closes a batch change
+	list                  lists batch changes
 	new                   creates a new batch spec YAML file
+	plan                  shows what applying a batch spec would change
 	preview               creates a batch spec to be previewed or applied
 	repos,repositories    queries the exact repositories that a batch spec will
 	                      apply to
+	status                shows the changesets of a batch change
 	validate              validates a batch spec
 
 Use "src batch [command] -h" for more information about a command.
@@ -46,7 +53,8 @@ Use "src batch [command] -h" for more information about a command.
 			"campaign",
 			"campaigns",
 		},
-		handler:   handler,
-		usageFunc: func() { fmt.Println(usage) },
+		handler:     handler,
+		subcommands: &batchCommands,
+		usageFunc:   func() { fmt.Println(usage) },
 	})
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/sourcegraph/src-cli/internal/batches"
 	"github.com/sourcegraph/src-cli/internal/output"
@@ -25,10 +26,16 @@ Examples:
   
     $ src batch apply -f batch.spec.yaml -namespace myorg
 
+    $ src batch apply -f batch.spec.yaml -wait -wait-timeout 1h
+
 `
 
 	flagSet := flag.NewFlagSet("apply", flag.ExitOnError)
 	flags := newBatchApplyFlags(flagSet, batchDefaultCacheDir(), batchDefaultTempDirPrefix())
+	var (
+		waitFlag        = flagSet.Bool("wait", false, "Wait until all changesets have been published, or failed to be published, and exit with an error if any of them failed.")
+		waitTimeoutFlag = flagSet.Duration("wait-timeout", 30*time.Minute, "The maximum duration to wait for changesets to be published with -wait.")
+	)
 
 	doApply := func(ctx context.Context, out *output.Output, svc *batches.Service, flags *batchApplyFlags) error {
 		id, _, err := batchExecute(ctx, out, svc, flags)
@@ -45,12 +52,15 @@ Examples:
 
 		out.Write("")
 		block := out.Block(output.Line(batchSuccessEmoji, batchSuccessColor, "Batch change applied!"))
-		defer block.Close()
-
 		block.Write("To view the batch change, go to:")
 		block.Writef("%s%s", cfg.Endpoint, batch.URL)
+		block.Close()
 
-		return nil
+		if !*waitFlag {
+			return nil
+		}
+		out.Write("")
+		return batchWaitForChangesets(ctx, out, svc, batch, *waitTimeoutFlag)
 	}
 
 	handler := func(args []string) error {
@@ -67,10 +77,16 @@ Examples:
 		ctx, cancel := contextCancelOnInterrupt(context.Background())
 		defer cancel()
 
+		runtime, err := batches.NewRuntime(flags.runtime)
+		if err != nil {
+			return &usageError{err}
+		}
+
 		svc := batches.NewService(&batches.ServiceOpts{
 			AllowUnsupported: flags.allowUnsupported,
 			Client:           cfg.apiClient(flags.api, flagSet.Output()),
 			Workspace:        flags.workspace,
+			Runtime:          runtime,
 		})
 
 		if err := svc.DetermineFeatureFlags(ctx); err != nil {
@@ -87,8 +103,9 @@ Examples:
 	}
 
 	batchCommands = append(batchCommands, &command{
-		flagSet: flagSet,
-		handler: handler,
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"f": completeBatchSpecFiles},
 		usageFunc: func() {
 			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
 			flagSet.PrintDefaults()
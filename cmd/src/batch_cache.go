@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/sourcegraph/src-cli/internal/batches"
+)
+
+var batchCacheCommands commander
+
+func init() {
+	usage := `'src batch cache' manages the execution cache of 'src batch preview' and 'src batch apply'.
+
+The results of running the steps of a batch spec in a repository are cached, so
+that they don't have to be run again. The cache is never cleaned up by itself:
+use these commands to see what's in it and to remove entries that are no longer
+needed.
+
+Usage:
+
+	src batch cache command [command options]
+
+The commands are:
+
+	list      lists the entries in the cache
+	inspect   shows an entry and the result stored in it
+	prune     removes entries by age, size, batch spec or repository
+	clear     removes all entries, or those of a single repository
+
+Use "src batch cache [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("cache", flag.ExitOnError)
+	handler := func(args []string) error {
+		batchCacheCommands.run(flagSet, "src batch cache", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	batchCommands = append(batchCommands, &command{
+		flagSet:     flagSet,
+		handler:     handler,
+		subcommands: &batchCacheCommands,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
+
+// batchCacheEntry is how an entry of the execution cache is shown by the
+// 'src batch cache' commands. Entries written by older versions of src have
+// no metadata, so their repository, path and batch change are empty.
+type batchCacheEntry struct {
+	Key          string
+	Repository   string
+	RepositoryID string
+	Path         string
+	BatchChange  string
+	Size         int64
+	ModTime      time.Time
+	File         string
+}
+
+func newBatchCacheEntry(entry batches.ExecutionCacheEntry) batchCacheEntry {
+	e := batchCacheEntry{
+		Key:     entry.Key,
+		Size:    entry.Size,
+		ModTime: entry.ModTime,
+		File:    entry.File,
+	}
+	if m := entry.Metadata; m != nil {
+		e.Repository = m.Repository
+		e.RepositoryID = m.RepositoryID
+		e.Path = m.Path
+		e.BatchChange = m.BatchChange
+	}
+	return e
+}
+
+// batchCacheEntryFormat is the default -f template for cache entries.
+const batchCacheEntryFormat = "{{.Key}}\t{{or .Repository \"(unknown)\"}}\t{{or .Path \".\"}}\t{{or .BatchChange \"-\"}}\t{{humanizeBytes .Size}}\t{{humanizeTime .ModTime}}"
+
+// batchCacheFlag adds the -cache flag shared by the 'src batch cache'
+// commands to flagSet.
+func batchCacheFlag(flagSet *flag.FlagSet) *string {
+	return flagSet.String("cache", batchDefaultCacheDir(), "Directory for caching results and repository archives.")
+}
+
+// batchCacheEntries returns the entries of the execution cache in dir, oldest
+// first.
+func batchCacheEntries(dir string) (batches.ExecutionDiskCache, []batchCacheEntry, error) {
+	cache := batches.ExecutionDiskCache{Dir: dir}
+	entries, err := cache.Entries()
+	if err != nil {
+		return cache, nil, err
+	}
+
+	shown := make([]batchCacheEntry, len(entries))
+	for i, entry := range entries {
+		shown[i] = newBatchCacheEntry(entry)
+	}
+	return cache, shown, nil
+}
+
+// batchCacheRemove removes the given entries from the cache, unless dryRun is
+// set, and prints each of them with the template tmplText. Nothing is printed
+// if tmplText is empty and no output format is selected. It returns the total
+// size of the entries.
+func batchCacheRemove(cache batches.ExecutionDiskCache, entries []batchCacheEntry, dryRun bool, tmplText string) (int64, error) {
+	show := tmplText != "" || *outputFormatFlag != ""
+	tmpl, err := parseTemplate(tmplText)
+	if err != nil {
+		return 0, err
+	}
+	if show {
+		expectRecords()
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if !dryRun {
+			if err := cache.Remove(entry.Key); err != nil {
+				return total, err
+			}
+		}
+		total += entry.Size
+		if !show {
+			continue
+		}
+		if err := execTemplate(tmpl, entry); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	usage := `
+'src batch cache clear' removes all entries from the execution cache, or only
+those of a single repository.
+
+Unlike the -clear-cache flag of 'src batch preview' and 'src batch apply', which
+only ignores cached results, this deletes them.
+
+Usage:
+
+    src batch cache clear [command options]
+
+Examples:
+
+  Remove all entries:
+
+    $ src batch cache clear
+
+  Remove the entries of a repository:
+
+    $ src batch cache clear -repo github.com/sourcegraph/src-cli
+
+`
+
+	flagSet := flag.NewFlagSet("clear", flag.ExitOnError)
+	var (
+		cacheFlag  = batchCacheFlag(flagSet)
+		repoFlag   = flagSet.String("repo", "", "Only remove the entries of the repository with this name.")
+		formatFlag = flagSet.String("f", "", `Format for the removed entries, using the syntax of Go package text/template. (e.g. "{{.Key}}" or "{{.|json}}") Nothing is printed by default.`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if len(flagSet.Args()) != 0 {
+			return &usageError{errors.New("additional arguments not allowed")}
+		}
+
+		cache, entries, err := batchCacheEntries(*cacheFlag)
+		if err != nil {
+			return err
+		}
+
+		cleared := batchCacheFilter(entries, *repoFlag, "")
+		total, err := batchCacheRemove(cache, cleared, false, *formatFlag)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(flagSet.Output(), "Removed %d cache entries (%s).\n", len(cleared), humanize.Bytes(uint64(total)))
+		return nil
+	}
+
+	// Register the command.
+	batchCacheCommands = append(batchCacheCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch cache %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
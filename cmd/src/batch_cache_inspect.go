@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/sourcegraph/src-cli/internal/batches"
+)
+
+func init() {
+	usage := `
+'src batch cache inspect' shows an entry of the execution cache and the result
+stored in it: the diff, the changed files and the outputs of the steps.
+
+Usage:
+
+    src batch cache inspect [command options] KEY
+
+Examples:
+
+  Show an entry, with the keys as printed by 'src batch cache list':
+
+    $ src batch cache inspect 4Vd5aQ0iUtIHAwuy0Crnlw
+
+  Only show the diff:
+
+    $ src batch cache inspect -f '{{.Diff}}' 4Vd5aQ0iUtIHAwuy0Crnlw
+
+`
+
+	flagSet := flag.NewFlagSet("inspect", flag.ExitOnError)
+	var (
+		cacheFlag  = batchCacheFlag(flagSet)
+		formatFlag = flagSet.String("f", "{{.|json}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.Diff}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 1 {
+			return &usageError{errors.New("expected exactly one cache key")}
+		}
+
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+
+		cache := batches.ExecutionDiskCache{Dir: *cacheFlag}
+		details, err := cache.Inspect(flagSet.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		// Entries written by older versions of src still know their path.
+		entry := newBatchCacheEntry(details.ExecutionCacheEntry)
+		if entry.Path == "" {
+			entry.Path = details.Path
+		}
+
+		return execTemplate(tmpl, struct {
+			batchCacheEntry
+			Diff         string
+			ChangedFiles *batches.StepChanges
+			Outputs      map[string]interface{}
+			SkippedSteps []int
+			FailedSteps  []int
+		}{
+			batchCacheEntry: entry,
+			Diff:            details.Diff,
+			ChangedFiles:    details.ChangedFiles,
+			Outputs:         details.Outputs,
+			SkippedSteps:    details.SkippedSteps,
+			FailedSteps:     details.FailedSteps,
+		})
+	}
+
+	// Register the command.
+	batchCacheCommands = append(batchCacheCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch cache %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
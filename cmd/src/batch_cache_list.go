@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	usage := `
+'src batch cache list' lists the entries in the execution cache, oldest first,
+with their repository, workspace path, batch change, size and age.
+
+Entries written by older versions of src don't record their repository, path
+and batch change.
+
+Usage:
+
+    src batch cache list [command options]
+
+Examples:
+
+  List all entries:
+
+    $ src batch cache list
+
+  List the entries of a repository:
+
+    $ src batch cache list -repo github.com/sourcegraph/src-cli
+
+  List the keys and sizes of the entries of a batch spec:
+
+    $ src batch cache list -spec hello-world -f '{{.Key}} {{.Size}}'
+
+`
+
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	var (
+		cacheFlag  = batchCacheFlag(flagSet)
+		repoFlag   = flagSet.String("repo", "", "Only list the entries of the repository with this name.")
+		specFlag   = flagSet.String("spec", "", "Only list the entries of the batch spec with this name.")
+		formatFlag = flagSet.String("f", batchCacheEntryFormat, `Format for the output, using the syntax of Go package text/template. (e.g. "{{.Key}}: {{.Repository}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if len(flagSet.Args()) != 0 {
+			return &usageError{errors.New("additional arguments not allowed")}
+		}
+
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+		expectRecords()
+
+		_, entries, err := batchCacheEntries(*cacheFlag)
+		if err != nil {
+			return err
+		}
+		for _, entry := range batchCacheFilter(entries, *repoFlag, *specFlag) {
+			if err := execTemplate(tmpl, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	batchCacheCommands = append(batchCacheCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch cache %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	usage := `
+'src batch cache prune' removes entries from the execution cache.
+
+Entries can be selected by batch spec and repository with -spec and -repo. Of
+those, entries that are older than -older-than are removed, and then the oldest
+remaining ones until they take up no more than -max-size. If only -spec or
+-repo is given, all of their entries are removed.
+
+Usage:
+
+    src batch cache prune [command options]
+
+Examples:
+
+  Remove entries that are older than 30 days:
+
+    $ src batch cache prune -older-than 720h
+
+  Keep the cache below 2GB, removing the oldest entries first:
+
+    $ src batch cache prune -max-size 2GB
+
+  Remove the entries of a batch spec that has been closed:
+
+    $ src batch cache prune -spec hello-world
+
+  Show what would be removed, without removing anything:
+
+    $ src batch cache prune -older-than 168h -dry-run
+
+`
+
+	flagSet := flag.NewFlagSet("prune", flag.ExitOnError)
+	var (
+		cacheFlag     = batchCacheFlag(flagSet)
+		olderThanFlag = flagSet.Duration("older-than", 0, "Remove entries that are older than this, such as 168h.")
+		maxSizeFlag   = flagSet.String("max-size", "", "Remove the oldest entries until the remaining ones take up no more than this, such as 500MB or 2GB.")
+		repoFlag      = flagSet.String("repo", "", "Only remove entries of the repository with this name.")
+		specFlag      = flagSet.String("spec", "", "Only remove entries of the batch spec with this name.")
+		dryRunFlag    = flagSet.Bool("dry-run", false, "Print the entries that would be removed, without removing them.")
+		formatFlag    = flagSet.String("f", batchCacheEntryFormat, `Format for the removed entries, using the syntax of Go package text/template. (e.g. "{{.Key}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if len(flagSet.Args()) != 0 {
+			return &usageError{errors.New("additional arguments not allowed")}
+		}
+
+		opts := batchCachePruneOpts{
+			olderThan: *olderThanFlag,
+			repo:      *repoFlag,
+			spec:      *specFlag,
+		}
+		if *maxSizeFlag != "" {
+			size, err := humanize.ParseBytes(*maxSizeFlag)
+			if err != nil {
+				return &usageError{errors.Wrap(err, "invalid -max-size")}
+			}
+			opts.maxSize = int64(size)
+			opts.limitSize = true
+		}
+		if opts.olderThan < 0 {
+			return &usageError{errors.New("-older-than must not be negative")}
+		}
+		if opts.olderThan == 0 && !opts.limitSize && opts.repo == "" && opts.spec == "" {
+			return &usageError{errors.New("at least one of -older-than, -max-size, -repo and -spec must be given")}
+		}
+
+		cache, entries, err := batchCacheEntries(*cacheFlag)
+		if err != nil {
+			return err
+		}
+
+		pruned := batchCachePrune(entries, opts, time.Now())
+		total, err := batchCacheRemove(cache, pruned, *dryRunFlag, *formatFlag)
+		if err != nil {
+			return err
+		}
+
+		verb := "Removed"
+		if *dryRunFlag {
+			verb = "Would remove"
+		}
+		fmt.Fprintf(flagSet.Output(), "%s %d of %d cache entries (%s).\n", verb, len(pruned), len(entries), humanize.Bytes(uint64(total)))
+		return nil
+	}
+
+	// Register the command.
+	batchCacheCommands = append(batchCacheCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch cache %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+type batchCachePruneOpts struct {
+	olderThan time.Duration
+
+	// maxSize is only applied if limitSize is set, so that the cache can be
+	// pruned to a size of 0.
+	maxSize   int64
+	limitSize bool
+
+	repo string
+	spec string
+}
+
+// batchCachePrune returns the entries that should be removed according to
+// opts. The entries must be sorted oldest first.
+func batchCachePrune(entries []batchCacheEntry, opts batchCachePruneOpts, now time.Time) []batchCacheEntry {
+	// Without an age or size limit, all entries of the repository or batch
+	// spec are removed.
+	removeAll := opts.olderThan == 0 && !opts.limitSize
+
+	var pruned, kept []batchCacheEntry
+	var keptSize int64
+	for _, entry := range batchCacheFilter(entries, opts.repo, opts.spec) {
+		expired := opts.olderThan > 0 && now.Sub(entry.ModTime) > opts.olderThan
+		if removeAll || expired {
+			pruned = append(pruned, entry)
+			continue
+		}
+		kept = append(kept, entry)
+		keptSize += entry.Size
+	}
+
+	if opts.limitSize {
+		for len(kept) > 0 && keptSize > opts.maxSize {
+			pruned = append(pruned, kept[0])
+			keptSize -= kept[0].Size
+			kept = kept[1:]
+		}
+	}
+	return pruned
+}
+
+// batchCacheFilter returns the entries of the given repository and batch
+// spec. Empty names match all entries.
+func batchCacheFilter(entries []batchCacheEntry, repo, spec string) []batchCacheEntry {
+	var filtered []batchCacheEntry
+	for _, entry := range entries {
+		if (repo == "" || entry.Repository == repo) && (spec == "" || entry.BatchChange == spec) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
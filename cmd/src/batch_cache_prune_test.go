@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBatchCachePrune(t *testing.T) {
+	now := time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	// Oldest first, as returned by batchCacheEntries.
+	entries := []batchCacheEntry{
+		{Key: "a", Repository: "repo1", BatchChange: "spec1", Size: 100, ModTime: now.Add(-10 * day)},
+		{Key: "b", Repository: "repo2", BatchChange: "spec1", Size: 200, ModTime: now.Add(-5 * day)},
+		{Key: "c", Repository: "repo1", BatchChange: "spec2", Size: 300, ModTime: now.Add(-2 * day)},
+		{Key: "d", Size: 400, ModTime: now.Add(-1 * day)},
+	}
+
+	for name, tc := range map[string]struct {
+		opts batchCachePruneOpts
+		want []string
+	}{
+		"older than":               {opts: batchCachePruneOpts{olderThan: 3 * day}, want: []string{"a", "b"}},
+		"max size":                 {opts: batchCachePruneOpts{maxSize: 700, limitSize: true}, want: []string{"a", "b"}},
+		"max size zero":            {opts: batchCachePruneOpts{limitSize: true}, want: []string{"a", "b", "c", "d"}},
+		"max size not reached":     {opts: batchCachePruneOpts{maxSize: 1000, limitSize: true}, want: nil},
+		"older than and max size":  {opts: batchCachePruneOpts{olderThan: 7 * day, maxSize: 500, limitSize: true}, want: []string{"a", "b", "c"}},
+		"spec":                     {opts: batchCachePruneOpts{spec: "spec1"}, want: []string{"a", "b"}},
+		"repo":                     {opts: batchCachePruneOpts{repo: "repo1"}, want: []string{"a", "c"}},
+		"repo and spec":            {opts: batchCachePruneOpts{repo: "repo1", spec: "spec1"}, want: []string{"a"}},
+		"repo and older than":      {opts: batchCachePruneOpts{repo: "repo1", olderThan: 3 * day}, want: []string{"a"}},
+		"spec and max size":        {opts: batchCachePruneOpts{spec: "spec1", maxSize: 250, limitSize: true}, want: []string{"a"}},
+		"nothing older than limit": {opts: batchCachePruneOpts{olderThan: 30 * day}, want: nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var have []string
+			for _, entry := range batchCachePrune(entries, tc.opts, now) {
+				have = append(have, entry.Key)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("wrong entries pruned (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+var batchChangesetsCommands commander
+
+func init() {
+	usage := `'src batch changesets' acts on the changesets of a batch change.
+
+Usage:
+
+	src batch changesets command [command options] NAME
+
+The commands are:
+
+	retry     retries publishing changesets that failed
+	detach    detaches archived changesets from the batch change
+	publish   publishes unpublished changesets
+
+Use "src batch changesets [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("changesets", flag.ExitOnError)
+	handler := func(args []string) error {
+		batchChangesetsCommands.run(flagSet, "src batch changesets", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	batchCommands = append(batchCommands, &command{
+		flagSet:     flagSet,
+		handler:     handler,
+		subcommands: &batchChangesetsCommands,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
+
+// batchChangeset is how a changeset is shown by 'src batch status' and the
+// 'src batch changesets' commands. Changesets in repositories that the user
+// can't see only have an ID and a state.
+type batchChangeset struct {
+	ID          string
+	Repository  string
+	Title       string
+	State       string
+	ReviewState string
+	CheckState  string
+	ExternalID  string
+	URL         string
+	Error       string
+}
+
+func newBatchChangeset(c *graphql.Changeset) batchChangeset {
+	shown := batchChangeset{
+		ID:          c.ID,
+		Title:       c.Title,
+		State:       c.State,
+		ReviewState: c.ReviewState,
+		CheckState:  c.CheckState,
+		ExternalID:  c.ExternalID,
+	}
+	if c.Repository != nil {
+		shown.Repository = c.Repository.Name
+	}
+	if c.ExternalURL != nil {
+		shown.URL = c.ExternalURL.URL
+	}
+	if c.Error != nil {
+		shown.Error = *c.Error
+	}
+	return shown
+}
+
+// batchChangesetFormat is the default -f template for changesets.
+const batchChangesetFormat = "{{or .Repository \"(hidden)\"}}\t{{.State}}\t{{or .CheckState \"-\"}}\t{{or .ReviewState \"-\"}}\t{{or .URL .Error}}"
+
+// batchManageFlags are the flags shared by the commands that manage an
+// existing batch change.
+type batchManageFlags struct {
+	api       *api.Flags
+	namespace string
+}
+
+func newBatchManageFlags(flagSet *flag.FlagSet) *batchManageFlags {
+	f := &batchManageFlags{api: api.NewFlags(flagSet)}
+	flagSet.StringVar(
+		&f.namespace, "namespace", "",
+		"The user or organization namespace of the batch change. Default is the currently authenticated user.",
+	)
+	flagSet.StringVar(&f.namespace, "n", "", "Alias for -namespace.")
+	return f
+}
+
+// batchManageService returns the service used by the commands that manage
+// existing batch changes.
+func batchManageService(ctx context.Context, flagSet *flag.FlagSet, flags *batchManageFlags) (*batches.Service, error) {
+	svc := batches.NewService(&batches.ServiceOpts{
+		Client: cfg.apiClient(flags.api, flagSet.Output()),
+	})
+	if err := svc.DetermineFeatureFlags(ctx); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// batchLookupChange returns the service and the batch change named by the
+// single argument of flagSet in the namespace given by flags.
+func batchLookupChange(ctx context.Context, flagSet *flag.FlagSet, flags *batchManageFlags) (*batches.Service, *graphql.BatchChange, error) {
+	if flagSet.NArg() != 1 {
+		return nil, nil, &usageError{errors.New("expected the name of a batch change")}
+	}
+
+	svc, err := batchManageService(ctx, flagSet, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+	namespace, err := svc.ResolveNamespace(ctx, flags.namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	batchChange, err := svc.BatchChangeByName(ctx, namespace, flagSet.Arg(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	return svc, batchChange, nil
+}
+
+// batchChangesetsRepoFlag adds the -repo flag that selects the changesets
+// acted on by the 'src batch changesets' commands to flagSet.
+func batchChangesetsRepoFlag(flagSet *flag.FlagSet) *string {
+	return flagSet.String("repo", "", "Only act on the changesets in these repositories, separated by commas. Default is all changesets.")
+}
+
+// batchSelectChangesets returns the changesets of the batch change that match
+// opts and are in one of the comma separated repos, or all of them if repos
+// is empty.
+func batchSelectChangesets(ctx context.Context, svc *batches.Service, batchChange *graphql.BatchChange, opts graphql.ListChangesetsOpts, repos string) ([]*graphql.Changeset, error) {
+	var selected []*graphql.Changeset
+	err := svc.ListChangesets(ctx, batchChange.ID, opts, func(c *graphql.Changeset) error {
+		selected = append(selected, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batchFilterChangesets(selected, repos), nil
+}
+
+func batchFilterChangesets(changesets []*graphql.Changeset, repos string) []*graphql.Changeset {
+	if repos == "" {
+		return changesets
+	}
+
+	names := map[string]bool{}
+	for _, name := range strings.Split(repos, ",") {
+		names[strings.TrimSpace(name)] = true
+	}
+
+	var filtered []*graphql.Changeset
+	for _, c := range changesets {
+		if c.Repository != nil && names[c.Repository.Name] {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// batchChangesetIDs returns the IDs of the given changesets.
+func batchChangesetIDs(changesets []*graphql.Changeset) []string {
+	ids := make([]string, len(changesets))
+	for i, c := range changesets {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// batchPrintChangesets prints the given changesets with the template
+// tmplText.
+func batchPrintChangesets(changesets []*graphql.Changeset, tmplText string) error {
+	tmpl, err := parseTemplate(tmplText)
+	if err != nil {
+		return err
+	}
+	expectRecords()
+	for _, c := range changesets {
+		if err := execTemplate(tmpl, newBatchChangeset(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func init() {
+	usage := `
+'src batch changesets detach' detaches the archived changesets of a batch
+change, which are the changesets that aren't part of its current batch spec
+anymore. Detached changesets are left alone on the code host.
+
+Usage:
+
+    src batch changesets detach [command options] NAME
+
+Examples:
+
+  Detach all archived changesets of the batch change hello-world:
+
+    $ src batch changesets detach hello-world
+
+  Detach the archived changeset in a single repository:
+
+    $ src batch changesets detach -repo github.com/sourcegraph/src-cli hello-world
+
+`
+
+	flagSet := flag.NewFlagSet("detach", flag.ExitOnError)
+	var (
+		flags      = newBatchManageFlags(flagSet)
+		repoFlag   = batchChangesetsRepoFlag(flagSet)
+		formatFlag = flagSet.String("f", batchChangesetFormat, `Format for the detached changesets, using the syntax of Go package text/template. (e.g. "{{.Repository}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		svc, batchChange, err := batchLookupChange(ctx, flagSet, flags)
+		if err != nil {
+			return err
+		}
+		archived, err := batchSelectChangesets(ctx, svc, batchChange, graphql.ListChangesetsOpts{OnlyArchived: true}, *repoFlag)
+		if err != nil {
+			return err
+		}
+
+		if len(archived) > 0 {
+			if err := svc.DetachChangesets(ctx, batchChange.ID, batchChangesetIDs(archived)); err != nil {
+				return err
+			}
+		}
+		if err := batchPrintChangesets(archived, *formatFlag); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(flagSet.Output(), "Detaching %d changesets from batch change %s.\n", len(archived), batchChange.Name)
+		return nil
+	}
+
+	// Register the command.
+	batchChangesetsCommands = append(batchChangesetsCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch changesets %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
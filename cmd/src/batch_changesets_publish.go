@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func init() {
+	usage := `
+'src batch changesets publish' publishes the unpublished changesets of a batch
+change, as if they were published from the UI. The changesets are published on
+the code host by the Sourcegraph instance in the background.
+
+Usage:
+
+    src batch changesets publish [command options] NAME
+
+Examples:
+
+  Publish all unpublished changesets of the batch change hello-world:
+
+    $ src batch changesets publish hello-world
+
+  Publish the changesets in two repositories as drafts:
+
+    $ src batch changesets publish -draft -repo github.com/sourcegraph/src-cli,github.com/sourcegraph/sourcegraph hello-world
+
+`
+
+	flagSet := flag.NewFlagSet("publish", flag.ExitOnError)
+	var (
+		flags      = newBatchManageFlags(flagSet)
+		repoFlag   = batchChangesetsRepoFlag(flagSet)
+		draftFlag  = flagSet.Bool("draft", false, "Publish the changesets as drafts, if the code host supports them.")
+		formatFlag = flagSet.String("f", batchChangesetFormat, `Format for the published changesets, using the syntax of Go package text/template. (e.g. "{{.Repository}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		svc, batchChange, err := batchLookupChange(ctx, flagSet, flags)
+		if err != nil {
+			return err
+		}
+		unpublished, err := batchSelectChangesets(ctx, svc, batchChange, graphql.ListChangesetsOpts{State: "UNPUBLISHED"}, *repoFlag)
+		if err != nil {
+			return err
+		}
+
+		if len(unpublished) > 0 {
+			if err := svc.PublishChangesets(ctx, batchChange.ID, batchChangesetIDs(unpublished), *draftFlag); err != nil {
+				return err
+			}
+		}
+		if err := batchPrintChangesets(unpublished, *formatFlag); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(flagSet.Output(), "Publishing %d changesets of batch change %s.\n", len(unpublished), batchChange.Name)
+		return nil
+	}
+
+	// Register the command.
+	batchChangesetsCommands = append(batchChangesetsCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch changesets %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
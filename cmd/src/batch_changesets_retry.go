@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func init() {
+	usage := `
+'src batch changesets retry' retries publishing the changesets of a batch change
+that failed, such as after a code host outage or after fixing permissions.
+
+Usage:
+
+    src batch changesets retry [command options] NAME
+
+Examples:
+
+  Retry all failed changesets of the batch change hello-world:
+
+    $ src batch changesets retry hello-world
+
+  Retry the failed changeset in a single repository:
+
+    $ src batch changesets retry -repo github.com/sourcegraph/src-cli hello-world
+
+`
+
+	flagSet := flag.NewFlagSet("retry", flag.ExitOnError)
+	var (
+		flags      = newBatchManageFlags(flagSet)
+		repoFlag   = batchChangesetsRepoFlag(flagSet)
+		formatFlag = flagSet.String("f", batchChangesetFormat, `Format for the retried changesets, using the syntax of Go package text/template. (e.g. "{{.Repository}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		svc, batchChange, err := batchLookupChange(ctx, flagSet, flags)
+		if err != nil {
+			return err
+		}
+		failed, err := batchSelectChangesets(ctx, svc, batchChange, graphql.ListChangesetsOpts{State: "FAILED"}, *repoFlag)
+		if err != nil {
+			return err
+		}
+
+		// Changesets are retried one by one, so that the ones that have been
+		// re-enqueued are shown if one of them can't be.
+		retried := make([]*graphql.Changeset, 0, len(failed))
+		for _, c := range failed {
+			r, err := svc.ReenqueueChangeset(ctx, c.ID)
+			if err != nil {
+				batchPrintChangesets(retried, *formatFlag)
+				return err
+			}
+			retried = append(retried, r)
+		}
+		if err := batchPrintChangesets(retried, *formatFlag); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(flagSet.Output(), "Retrying %d changesets of batch change %s.\n", len(retried), batchChange.Name)
+		return nil
+	}
+
+	// Register the command.
+	batchChangesetsCommands = append(batchChangesetsCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch changesets %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func TestNewBatchChangeset(t *testing.T) {
+	errorMessage := "permission denied"
+	for name, tc := range map[string]struct {
+		changeset *graphql.Changeset
+		want      batchChangeset
+	}{
+		"visible": {
+			changeset: &graphql.Changeset{
+				ID:          "1",
+				Title:       "Hello World",
+				State:       "OPEN",
+				ReviewState: "APPROVED",
+				CheckState:  "PASSED",
+				ExternalID:  "42",
+				ExternalURL: &graphql.ExternalURL{URL: "https://github.com/sourcegraph/src-cli/pull/42"},
+				Repository:  &graphql.ChangesetRepository{ID: "R1", Name: "github.com/sourcegraph/src-cli"},
+			},
+			want: batchChangeset{
+				ID:          "1",
+				Repository:  "github.com/sourcegraph/src-cli",
+				Title:       "Hello World",
+				State:       "OPEN",
+				ReviewState: "APPROVED",
+				CheckState:  "PASSED",
+				ExternalID:  "42",
+				URL:         "https://github.com/sourcegraph/src-cli/pull/42",
+			},
+		},
+		"failed": {
+			changeset: &graphql.Changeset{
+				ID:         "2",
+				State:      "FAILED",
+				Repository: &graphql.ChangesetRepository{Name: "github.com/sourcegraph/sourcegraph"},
+				Error:      &errorMessage,
+			},
+			want: batchChangeset{
+				ID:         "2",
+				Repository: "github.com/sourcegraph/sourcegraph",
+				State:      "FAILED",
+				Error:      errorMessage,
+			},
+		},
+		"hidden": {
+			changeset: &graphql.Changeset{ID: "3", State: "OPEN"},
+			want:      batchChangeset{ID: "3", State: "OPEN"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, newBatchChangeset(tc.changeset)); diff != "" {
+				t.Errorf("wrong changeset (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBatchChangesetFormat(t *testing.T) {
+	tmpl, err := parseTemplate(batchChangesetFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		changeset batchChangeset
+		want      string
+	}{
+		"open": {
+			changeset: batchChangeset{Repository: "github.com/sourcegraph/src-cli", State: "OPEN", CheckState: "PASSED", ReviewState: "APPROVED", URL: "https://example.com/pull/1"},
+			want:      "github.com/sourcegraph/src-cli\tOPEN\tPASSED\tAPPROVED\thttps://example.com/pull/1",
+		},
+		"failed": {
+			changeset: batchChangeset{Repository: "github.com/sourcegraph/src-cli", State: "FAILED", Error: "permission denied"},
+			want:      "github.com/sourcegraph/src-cli\tFAILED\t-\t-\tpermission denied",
+		},
+		"hidden": {
+			changeset: batchChangeset{State: "OPEN"},
+			want:      "(hidden)\tOPEN\t-\t-\t",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, tc.changeset); err != nil {
+				t.Fatal(err)
+			}
+			if have := buf.String(); have != tc.want {
+				t.Errorf("wrong output:\nhave=%q\nwant=%q", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestBatchSelectChangesets(t *testing.T) {
+	var vars map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string
+			Variables map[string]interface{}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if strings.Contains(req.Query, "productVersion") {
+			fmt.Fprint(w, `{"data":{"site":{"productVersion":"3.30.0"}}}`)
+			return
+		}
+		vars = req.Variables
+		fmt.Fprint(w, `{"data":{"node":{"changesets":{
+			"nodes": [
+				{"id": "C1", "state": "FAILED", "repository": {"name": "github.com/sourcegraph/src-cli"}},
+				{"id": "C2", "state": "FAILED"},
+				{"id": "C3", "state": "FAILED", "repository": {"name": "github.com/sourcegraph/sourcegraph"}}
+			],
+			"pageInfo": {"hasNextPage": false}
+		}}}}`)
+	}))
+	defer ts.Close()
+
+	svc := batches.NewService(&batches.ServiceOpts{
+		Client: api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: &bytes.Buffer{}}),
+	})
+	if err := svc.DetermineFeatureFlags(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	batchChange := &graphql.BatchChange{ID: "BC1", Name: "hello"}
+	selected, err := batchSelectChangesets(context.Background(), svc, batchChange, graphql.ListChangesetsOpts{State: "FAILED"}, "github.com/sourcegraph/sourcegraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"C3"}, batchChangesetIDs(selected)); diff != "" {
+		t.Errorf("wrong changesets (-want +have):\n%s", diff)
+	}
+	if vars["batchChange"] != "BC1" || vars["state"] != "FAILED" || vars["onlyArchived"] != false {
+		t.Errorf("wrong variables: %v", vars)
+	}
+}
+
+func TestBatchFilterChangesets(t *testing.T) {
+	changesets := []*graphql.Changeset{
+		{ID: "1", Repository: &graphql.ChangesetRepository{Name: "github.com/sourcegraph/src-cli"}},
+		{ID: "2", Repository: &graphql.ChangesetRepository{Name: "github.com/sourcegraph/sourcegraph"}},
+		{ID: "3"},
+		{ID: "4", Repository: &graphql.ChangesetRepository{Name: "github.com/sourcegraph/go-diff"}},
+	}
+
+	for name, tc := range map[string]struct {
+		repos string
+		want  []string
+	}{
+		"all":           {repos: "", want: []string{"1", "2", "3", "4"}},
+		"one":           {repos: "github.com/sourcegraph/src-cli", want: []string{"1"}},
+		"several":       {repos: "github.com/sourcegraph/src-cli, github.com/sourcegraph/go-diff", want: []string{"1", "4"}},
+		"no match":      {repos: "github.com/sourcegraph/about", want: []string{}},
+		"partial names": {repos: "src-cli", want: []string{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			have := []string{}
+			for _, c := range batchFilterChangesets(changesets, tc.repos) {
+				have = append(have, c.ID)
+			}
+			if diff := cmp.Diff(tc.want, have); diff != "" {
+				t.Errorf("wrong changesets (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+func init() {
+	usage := `
+'src batch close' closes a batch change. Its changesets are left open on the
+code host unless -close-changesets is given.
+
+Usage:
+
+    src batch close [command options] NAME
+
+Examples:
+
+  Close the batch change hello-world:
+
+    $ src batch close hello-world
+
+  Close the batch change hello-world and all of its open changesets:
+
+    $ src batch close -close-changesets hello-world
+
+`
+
+	flagSet := flag.NewFlagSet("close", flag.ExitOnError)
+	var (
+		flags               = newBatchManageFlags(flagSet)
+		closeChangesetsFlag = flagSet.Bool("close-changesets", false, "Also close the open changesets of the batch change on the code host.")
+		formatFlag          = flagSet.String("f", batchChangeFormat, `Format for the closed batch change, using the syntax of Go package text/template. (e.g. "{{.URL}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+		expectRecords()
+
+		ctx := context.Background()
+		svc, batchChange, err := batchLookupChange(ctx, flagSet, flags)
+		if err != nil {
+			return err
+		}
+		closed, err := svc.CloseBatchChange(ctx, batchChange.ID, *closeChangesetsFlag)
+		if err != nil || closed == nil {
+			return err
+		}
+		return execTemplate(tmpl, closed)
+	}
+
+	// Register the command.
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
@@ -5,12 +5,16 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
@@ -36,13 +40,22 @@ type batchApplyFlags struct {
 	cacheDir         string
 	tempDir          string
 	clearCache       bool
+	export           string
+	remoteCache      string
+	remoteReadOnly   bool
 	file             string
 	keepLogs         bool
 	namespace        string
 	parallelism      int
+	resume           string
+	runtime          string
+	resources        batches.StepResources
+	network          string
 	timeout          time.Duration
 	workspace        string
 	cleanArchives    bool
+	fetch            string
+	gitURL           string
 	skipErrors       bool
 }
 
@@ -67,6 +80,18 @@ func newBatchApplyFlags(flagSet *flag.FlagSet, cacheDir, tempDir string) *batchA
 		&caf.clearCache, "clear-cache", false,
 		"If true, clears the execution cache and executes all steps anew.",
 	)
+	flagSet.StringVar(
+		&caf.export, "export", "",
+		"If set, writes a patch for each changeset and a report in Markdown and HTML of the execution results, including step outputs and log files, to the given directory.",
+	)
+	flagSet.StringVar(
+		&caf.remoteCache, "remote-cache", os.Getenv("SRC_BATCH_REMOTE_CACHE"),
+		"URL of a remote execution cache shared with other machines, in addition to the local cache. Results are stored as URL/KEY.v3.json with HTTP GET, PUT and DELETE requests, as supported by WebDAV servers and HTTP file servers. If the remote cache can't be used, results are only read from and written to the local cache. Can also be set with environment variable SRC_BATCH_REMOTE_CACHE. A bearer token can be set with SRC_BATCH_REMOTE_CACHE_TOKEN.",
+	)
+	flagSet.BoolVar(
+		&caf.remoteReadOnly, "remote-cache-read-only", false,
+		"If true, results are read from the remote execution cache, but not written to it.",
+	)
 	flagSet.StringVar(
 		&caf.tempDir, "tmp", tempDir,
 		"Directory for storing temporary data, such as log files. Default is /tmp. Can also be set with environment variable SRC_BATCH_TMP_DIR; if both are set, this flag will be used and not the environment variable.",
@@ -89,6 +114,10 @@ func newBatchApplyFlags(flagSet *flag.FlagSet, cacheDir, tempDir string) *batchA
 		&caf.parallelism, "j", runtime.GOMAXPROCS(0),
 		"The maximum number of parallel jobs. Default is GOMAXPROCS.",
 	)
+	flagSet.StringVar(
+		&caf.resume, "resume", "",
+		"Resume the interrupted run with the given ID, skipping the repositories, workspaces and changeset specs it already completed. If -f isn't given, the batch spec of the run is used.",
+	)
 	flagSet.DurationVar(
 		&caf.timeout, "timeout", 60*time.Minute,
 		"The maximum duration a single batch spec step can take.",
@@ -97,6 +126,14 @@ func newBatchApplyFlags(flagSet *flag.FlagSet, cacheDir, tempDir string) *batchA
 		&caf.cleanArchives, "clean-archives", true,
 		"If true, deletes downloaded repository archives after executing batch spec steps.",
 	)
+	flagSet.StringVar(
+		&caf.fetch, "fetch", "",
+		`How repositories are fetched ("archive" or "git"), overriding the "fetch" property of the batch spec. Git makes partial clones, which include the history of the repositories, but not the contents of files in other commits. Default is to download archives.`,
+	)
+	flagSet.StringVar(
+		&caf.gitURL, "git-url", os.Getenv("SRC_BATCH_GIT_URL"),
+		"Base URL to clone repositories from when fetching with git, such as http://127.0.0.1:3434/repos for 'src serve-git'. The repository name is appended to it. Default is the Sourcegraph instance. Can also be set with environment variable SRC_BATCH_GIT_URL.",
+	)
 	flagSet.BoolVar(
 		&caf.skipErrors, "skip-errors", false,
 		"If true, errors encountered while executing steps in a repository won't stop the execution of the batch spec but only cause that repository to be skipped.",
@@ -106,6 +143,26 @@ func newBatchApplyFlags(flagSet *flag.FlagSet, cacheDir, tempDir string) *batchA
 		&caf.workspace, "workspace", "auto",
 		`Workspace mode to use ("auto", "bind", or "volume")`,
 	)
+	flagSet.StringVar(
+		&caf.runtime, "runtime", "docker",
+		`Runtime to run steps with ("docker", "podman", or "native"). The native runtime runs steps directly on this machine, without containers, and must only be used with trusted batch specs.`,
+	)
+	flagSet.Float64Var(
+		&caf.resources.CPUs, "cpus", 0,
+		"The number of CPUs each step container can use, unless set in the batch spec. Default is no limit.",
+	)
+	flagSet.StringVar(
+		&caf.resources.Memory, "memory", "",
+		`The maximum amount of memory each step container can use, such as "512m" or "2g", unless set in the batch spec. Default is no limit.`,
+	)
+	flagSet.IntVar(
+		&caf.resources.PidsLimit, "pids-limit", 0,
+		"The maximum number of processes each step container can run, unless set in the batch spec. Default is no limit.",
+	)
+	flagSet.StringVar(
+		&caf.network, "network", "",
+		`The network step containers are attached to ("none", "bridge", or "host"), unless set in the batch spec. Default is the network of the runtime.`,
+	)
 
 	flagSet.BoolVar(verbose, "v", false, "print verbose output")
 
@@ -169,6 +226,44 @@ func batchDefaultTempDirPrefix() string {
 	return os.TempDir()
 }
 
+// batchExecutionCache returns the execution cache for the given flags: the
+// disk cache in the cache directory, layered with the remote cache if one is
+// configured. Errors of the remote cache are passed to warn instead of failing
+// the tasks.
+func batchExecutionCache(svc *batches.Service, flags *batchApplyFlags, warn func(error)) (batches.ExecutionCache, error) {
+	cache := svc.NewExecutionCache(flags.cacheDir)
+	if flags.remoteCache == "" {
+		return cache, nil
+	}
+
+	// The remote cache honors the same TLS and proxy settings as requests to
+	// the Sourcegraph instance.
+	transport, err := api.NewRoundTripper(cfg.clientOpts(flags.api, nil))
+	if err != nil {
+		return nil, err
+	}
+	remote, err := batches.NewExecutionRemoteCache(batches.ExecutionRemoteCacheOpts{
+		URL:      flags.remoteCache,
+		Client:   &http.Client{Transport: transport},
+		Token:    os.Getenv("SRC_BATCH_REMOTE_CACHE_TOKEN"),
+		ReadOnly: flags.remoteReadOnly,
+	})
+	if err != nil {
+		return nil, &usageError{err}
+	}
+
+	return batches.ExecutionLayeredCache{Local: cache, Remote: remote, Warn: warn}, nil
+}
+
+// batchRunsDir returns the directory in which the journals of batch spec runs
+// are stored, or "" if there's no cache directory to store them in.
+func batchRunsDir(cacheDir string) string {
+	if cacheDir == "" {
+		return ""
+	}
+	return filepath.Join(cacheDir, "runs")
+}
+
 func batchOpenFileFlag(flag *string) (io.ReadCloser, error) {
 	if flag == nil || *flag == "" || *flag == "-" {
 		return os.Stdin, nil
@@ -184,21 +279,68 @@ func batchOpenFileFlag(flag *string) (io.ReadCloser, error) {
 // batchExecute performs all the steps required to upload the campaign spec
 // to Sourcegraph, including execution as needed. The return values are the
 // spec ID, spec URL, and error.
-func batchExecute(ctx context.Context, out *output.Output, svc *batches.Service, flags *batchApplyFlags) (graphql.BatchSpecID, string, error) {
+//
+// The progress of the run is recorded in a journal in the cache directory, so
+// that an interrupted run can be continued with -resume.
+func batchExecute(ctx context.Context, out *output.Output, svc *batches.Service, flags *batchApplyFlags) (_ graphql.BatchSpecID, _ string, err error) {
 	if err := checkExecutable("git", "version"); err != nil {
 		return "", "", err
 	}
 
-	if err := checkExecutable("docker", "version"); err != nil {
+	stepRuntime := svc.Runtime()
+	if err := stepRuntime.Check(ctx); err != nil {
 		return "", "", err
 	}
+	if stepRuntime.ContainerBinary() == "" && flags.workspace == "volume" {
+		return "", "", errors.Errorf("the %s runtime can't be used with volume workspaces", stepRuntime.Name())
+	}
 
-	// Parse flags and build up our service and executor options.
+	if err := flags.resources.Validate(); err != nil {
+		return "", "", &usageError{err}
+	}
+	if err := batches.ValidateStepNetwork(flags.network); err != nil {
+		return "", "", &usageError{err}
+	}
+	if err := batches.ValidateFetchMethod(flags.fetch); err != nil {
+		return "", "", &usageError{err}
+	}
 
-	specFile, err := batchOpenFileFlag(&flags.file)
+	var (
+		remoteCacheErrsMu sync.Mutex
+		remoteCacheErrs   []error
+	)
+	cache, err := batchExecutionCache(svc, flags, func(err error) {
+		remoteCacheErrsMu.Lock()
+		defer remoteCacheErrsMu.Unlock()
+		remoteCacheErrs = append(remoteCacheErrs, err)
+	})
 	if err != nil {
 		return "", "", err
 	}
+
+	var journal *batches.RunJournal
+	if flags.resume != "" {
+		if flags.cacheDir == "" {
+			return "", "", errors.New("-resume requires a cache directory, but -cache is empty")
+		}
+		if journal, err = batches.OpenRunJournal(batchRunsDir(flags.cacheDir), flags.resume); err != nil {
+			return "", "", err
+		}
+	}
+	defer func() {
+		if err != nil && journal != nil {
+			out.WriteLine(output.Linef(output.EmojiLightbulb, output.StyleSuggestion, "To continue where this run stopped, rerun the command with -resume %s", journal.ID))
+		}
+	}()
+
+	// Parse flags and build up our service and executor options.
+
+	var specFile io.ReadCloser
+	if journal != nil && flags.file == "" {
+		specFile = ioutil.NopCloser(strings.NewReader(journal.Spec))
+	} else if specFile, err = batchOpenFileFlag(&flags.file); err != nil {
+		return "", "", err
+	}
 	defer specFile.Close()
 
 	pending := batchCreatePending(out, "Parsing batch spec")
@@ -206,78 +348,188 @@ func batchExecute(ctx context.Context, out *output.Output, svc *batches.Service,
 	if err != nil {
 		return "", "", err
 	}
+	if journal != nil && rawSpec != journal.Spec {
+		return "", "", errors.Errorf("the batch spec has changed since run %s was started; rerun the command without -resume to start a new run", journal.ID)
+	}
 	batchCompletePending(pending, "Parsing batch spec")
 
-	pending = batchCreatePending(out, "Resolving namespace")
-	namespace, err := svc.ResolveNamespace(ctx, flags.namespace)
-	if err != nil {
-		return "", "", err
-	}
-	batchCompletePending(pending, "Resolving namespace")
+	prepareImages := func() error {
+		if stepRuntime.ContainerBinary() == "" {
+			return nil
+		}
 
-	imageProgress := out.Progress([]output.ProgressBar{{
-		Label: "Preparing container images",
-		Max:   1.0,
-	}}, nil)
-	err = svc.SetDockerImages(ctx, batchSpec, func(perc float64) {
-		imageProgress.SetValue(0, perc)
-	})
-	if err != nil {
-		return "", "", err
+		imageProgress := out.Progress([]output.ProgressBar{{
+			Label: "Preparing container images",
+			Max:   1.0,
+		}}, nil)
+		err := svc.SetDockerImages(ctx, batchSpec, func(perc float64) {
+			imageProgress.SetValue(0, perc)
+		})
+		if err != nil {
+			return err
+		}
+		imageProgress.Complete()
+		return nil
 	}
-	imageProgress.Complete()
 
-	pending = batchCreatePending(out, "Resolving repositories")
-	repos, err := svc.ResolveRepositories(ctx, batchSpec)
-	if err != nil {
-		if repoSet, ok := err.(batches.UnsupportedRepoSet); ok {
-			batchCompletePending(pending, "Resolved repositories")
+	var (
+		namespace      string
+		repos          []*graphql.Repository
+		tasks          []*batches.Task
+		completedSpecs []*batches.ChangesetSpec
+	)
+	if journal != nil {
+		// Everything up to executing the tasks has already been done by the
+		// run we're resuming.
+		namespace, repos = journal.Namespace, journal.Repositories
+		tasks, completedSpecs, err = journal.RestoreTasks(batchSpec)
+		if err != nil {
+			return "", "", err
+		}
+		out.WriteLine(output.Linef(batchSuccessEmoji, batchSuccessColor, "Resuming run %s: %d of %d workspaces left to execute", journal.ID, len(tasks), len(journal.Tasks)))
 
-			block := out.Block(output.Line(" ", output.StyleWarning, "Some repositories are hosted on unsupported code hosts and will be skipped. Use the -allow-unsupported flag to avoid skipping them."))
-			for repo := range repoSet {
-				block.Write(repo.Name)
+		// Changeset specs created by the run may have been discarded by the
+		// server since, in which case they have to be created again.
+		if created := journal.CreatedChangesetSpecIDs(); len(created) > 0 {
+			missing, err := svc.MissingChangesetSpecs(ctx, created)
+			if err != nil {
+				return "", "", errors.Wrap(err, "checking changeset specs of resumed run")
+			}
+			if len(missing) > 0 {
+				out.Verbosef("%d changeset specs of run %s have expired and will be created again", len(missing), journal.ID)
+				journal.ForgetChangesetSpecIDs(missing)
+			}
+		}
+
+		if len(tasks) > 0 {
+			if err := prepareImages(); err != nil {
+				return "", "", err
 			}
-			block.Close()
-		} else {
-			return "", "", errors.Wrap(err, "resolving repositories")
 		}
 	} else {
-		batchCompletePending(pending, fmt.Sprintf("Resolved %d repositories", len(repos)))
+		pending = batchCreatePending(out, "Resolving namespace")
+		namespace, err = svc.ResolveNamespace(ctx, flags.namespace)
+		if err != nil {
+			return "", "", err
+		}
+		batchCompletePending(pending, "Resolving namespace")
+
+		if err := prepareImages(); err != nil {
+			return "", "", err
+		}
+
+		pending = batchCreatePending(out, "Resolving repositories")
+		repos, err = svc.ResolveRepositories(ctx, batchSpec)
+		if err != nil {
+			if repoSet, ok := err.(batches.UnsupportedRepoSet); ok {
+				batchCompletePending(pending, "Resolved repositories")
+
+				block := out.Block(output.Line(" ", output.StyleWarning, "Some repositories are hosted on unsupported code hosts and will be skipped. Use the -allow-unsupported flag to avoid skipping them."))
+				for repo := range repoSet {
+					block.Write(repo.Name)
+				}
+				block.Close()
+			} else {
+				return "", "", errors.Wrap(err, "resolving repositories")
+			}
+		} else {
+			batchCompletePending(pending, fmt.Sprintf("Resolved %d repositories", len(repos)))
+		}
+
+		pending = batchCreatePending(out, "Determining workspaces")
+		tasks, err = svc.BuildTasks(ctx, repos, batchSpec)
+		if err != nil {
+			return "", "", errors.Wrap(err, "Calculating execution plan")
+		}
+		batchCompletePending(pending, fmt.Sprintf("Found %d workspaces", len(tasks)))
+
+		if dir := batchRunsDir(flags.cacheDir); dir != "" {
+			j, err := batches.NewRunJournal(dir, rawSpec, namespace)
+			if err != nil {
+				return "", "", err
+			}
+			if err := j.Started(repos, tasks); err != nil {
+				return "", "", err
+			}
+			journal = j
+			out.WriteLine(output.Linef(batchSuccessEmoji, batchSuccessColor, "Recording progress as run %s", journal.ID))
+			out.Verbosef("Run journal: %s", journal.Path())
+		}
 	}
 
-	pending = batchCreatePending(out, "Determining workspaces")
-	tasks, err := svc.BuildTasks(ctx, repos, batchSpec)
-	if err != nil {
-		return "", "", errors.Wrap(err, "Calculating execution plan")
+	fetchMethod := flags.fetch
+	if fetchMethod == "" {
+		fetchMethod = batchSpec.Fetch
 	}
-	batchCompletePending(pending, fmt.Sprintf("Found %d workspaces", len(tasks)))
 
 	pending = batchCreatePending(out, "Preparing workspaces")
-	workspaceCreator := svc.NewWorkspaceCreator(ctx, flags.cacheDir, flags.tempDir, batchSpec.Steps)
+	var (
+		workspaceCreator batches.WorkspaceCreator
+		fetcher          batches.RepoFetcher
+	)
+	if fetchMethod == "git" {
+		// Clones are used as workspaces as they are, so they have to stay on
+		// the host filesystem.
+		if flags.workspace == "volume" {
+			return "", "", errors.New("repositories fetched with git can't be used with volume workspaces")
+		}
+		workspaceCreator = svc.NewBindWorkspaceCreator(flags.cacheDir)
+		fetcher = svc.NewGitRepoFetcher(flags.cacheDir, flags.gitURL, api.NewTransportSettings(cfg.clientOpts(flags.api, nil)))
+	} else {
+		workspaceCreator = svc.NewWorkspaceCreator(ctx, flags.cacheDir, flags.tempDir, batchSpec.Steps)
+		fetcher = svc.NewRepoFetcher(flags.cacheDir, flags.cleanArchives)
+	}
 	pending.VerboseLine(output.Linef("🚧", output.StyleSuccess, "Workspace creator: %T", workspaceCreator))
 	batchCompletePending(pending, "Prepared workspaces")
 
-	fetcher := svc.NewRepoFetcher(flags.cacheDir, flags.cleanArchives)
 	for _, task := range tasks {
 		task.Archive = fetcher.Checkout(task.Repository, task.ArchivePathToFetch())
 	}
 
 	opts := batches.ExecutorOpts{
-		Cache:       svc.NewExecutionCache(flags.cacheDir),
+		Cache:       cache,
 		Creator:     workspaceCreator,
 		ClearCache:  flags.clearCache,
 		KeepLogs:    flags.keepLogs,
 		Timeout:     flags.timeout,
 		TempDir:     flags.tempDir,
 		Parallelism: flags.parallelism,
+		Runtime:     stepRuntime,
+		Resources:   flags.resources,
+		Network:     flags.network,
+		Journal:     journal,
 	}
 
 	p := newBatchProgressPrinter(out, *verbose, flags.parallelism)
-	specs, logFiles, err := svc.ExecuteBatchSpec(ctx, opts, tasks, batchSpec, p.PrintStatuses, flags.skipErrors)
+	// The final statuses provide the outputs and log files for -export.
+	var (
+		statusesMu sync.Mutex
+		statuses   []*batches.TaskStatus
+	)
+	printStatuses := func(s []*batches.TaskStatus) {
+		statusesMu.Lock()
+		statuses = s
+		statusesMu.Unlock()
+		p.PrintStatuses(s)
+	}
+	specs, logFiles, err := svc.ExecuteBatchSpec(ctx, opts, tasks, batchSpec, printStatuses, flags.skipErrors)
 	if err != nil && !flags.skipErrors {
 		return "", "", err
 	}
+	specs = append(completedSpecs, specs...)
 	p.Complete()
+
+	// Errors of the remote cache are only reported once the progress is no
+	// longer displayed.
+	remoteCacheErrsMu.Lock()
+	if len(remoteCacheErrs) > 0 {
+		block := out.Block(output.Linef(output.EmojiWarning, output.StyleWarning, "The remote execution cache couldn't be used %d times and was skipped:", len(remoteCacheErrs)))
+		for _, err := range remoteCacheErrs {
+			block.Write(err.Error())
+		}
+		block.Close()
+	}
+	remoteCacheErrsMu.Unlock()
 	if err != nil && flags.skipErrors {
 		printExecutionError(out, err)
 		out.WriteLine(output.Line(output.EmojiWarning, output.StyleWarning, "Skipping errors because -skip-errors was used."))
@@ -299,6 +551,16 @@ func batchExecute(ctx context.Context, out *output.Output, svc *batches.Service,
 		return "", "", err
 	}
 
+	if flags.export != "" {
+		statusesMu.Lock()
+		report, err := batchExport(flags.export, batchSpec, specs, statuses, time.Now())
+		statusesMu.Unlock()
+		if err != nil {
+			return "", "", errors.Wrap(err, "exporting execution results")
+		}
+		out.WriteLine(output.Linef(output.EmojiSuccess, output.StyleSuccess, "Exported %d patches and report to %s", len(report.Changesets), flags.export))
+	}
+
 	ids := make([]graphql.ChangesetSpecID, len(specs))
 
 	if len(specs) > 0 {
@@ -314,7 +576,7 @@ func batchExecute(ctx context.Context, out *output.Output, svc *batches.Service,
 		}, nil)
 
 		for i, spec := range specs {
-			id, err := svc.CreateChangesetSpec(ctx, spec)
+			id, err := batchCreateChangesetSpec(ctx, svc, journal, spec)
 			if err != nil {
 				return "", "", err
 			}
@@ -335,9 +597,33 @@ func batchExecute(ctx context.Context, out *output.Output, svc *batches.Service,
 		return "", "", prettyPrintBatchUnlicensedError(out, err)
 	}
 
+	// The run is complete, so there's nothing left to resume.
+	if journal != nil {
+		if err := journal.Remove(); err != nil {
+			out.Verbosef("Removing run journal: %v", err)
+		}
+	}
+
 	return id, url, nil
 }
 
+// batchCreateChangesetSpec creates the given changeset spec on Sourcegraph,
+// unless the run in the journal has already created it.
+func batchCreateChangesetSpec(ctx context.Context, svc *batches.Service, journal *batches.RunJournal, spec *batches.ChangesetSpec) (graphql.ChangesetSpecID, error) {
+	if journal == nil {
+		return svc.CreateChangesetSpec(ctx, spec)
+	}
+
+	if id, ok, err := journal.ChangesetSpecID(spec); err != nil || ok {
+		return id, err
+	}
+	id, err := svc.CreateChangesetSpec(ctx, spec)
+	if err != nil {
+		return "", err
+	}
+	return id, journal.ChangesetSpecCreated(spec, id)
+}
+
 // batchParseSpec parses and validates the given batch spec. If the spec has
 // validation errors, the errors are output in a human readable form and an
 // exitCodeError is returned.
@@ -527,21 +813,28 @@ func diffStatDescription(fileDiffs []*diff.FileDiff) string {
 }
 
 func diffStatDiagram(stat diff.Stat) string {
-	const maxWidth = 20
-	added := float64(stat.Added + stat.Changed)
-	deleted := float64(stat.Deleted + stat.Changed)
-	if total := added + deleted; total > maxWidth {
-		x := float64(20) / total
-		added *= x
-		deleted *= x
-	}
+	added, deleted := diffStatWidths(stat)
 	return fmt.Sprintf("%s%s%s%s%s",
-		output.StyleLinesAdded, strings.Repeat("+", int(added)),
-		output.StyleLinesDeleted, strings.Repeat("-", int(deleted)),
+		output.StyleLinesAdded, strings.Repeat("+", added),
+		output.StyleLinesDeleted, strings.Repeat("-", deleted),
 		output.StyleReset,
 	)
 }
 
+// diffStatWidths returns the number of + and - characters that represent the
+// given stat in a diagram.
+func diffStatWidths(stat diff.Stat) (added, deleted int) {
+	const maxWidth = 20
+	a := float64(stat.Added + stat.Changed)
+	d := float64(stat.Deleted + stat.Changed)
+	if total := a + d; total > maxWidth {
+		x := float64(20) / total
+		a *= x
+		d *= x
+	}
+	return int(a), int(d)
+}
+
 func checkExecutable(cmd string, args ...string) error {
 	if err := exec.Command(cmd, args...).Run(); err != nil {
 		return fmt.Errorf(
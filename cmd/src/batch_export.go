@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/go-diff/diff"
+	"github.com/sourcegraph/src-cli/internal/batches"
+)
+
+// batchReport describes the results of executing a batch spec, as exported
+// with -export.
+type batchReport struct {
+	Name        string
+	GeneratedAt time.Time
+
+	Changesets []batchReportChangeset
+	Errors     []batchReportError
+
+	Files int
+	Stat  diff.Stat
+}
+
+type batchReportChangeset struct {
+	Repository string
+	Path       string
+	BaseRef    string
+	BaseRev    string
+	Branch     string
+	Title      string
+	Body       string
+	Commits    int
+
+	Files   int
+	Stat    diff.Stat
+	Diagram string
+
+	// Patch is the path of the patch file, relative to the export directory.
+	Patch string
+
+	// Outputs are the outputs of the steps, and LogFile the log of running
+	// them, if it was kept.
+	Outputs map[string]interface{}
+	LogFile string
+}
+
+type batchReportError struct {
+	Repository string
+	Path       string
+	Error      string
+	LogFile    string
+}
+
+// batchExport writes a patch for each changeset spec that creates a
+// changeset to dir, along with a report in Markdown and HTML. The statuses of
+// the tasks that produced the specs provide their outputs and log files.
+func batchExport(dir string, batchSpec *batches.BatchSpec, specs []*batches.ChangesetSpec, statuses []*batches.TaskStatus, now time.Time) (*batchReport, error) {
+	byChangesetSpec := map[*batches.ChangesetSpec]*batches.TaskStatus{}
+	report := &batchReport{Name: batchSpec.Name, GeneratedAt: now}
+	for _, status := range statuses {
+		for _, spec := range status.ChangesetSpecs {
+			byChangesetSpec[spec] = status
+		}
+		if status.Err != nil {
+			report.Errors = append(report.Errors, batchReportError{
+				Repository: status.RepoName,
+				Path:       status.Path,
+				Error:      status.Err.Error(),
+				LogFile:    batchExistingFile(status.LogFile),
+			})
+		}
+	}
+
+	for _, spec := range specs {
+		// Imported changesets have nothing to export.
+		if spec.CreatedChangeset == nil {
+			continue
+		}
+
+		changeset := batchReportChangeset{
+			Repository: spec.BaseRepository,
+			BaseRef:    spec.BaseRef,
+			BaseRev:    spec.BaseRev,
+			Branch:     strings.TrimPrefix(spec.HeadRef, "refs/heads/"),
+			Title:      spec.Title,
+			Body:       spec.Body,
+			Commits:    len(spec.Commits),
+		}
+		if status, ok := byChangesetSpec[spec]; ok {
+			changeset.Repository = status.RepoName
+			changeset.Path = status.Path
+			changeset.Outputs = status.Outputs
+			changeset.LogFile = batchExistingFile(status.LogFile)
+		}
+
+		for _, commit := range spec.Commits {
+			fileDiffs, err := diff.ParseMultiFileDiff([]byte(commit.Diff))
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing diff for %s", changeset.Repository)
+			}
+			stat := sumDiffStats(fileDiffs)
+			changeset.Files += len(fileDiffs)
+			changeset.Stat.Added += stat.Added
+			changeset.Stat.Changed += stat.Changed
+			changeset.Stat.Deleted += stat.Deleted
+		}
+		added, deleted := diffStatWidths(changeset.Stat)
+		changeset.Diagram = strings.Repeat("+", added) + strings.Repeat("-", deleted)
+
+		changeset.Patch = filepath.ToSlash(filepath.Join(
+			filepath.FromSlash(changeset.Repository),
+			strings.ReplaceAll(changeset.Branch, "/", "-")+".patch",
+		))
+		var patch bytes.Buffer
+		if err := batchFormatPatch(&patch, spec, now); err != nil {
+			return nil, err
+		}
+		if err := batchWriteExportFile(dir, changeset.Patch, patch.Bytes()); err != nil {
+			return nil, err
+		}
+
+		report.Changesets = append(report.Changesets, changeset)
+		report.Files += changeset.Files
+		report.Stat.Added += changeset.Stat.Added
+		report.Stat.Changed += changeset.Stat.Changed
+		report.Stat.Deleted += changeset.Stat.Deleted
+	}
+
+	sort.Slice(report.Changesets, func(i, j int) bool {
+		a, b := report.Changesets[i], report.Changesets[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return a.Branch < b.Branch
+	})
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Repository < report.Errors[j].Repository
+	})
+
+	var md bytes.Buffer
+	if err := batchReportMarkdown.Execute(&md, report); err != nil {
+		return nil, errors.Wrap(err, "rendering Markdown report")
+	}
+	if err := batchWriteExportFile(dir, "report.md", md.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var html bytes.Buffer
+	if err := batchReportHTML.Execute(&html, report); err != nil {
+		return nil, errors.Wrap(err, "rendering HTML report")
+	}
+	if err := batchWriteExportFile(dir, "report.html", html.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func batchWriteExportFile(dir, name string, data []byte) error {
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// batchExistingFile returns path if it's a file that exists, since log files
+// are removed after executing steps unless -keep-logs is given.
+func batchExistingFile(path string) string {
+	if path == "" {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// batchFormatPatch writes the commits of the given changeset spec to w in the
+// format of 'git format-patch', so that they can be applied with 'git am'.
+func batchFormatPatch(w io.Writer, spec *batches.ChangesetSpec, date time.Time) error {
+	for i, commit := range spec.Commits {
+		subject, body := commit.Message, ""
+		if i := strings.IndexByte(subject, '\n'); i >= 0 {
+			subject, body = subject[:i], strings.TrimSpace(subject[i+1:])
+		}
+		prefix := "[PATCH]"
+		if len(spec.Commits) > 1 {
+			prefix = fmt.Sprintf("[PATCH %d/%d]", i+1, len(spec.Commits))
+		}
+
+		name, email := commit.AuthorName, commit.AuthorEmail
+		if name == "" && email == "" {
+			name, email = "Sourcegraph", "batch-changes@sourcegraph.com"
+		}
+
+		fileDiffs, err := diff.ParseMultiFileDiff([]byte(commit.Diff))
+		if err != nil {
+			return errors.Wrapf(err, "parsing diff for %s", spec.BaseRepository)
+		}
+		stat := sumDiffStats(fileDiffs)
+
+		fmt.Fprintf(w, "From %s Mon Sep 17 00:00:00 2001\n", strings.Repeat("0", 40))
+		fmt.Fprintf(w, "From: %s <%s>\n", name, email)
+		fmt.Fprintf(w, "Date: %s\n", date.Format(time.RFC1123Z))
+		fmt.Fprintf(w, "Subject: %s %s\n\n", prefix, subject)
+		if body != "" {
+			fmt.Fprintf(w, "%s\n", body)
+		}
+		fmt.Fprintf(w, "---\n %s, %d insertions(+), %d deletions(-)\n\n", diffStatDescription(fileDiffs), stat.Added+stat.Changed, stat.Deleted+stat.Changed)
+		fmt.Fprint(w, prefixDiffPaths(commit.Diff))
+		if _, err := fmt.Fprint(w, "-- \nsrc batch\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefixDiffPaths adds the a/ and b/ prefixes that git uses by default to the
+// paths in the headers of d, which is created with --no-prefix, so that the
+// patch can be applied without -p0.
+func prefixDiffPaths(d string) string {
+	var out strings.Builder
+	var header []string
+	inHeader := false
+
+	flushHeader := func() {
+		if len(header) > 0 {
+			writePrefixedDiffHeader(&out, header)
+			header = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(d))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(d)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flushHeader()
+			inHeader = true
+			header = append(header, line)
+		case inHeader && (strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "GIT binary patch") || strings.HasPrefix(line, "Binary files ")):
+			flushHeader()
+			inHeader = false
+			out.WriteString(line + "\n")
+		case inHeader:
+			header = append(header, line)
+		default:
+			out.WriteString(line + "\n")
+		}
+	}
+	flushHeader()
+	return out.String()
+}
+
+func writePrefixedDiffHeader(out *strings.Builder, header []string) {
+	// The paths in the "diff --git" line are ambiguous if they contain
+	// spaces, so they're taken from the other lines of the header if
+	// possible. Without those, both paths are the same.
+	var oldName, newName string
+	for _, line := range header[1:] {
+		switch {
+		case strings.HasPrefix(line, "rename from "):
+			oldName = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			newName = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "copy from "):
+			oldName = strings.TrimPrefix(line, "copy from ")
+		case strings.HasPrefix(line, "copy to "):
+			newName = strings.TrimPrefix(line, "copy to ")
+		case strings.HasPrefix(line, "--- ") && oldName == "":
+			if name := strings.TrimPrefix(line, "--- "); name != "/dev/null" {
+				oldName = name
+			}
+		case strings.HasPrefix(line, "+++ ") && newName == "":
+			if name := strings.TrimPrefix(line, "+++ "); name != "/dev/null" {
+				newName = name
+			}
+		}
+	}
+	if oldName == "" || newName == "" {
+		names := strings.TrimPrefix(header[0], "diff --git ")
+		if half := len(names) / 2; len(names)%2 == 1 && names[:half] == names[half+1:] {
+			oldName, newName = names[:half], names[half+1:]
+		} else if oldName == "" {
+			oldName = newName
+		} else {
+			newName = oldName
+		}
+	}
+
+	fmt.Fprintf(out, "diff --git %s %s\n", prefixDiffPath("a/", oldName), prefixDiffPath("b/", newName))
+	for _, line := range header[1:] {
+		switch {
+		case strings.HasPrefix(line, "--- ") && line != "--- /dev/null":
+			line = "--- " + prefixDiffPath("a/", strings.TrimPrefix(line, "--- "))
+		case strings.HasPrefix(line, "+++ ") && line != "+++ /dev/null":
+			line = "+++ " + prefixDiffPath("b/", strings.TrimPrefix(line, "+++ "))
+		}
+		out.WriteString(line + "\n")
+	}
+}
+
+// prefixDiffPath adds prefix to a path in a diff header, which git quotes if
+// it contains special characters.
+func prefixDiffPath(prefix, name string) string {
+	if strings.HasPrefix(name, `"`) {
+		return `"` + prefix + name[1:]
+	}
+	return prefix + name
+}
+
+var batchReportFuncs = map[string]interface{}{
+	"outputs": func(outputs map[string]interface{}) (string, error) {
+		data, err := json.MarshalIndent(outputs, "", "  ")
+		return string(data), err
+	},
+	"insertions": func(stat diff.Stat) int32 { return stat.Added + stat.Changed },
+	"deletions":  func(stat diff.Stat) int32 { return stat.Deleted + stat.Changed },
+	"date":       func(t time.Time) string { return t.Format(time.RFC1123) },
+}
+
+var batchReportMarkdown = template.Must(template.New("report.md").Funcs(batchReportFuncs).Parse(`# Batch spec {{.Name}}
+
+Generated by src on {{date .GeneratedAt}}.
+
+{{len .Changesets}} changesets, {{.Files}} files changed, {{insertions .Stat}} insertions(+), {{deletions .Stat}} deletions(-).
+{{- if .Changesets}}
+
+| Repository | Branch | Changes | Patch |
+| --- | --- | --- | --- |
+{{- range .Changesets}}
+| {{.Repository}}{{with .Path}}:{{.}}{{end}} | ` + "`{{.Branch}}`" + ` | +{{insertions .Stat}} -{{deletions .Stat}} ` + "`{{.Diagram}}`" + ` | [{{.Patch}}]({{.Patch}}) |
+{{- end}}
+{{- end}}
+{{range .Changesets}}
+## {{.Repository}}{{with .Path}}:{{.}}{{end}}: {{.Title}}
+
+Branch ` + "`{{.Branch}}`" + ` on ` + "`{{.BaseRef}}`" + ` at ` + "`{{.BaseRev}}`" + `, {{.Commits}} commit(s), {{.Files}} files changed, {{insertions .Stat}} insertions(+), {{deletions .Stat}} deletions(-).
+{{- with .Body}}
+
+{{.}}
+{{- end}}
+{{- if .Outputs}}
+
+Outputs:
+
+` + "```json" + `
+{{outputs .Outputs}}
+` + "```" + `
+{{- end}}
+{{- with .LogFile}}
+
+Log: [{{.}}](file://{{.}})
+{{- end}}
+{{end}}
+{{- if .Errors}}
+## Errors
+{{range .Errors}}
+- {{.Repository}}{{with .Path}}:{{.}}{{end}}: {{.Error}}{{with .LogFile}} ([log](file://{{.}})){{end}}
+{{- end}}
+{{end}}`))
+
+var batchReportHTML = htmltemplate.Must(htmltemplate.New("report.html").Funcs(batchReportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Batch spec {{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.added { color: #2da44e; }
+.deleted { color: #cf222e; }
+pre { background: #f6f8fa; padding: 1em; }
+</style>
+</head>
+<body>
+<h1>Batch spec {{.Name}}</h1>
+<p>Generated by src on {{date .GeneratedAt}}.</p>
+<p>{{len .Changesets}} changesets, {{.Files}} files changed, <span class="added">{{insertions .Stat}} insertions(+)</span>, <span class="deleted">{{deletions .Stat}} deletions(-)</span>.</p>
+{{- if .Changesets}}
+<table>
+<tr><th>Repository</th><th>Branch</th><th>Changes</th><th>Patch</th></tr>
+{{- range .Changesets}}
+<tr><td>{{.Repository}}{{with .Path}}:{{.}}{{end}}</td><td><code>{{.Branch}}</code></td><td><span class="added">+{{insertions .Stat}}</span> <span class="deleted">-{{deletions .Stat}}</span></td><td><a href="{{.Patch}}">{{.Patch}}</a></td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- range .Changesets}}
+<h2>{{.Repository}}{{with .Path}}:{{.}}{{end}}: {{.Title}}</h2>
+<p>Branch <code>{{.Branch}}</code> on <code>{{.BaseRef}}</code> at <code>{{.BaseRev}}</code>, {{.Commits}} commit(s), {{.Files}} files changed, <span class="added">{{insertions .Stat}} insertions(+)</span>, <span class="deleted">{{deletions .Stat}} deletions(-)</span>.</p>
+{{- with .Body}}
+<pre>{{.}}</pre>
+{{- end}}
+{{- if .Outputs}}
+<p>Outputs:</p>
+<pre>{{outputs .Outputs}}</pre>
+{{- end}}
+{{- with .LogFile}}
+<p>Log: <a href="file://{{.}}">{{.}}</a></p>
+{{- end}}
+{{- end}}
+{{- if .Errors}}
+<h2>Errors</h2>
+<ul>
+{{- range .Errors}}
+<li>{{.Repository}}{{with .Path}}:{{.}}{{end}}: {{.Error}}{{with .LogFile}} (<a href="file://{{.}}">log</a>){{end}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/batches"
+)
+
+func TestPrefixDiffPaths(t *testing.T) {
+	for name, tc := range map[string]struct {
+		in, want string
+	}{
+		"modified": {
+			in: `diff --git README.md README.md
+index 1914491..cd2ccbf 100644
+--- README.md
++++ README.md
+@@ -1,2 +1,2 @@
+--- README.md
++++ README.md
+`,
+			want: `diff --git a/README.md b/README.md
+index 1914491..cd2ccbf 100644
+--- a/README.md
++++ b/README.md
+@@ -1,2 +1,2 @@
+--- README.md
++++ README.md
+`,
+		},
+		"added and deleted": {
+			in: `diff --git new.txt new.txt
+new file mode 100644
+index 0000000..3e75765
+--- /dev/null
++++ new.txt
+@@ -0,0 +1 @@
++new
+diff --git old.txt old.txt
+deleted file mode 100644
+index 3e75765..0000000
+--- old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+`,
+			want: `diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000..3e75765
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++new
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+index 3e75765..0000000
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+`,
+		},
+		"renamed with spaces": {
+			in: `diff --git my file.txt your file.txt
+similarity index 100%
+rename from my file.txt
+rename to your file.txt
+`,
+			want: `diff --git a/my file.txt b/your file.txt
+similarity index 100%
+rename from my file.txt
+rename to your file.txt
+`,
+		},
+		"mode change": {
+			in: `diff --git run.sh run.sh
+old mode 100644
+new mode 100755
+`,
+			want: `diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+`,
+		},
+		"quoted": {
+			in: `diff --git "t\303\244st.txt" "t\303\244st.txt"
+index 1914491..cd2ccbf 100644
+--- "t\303\244st.txt"
++++ "t\303\244st.txt"
+@@ -1 +1 @@
+-a
++b
+`,
+			want: `diff --git "a/t\303\244st.txt" "b/t\303\244st.txt"
+index 1914491..cd2ccbf 100644
+--- "a/t\303\244st.txt"
++++ "b/t\303\244st.txt"
+@@ -1 +1 @@
+-a
++b
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, prefixDiffPaths(tc.in)); diff != "" {
+				t.Errorf("wrong diff (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBatchExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch-export-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	spec := &batches.ChangesetSpec{
+		BaseRepository: "repo-id",
+		CreatedChangeset: &batches.CreatedChangeset{
+			BaseRef: "refs/heads/main",
+			BaseRev: "d34db33f",
+			HeadRef: "refs/heads/batch/hello",
+			Title:   "Hello World",
+			Body:    "Says hello",
+			Commits: []batches.GitCommitDescription{{
+				Message:     "Say hello\n\nTo the world.",
+				AuthorName:  "Mary McButtons",
+				AuthorEmail: "mary@example.com",
+				Diff: `diff --git README.md README.md
+index 1914491..cd2ccbf 100644
+--- README.md
++++ README.md
+@@ -1 +1 @@
+-# README
++# Hello World
+`,
+			}},
+		},
+	}
+	statuses := []*batches.TaskStatus{
+		{
+			RepoName:       "github.com/sourcegraph/src-cli",
+			ChangesetSpecs: []*batches.ChangesetSpec{spec},
+			Outputs:        map[string]interface{}{"greeting": "hello"},
+		},
+		{
+			RepoName: "github.com/sourcegraph/sourcegraph",
+			Err:      os.ErrPermission,
+		},
+	}
+	imported := &batches.ChangesetSpec{
+		BaseRepository:    "other-repo-id",
+		ExternalChangeset: &batches.ExternalChangeset{ExternalID: "123"},
+	}
+
+	now := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	report, err := batchExport(dir, &batches.BatchSpec{Name: "hello"}, []*batches.ChangesetSpec{spec, imported}, statuses, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := len(report.Changesets), 1; have != want {
+		t.Fatalf("wrong number of changesets: have=%d want=%d", have, want)
+	}
+	if have, want := len(report.Errors), 1; have != want {
+		t.Fatalf("wrong number of errors: have=%d want=%d", have, want)
+	}
+
+	patch, err := ioutil.ReadFile(filepath.Join(dir, "github.com", "sourcegraph", "src-cli", "batch-hello.patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001
+From: Mary McButtons <mary@example.com>
+Date: Thu, 01 Apr 2021 12:00:00 +0000
+Subject: [PATCH] Say hello
+
+To the world.
+---
+ 1 file changed, 1 insertions(+), 1 deletions(-)
+
+diff --git a/README.md b/README.md
+index 1914491..cd2ccbf 100644
+--- a/README.md
++++ b/README.md
+@@ -1 +1 @@
+-# README
++# Hello World
+` + "-- \nsrc batch\n\n"
+	if diff := cmp.Diff(want, string(patch)); diff != "" {
+		t.Errorf("wrong patch (-want +have):\n%s", diff)
+	}
+
+	for _, name := range []string{"report.md", "report.html"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{
+			"github.com/sourcegraph/src-cli",
+			"github.com/sourcegraph/src-cli/batch-hello.patch",
+			"greeting",
+			"github.com/sourcegraph/sourcegraph",
+			os.ErrPermission.Error(),
+		} {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s doesn't contain %q", name, s)
+			}
+		}
+	}
+}
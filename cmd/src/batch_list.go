@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func init() {
+	usage := `
+'src batch list' lists the batch changes on the Sourcegraph instance that are
+visible to the user, with their state and the number of changesets in each
+state.
+
+Usage:
+
+    src batch list [command options]
+
+Examples:
+
+  List all batch changes:
+
+    $ src batch list
+
+  List the open batch changes of the sourcegraph organization:
+
+    $ src batch list -state open -n sourcegraph
+
+  Print the batch changes as JSON:
+
+    $ src -o json batch list
+
+`
+
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	var (
+		flags      = newBatchManageFlags(flagSet)
+		firstFlag  = flagSet.Int("first", 1000, "Returns the first n batch changes from the list. (use -1 for unlimited)")
+		stateFlag  = flagSet.String("state", "", `Only list batch changes in this state ("open" or "closed").`)
+		formatFlag = flagSet.String("f", batchChangeFormat, `Format for the output, using the syntax of Go package text/template. (e.g. "{{.Name}}: {{.URL}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if len(flagSet.Args()) != 0 {
+			return &usageError{errors.New("additional arguments not allowed")}
+		}
+
+		state := strings.ToUpper(*stateFlag)
+		if state != "" && state != "OPEN" && state != "CLOSED" {
+			return &usageError{errors.Errorf("invalid -state %q: must be open or closed", *stateFlag)}
+		}
+
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+		expectRecords()
+
+		ctx := context.Background()
+		svc, err := batchManageService(ctx, flagSet, flags)
+		if err != nil {
+			return err
+		}
+
+		// The API lists the batch changes in all namespaces, so the namespace
+		// is filtered here.
+		limit := *firstFlag
+		if flags.namespace != "" {
+			limit = -1
+		}
+		listed := 0
+		errLimitReached := errors.New("limit reached")
+		err = svc.ListBatchChanges(ctx, graphql.ListBatchChangesOpts{State: state, Limit: limit}, func(batchChange *graphql.BatchChange) error {
+			if flags.namespace != "" && batchChange.Namespace.NamespaceName != flags.namespace {
+				return nil
+			}
+			if *firstFlag >= 0 && listed >= *firstFlag {
+				return errLimitReached
+			}
+			listed++
+			return execTemplate(tmpl, batchChange)
+		})
+		if err == errLimitReached {
+			return nil
+		}
+		return err
+	}
+
+	// Register the command.
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+// batchChangeFormat is the default -f template for batch changes.
+const batchChangeFormat = "{{.Namespace.NamespaceName}}/{{.Name}}\t{{.State}}\t{{.ChangesetsStats.Total}} changesets: {{.ChangesetsStats.Open}} open, {{.ChangesetsStats.Merged}} merged, {{.ChangesetsStats.Closed}} closed, {{.ChangesetsStats.Unpublished}} unpublished, {{.ChangesetsStats.Failed}} failed\t{{.URL}}"
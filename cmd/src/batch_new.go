@@ -77,7 +77,7 @@ Examples:
 			return errors.Wrap(err, "failed to write batch spec to file")
 		}
 
-		fmt.Printf("%s created.\n", *fileFlag)
+		fmt.Fprintf(proseOutput(), "%s created.\n", *fileFlag)
 		return nil
 	}
 
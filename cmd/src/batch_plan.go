@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/batches"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/output"
+)
+
+func init() {
+	usage := `
+'src batch plan' executes the steps in a batch spec, uploads it to a Sourcegraph
+instance and shows what applying it would change, compared to the batch change
+that is currently applied: which changesets would be created, updated, closed
+or detached, and how their diffs would change.
+
+Unchanged changesets are only shown with -v. With the global -o flag, the plan
+is printed in a structured format instead, one record per changeset.
+
+Usage:
+
+    src batch plan -f FILE [command options]
+
+Examples:
+
+    $ src batch plan -f batch.spec.yaml
+
+    $ src -o json batch plan -f batch.spec.yaml
+
+`
+
+	flagSet := flag.NewFlagSet("plan", flag.ExitOnError)
+	flags := newBatchApplyFlags(flagSet, batchDefaultCacheDir(), batchDefaultTempDirPrefix())
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		if len(flagSet.Args()) != 0 {
+			return &usageError{errors.New("additional arguments not allowed")}
+		}
+
+		out := output.NewOutput(flagSet.Output(), output.OutputOpts{Verbose: *verbose})
+
+		ctx, cancel := contextCancelOnInterrupt(context.Background())
+		defer cancel()
+
+		runtime, err := batches.NewRuntime(flags.runtime)
+		if err != nil {
+			return &usageError{err}
+		}
+
+		svc := batches.NewService(&batches.ServiceOpts{
+			AllowUnsupported: flags.allowUnsupported,
+			Client:           cfg.apiClient(flags.api, flagSet.Output()),
+			Workspace:        flags.workspace,
+			Runtime:          runtime,
+		})
+
+		if err := svc.DetermineFeatureFlags(ctx); err != nil {
+			return err
+		}
+
+		id, url, err := batchExecute(ctx, out, svc, flags)
+		if err != nil {
+			printExecutionError(out, err)
+			out.Write("")
+			return &exitCodeError{nil, 1}
+		}
+
+		pending := batchCreatePending(out, "Computing plan")
+		var plan []batchPlanChangeset
+		err = svc.ApplyPreview(ctx, id, func(p *graphql.ChangesetApplyPreview) error {
+			plan = append(plan, newBatchPlanChangeset(p))
+			return nil
+		})
+		if err != nil {
+			pending.Destroy()
+			return errors.Wrap(err, "querying apply preview")
+		}
+		batchCompletePending(pending, "Computing plan")
+
+		if *outputFormatFlag != "" {
+			// An empty plan is printed as an empty list of records.
+			expectRecords()
+			for _, c := range plan {
+				if err := emitRecord(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		out.Write("")
+		batchPrintPlan(output.NewOutput(os.Stdout, output.OutputOpts{Verbose: *verbose}), plan)
+
+		out.Write("")
+		block := out.Block(output.Line(batchSuccessEmoji, batchSuccessColor, "To apply the batch spec, go to:"))
+		defer block.Close()
+		block.Writef("%s%s", cfg.Endpoint, url)
+
+		return nil
+	}
+
+	batchCommands = append(batchCommands, &command{
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"f": completeBatchSpecFiles},
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
+
+// The actions in a plan.
+const (
+	batchPlanCreate    = "create"
+	batchPlanImport    = "import"
+	batchPlanUpdate    = "update"
+	batchPlanClose     = "close"
+	batchPlanDetach    = "detach"
+	batchPlanUnchanged = "unchanged"
+)
+
+// batchPlanChangeset is what applying a batch spec would do to a changeset.
+type batchPlanChangeset struct {
+	Action     string
+	Operations []string
+	Hidden     bool
+
+	Repository string
+	Branch     string
+	Title      string
+	ExternalID string
+	URL        string
+
+	// Changes are the properties of an existing changeset that would change.
+	Changes []string
+
+	// DiffStat is the diff stat of the changeset after applying the batch
+	// spec, and OldDiffStat the one of the existing changeset.
+	DiffStat    *graphql.DiffStat
+	OldDiffStat *graphql.DiffStat
+}
+
+func newBatchPlanChangeset(p *graphql.ChangesetApplyPreview) batchPlanChangeset {
+	c := batchPlanChangeset{Operations: p.Operations, Hidden: p.Hidden()}
+	if c.Operations == nil {
+		c.Operations = []string{}
+	}
+
+	has := func(operation string) bool {
+		for _, o := range p.Operations {
+			if o == operation {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case strings.HasSuffix(p.Targets.Typename, "TargetsAttach") && has("IMPORT"):
+		c.Action = batchPlanImport
+	case strings.HasSuffix(p.Targets.Typename, "TargetsAttach"):
+		c.Action = batchPlanCreate
+	case has("CLOSE"):
+		c.Action = batchPlanClose
+	case strings.HasSuffix(p.Targets.Typename, "TargetsDetach"):
+		c.Action = batchPlanDetach
+	case len(p.Operations) == 0:
+		c.Action = batchPlanUnchanged
+	default:
+		c.Action = batchPlanUpdate
+	}
+
+	if spec := p.Targets.ChangesetSpec; spec != nil {
+		d := spec.Description
+		c.Repository = d.BaseRepository.Name
+		c.Branch = strings.TrimPrefix(d.HeadRef, "refs/heads/")
+		c.Title = d.Title
+		c.ExternalID = d.ExternalID
+		c.DiffStat = d.DiffStat
+	}
+	if changeset := p.Targets.Changeset; changeset != nil {
+		if changeset.Repository != nil {
+			c.Repository = changeset.Repository.Name
+		}
+		if c.Title == "" {
+			c.Title = changeset.Title
+		}
+		if changeset.ExternalURL != nil {
+			c.URL = changeset.ExternalURL.URL
+		}
+		c.OldDiffStat = changeset.DiffStat
+	}
+
+	c.Changes = []string{}
+	for _, change := range []struct {
+		changed bool
+		name    string
+	}{
+		{p.Delta.TitleChanged, "title"},
+		{p.Delta.BodyChanged, "body"},
+		{p.Delta.BaseRefChanged, "base branch"},
+		{p.Delta.DiffChanged, "diff"},
+		{p.Delta.CommitMessageChanged, "commit message"},
+		{p.Delta.AuthorNameChanged, "author name"},
+		{p.Delta.AuthorEmailChanged, "author email"},
+	} {
+		if change.changed {
+			c.Changes = append(c.Changes, change.name)
+		}
+	}
+
+	return c
+}
+
+// batchPrintPlan prints the changesets of a plan that would change, and a
+// summary of the plan. Unchanged changesets are only printed in verbose mode.
+func batchPrintPlan(out *output.Output, plan []batchPlanChangeset) {
+	counts := map[string]int{}
+	for _, c := range plan {
+		counts[c.Action]++
+
+		symbol, style := "~", output.StylePending
+		switch c.Action {
+		case batchPlanCreate, batchPlanImport:
+			symbol, style = "+", output.StyleSuccess
+		case batchPlanClose, batchPlanDetach:
+			symbol, style = "-", output.StyleWarning
+		case batchPlanUnchanged:
+			symbol, style = " ", output.StyleSuggestion
+		}
+
+		line := output.Linef(symbol, style, "%s", batchPlanDescription(c))
+		if c.Action == batchPlanUnchanged {
+			out.VerboseLine(line)
+		} else {
+			out.WriteLine(line)
+		}
+	}
+
+	if len(plan) > 0 {
+		out.Write("")
+	}
+	out.Writef("Plan: %d to create, %d to import, %d to update, %d to close, %d to detach, %d unchanged.",
+		counts[batchPlanCreate], counts[batchPlanImport], counts[batchPlanUpdate],
+		counts[batchPlanClose], counts[batchPlanDetach], counts[batchPlanUnchanged],
+	)
+}
+
+// batchPlanDescription describes a changeset of a plan on a single line.
+func batchPlanDescription(c batchPlanChangeset) string {
+	if c.Hidden {
+		return fmt.Sprintf("%s a changeset in a repository you don't have access to", c.Action)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", c.Action, c.Repository)
+	if c.Branch != "" {
+		fmt.Fprintf(&b, " %s", c.Branch)
+	}
+	if c.ExternalID != "" {
+		fmt.Fprintf(&b, " #%s", c.ExternalID)
+	}
+	if c.Title != "" {
+		fmt.Fprintf(&b, " %q", c.Title)
+	}
+	if c.Action == batchPlanUpdate && len(c.Changes) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(c.Changes, ", "))
+	}
+	if s := c.DiffStat; s != nil && c.Action != batchPlanClose && c.Action != batchPlanDetach {
+		fmt.Fprintf(&b, " +%d -%d", s.Added+s.Changed, s.Deleted+s.Changed)
+		if old := c.OldDiffStat; old != nil && c.Action == batchPlanUpdate && *old != *s {
+			fmt.Fprintf(&b, " (was +%d -%d)", old.Added+old.Changed, old.Deleted+old.Changed)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func TestNewBatchPlanChangeset(t *testing.T) {
+	spec := &graphql.ApplyPreviewChangesetSpec{
+		ID: "spec",
+		Description: graphql.ChangesetDescription{
+			Typename:       "GitBranchChangesetDescription",
+			BaseRepository: graphql.ChangesetRepository{Name: "github.com/sourcegraph/src-cli"},
+			HeadRef:        "refs/heads/batch/hello",
+			Title:          "Hello World",
+			DiffStat:       &graphql.DiffStat{Added: 3, Changed: 1},
+		},
+	}
+	changeset := &graphql.ApplyPreviewChangeset{
+		ID:          "changeset",
+		Title:       "Hello",
+		Repository:  &graphql.ChangesetRepository{Name: "github.com/sourcegraph/src-cli"},
+		ExternalURL: &graphql.ExternalURL{URL: "https://github.com/sourcegraph/src-cli/pull/1"},
+		DiffStat:    &graphql.DiffStat{Added: 1},
+	}
+
+	for name, tc := range map[string]struct {
+		preview         graphql.ChangesetApplyPreview
+		wantAction      string
+		wantChanges     []string
+		wantDescription string
+	}{
+		"create": {
+			preview: graphql.ChangesetApplyPreview{
+				Typename:   "VisibleChangesetApplyPreview",
+				Operations: []string{"PUSH", "PUBLISH"},
+				Targets:    graphql.ApplyPreviewTargets{Typename: "VisibleApplyPreviewTargetsAttach", ChangesetSpec: spec},
+			},
+			wantAction:      batchPlanCreate,
+			wantChanges:     []string{},
+			wantDescription: `create github.com/sourcegraph/src-cli batch/hello "Hello World" +4 -1`,
+		},
+		"import": {
+			preview: graphql.ChangesetApplyPreview{
+				Typename:   "VisibleChangesetApplyPreview",
+				Operations: []string{"IMPORT"},
+				Targets: graphql.ApplyPreviewTargets{Typename: "VisibleApplyPreviewTargetsAttach", ChangesetSpec: &graphql.ApplyPreviewChangesetSpec{
+					Description: graphql.ChangesetDescription{
+						Typename:       "ExistingChangesetReference",
+						BaseRepository: graphql.ChangesetRepository{Name: "github.com/sourcegraph/sourcegraph"},
+						ExternalID:     "123",
+					},
+				}},
+			},
+			wantAction:      batchPlanImport,
+			wantChanges:     []string{},
+			wantDescription: `import github.com/sourcegraph/sourcegraph #123`,
+		},
+		"update": {
+			preview: graphql.ChangesetApplyPreview{
+				Typename:   "VisibleChangesetApplyPreview",
+				Operations: []string{"PUSH", "UPDATE"},
+				Delta:      graphql.ChangesetSpecDelta{TitleChanged: true, DiffChanged: true},
+				Targets:    graphql.ApplyPreviewTargets{Typename: "VisibleApplyPreviewTargetsUpdate", ChangesetSpec: spec, Changeset: changeset},
+			},
+			wantAction:      batchPlanUpdate,
+			wantChanges:     []string{"title", "diff"},
+			wantDescription: `update github.com/sourcegraph/src-cli batch/hello "Hello World" (title, diff) +4 -1 (was +1 -0)`,
+		},
+		"unchanged": {
+			preview: graphql.ChangesetApplyPreview{
+				Typename: "VisibleChangesetApplyPreview",
+				Targets:  graphql.ApplyPreviewTargets{Typename: "VisibleApplyPreviewTargetsUpdate", ChangesetSpec: spec, Changeset: changeset},
+			},
+			wantAction:      batchPlanUnchanged,
+			wantChanges:     []string{},
+			wantDescription: `unchanged github.com/sourcegraph/src-cli batch/hello "Hello World" +4 -1`,
+		},
+		"close": {
+			preview: graphql.ChangesetApplyPreview{
+				Typename:   "VisibleChangesetApplyPreview",
+				Operations: []string{"CLOSE", "ARCHIVE"},
+				Targets:    graphql.ApplyPreviewTargets{Typename: "VisibleApplyPreviewTargetsDetach", Changeset: changeset},
+			},
+			wantAction:      batchPlanClose,
+			wantChanges:     []string{},
+			wantDescription: `close github.com/sourcegraph/src-cli "Hello"`,
+		},
+		"detach": {
+			preview: graphql.ChangesetApplyPreview{
+				Typename:   "VisibleChangesetApplyPreview",
+				Operations: []string{"DETACH"},
+				Targets:    graphql.ApplyPreviewTargets{Typename: "VisibleApplyPreviewTargetsDetach", Changeset: changeset},
+			},
+			wantAction:      batchPlanDetach,
+			wantChanges:     []string{},
+			wantDescription: `detach github.com/sourcegraph/src-cli "Hello"`,
+		},
+		"hidden": {
+			preview: graphql.ChangesetApplyPreview{
+				Typename:   "HiddenChangesetApplyPreview",
+				Operations: []string{"PUSH", "PUBLISH"},
+				Targets:    graphql.ApplyPreviewTargets{Typename: "HiddenApplyPreviewTargetsAttach"},
+			},
+			wantAction:      batchPlanCreate,
+			wantChanges:     []string{},
+			wantDescription: `create a changeset in a repository you don't have access to`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			have := newBatchPlanChangeset(&tc.preview)
+			if have.Action != tc.wantAction {
+				t.Errorf("wrong action: have=%q want=%q", have.Action, tc.wantAction)
+			}
+			if diff := cmp.Diff(tc.wantChanges, have.Changes); diff != "" {
+				t.Errorf("wrong changes (-want +have):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantDescription, batchPlanDescription(have)); diff != "" {
+				t.Errorf("wrong description (-want +have):\n%s", diff)
+			}
+		})
+	}
+}
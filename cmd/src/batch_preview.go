@@ -23,6 +23,11 @@ Examples:
 
     $ src batch preview -f batch.spec.yaml
 
+  Continue an interrupted run, reusing the workspaces it already executed and
+  the changeset specs it already uploaded:
+
+    $ src batch preview -resume 20210412-093015-a1b2c3
+
 `
 
 	flagSet := flag.NewFlagSet("preview", flag.ExitOnError)
@@ -42,10 +47,16 @@ Examples:
 		ctx, cancel := contextCancelOnInterrupt(context.Background())
 		defer cancel()
 
+		runtime, err := batches.NewRuntime(flags.runtime)
+		if err != nil {
+			return &usageError{err}
+		}
+
 		svc := batches.NewService(&batches.ServiceOpts{
 			AllowUnsupported: flags.allowUnsupported,
 			Client:           cfg.apiClient(flags.api, flagSet.Output()),
 			Workspace:        flags.workspace,
+			Runtime:          runtime,
 		})
 
 		if err := svc.DetermineFeatureFlags(ctx); err != nil {
@@ -68,8 +79,9 @@ Examples:
 	}
 
 	batchCommands = append(batchCommands, &command{
-		flagSet: flagSet,
-		handler: handler,
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"f": completeBatchSpecFiles},
 		usageFunc: func() {
 			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
 			flagSet.PrintDefaults()
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/sourcegraph/go-diff/diff"
@@ -203,6 +204,12 @@ func (p *batchProgressPrinter) PrintStatuses(statuses []*batches.TaskStatus) {
 			if len(ts.ChangesetSpecs) > 1 {
 				p.progress.Verbosef("  %d changeset specs generated", len(ts.ChangesetSpecs))
 			}
+			if len(ts.SkippedSteps) > 0 {
+				p.progress.Verbosef("  Skipped %s", stepsDescription(ts.SkippedSteps))
+			}
+			if len(ts.FailedSteps) > 0 {
+				p.progress.Verbosef("  Ignored failure of %s", stepsDescription(ts.FailedSteps))
+			}
 			p.progress.Verbosef("  Execution took %s", ts.ExecutionTime())
 			p.progress.Verbose("")
 		}
@@ -248,6 +255,19 @@ func (p *batchProgressPrinter) PrintStatuses(statuses []*batches.TaskStatus) {
 	}
 }
 
+// stepsDescription describes the given step numbers, such as "steps 2 and 3".
+func stepsDescription(steps []int) string {
+	if len(steps) == 1 {
+		return fmt.Sprintf("step %d", steps[0])
+	}
+
+	numbers := make([]string, len(steps))
+	for i, step := range steps {
+		numbers[i] = strconv.Itoa(step)
+	}
+	return fmt.Sprintf("steps %s and %s", strings.Join(numbers[:len(numbers)-1], ", "), numbers[len(numbers)-1])
+}
+
 type statusTexter interface {
 	StatusText() string
 }
@@ -275,6 +295,9 @@ func taskStatusBarText(ts *batches.TaskStatus) (string, error) {
 			}
 		}
 
+		if len(ts.FailedSteps) > 0 {
+			statusText += fmt.Sprintf(" (%s failed)", stepsDescription(ts.FailedSteps))
+		}
 		if ts.Cached {
 			statusText += " (cached)"
 		}
@@ -64,6 +64,7 @@ Examples:
 		if err != nil {
 			return err
 		}
+		expectRecords()
 
 		totalTmpl, err := parseTemplate(batchRepositoriesTotalTemplate)
 		if err != nil {
@@ -112,9 +113,10 @@ Examples:
 	}
 
 	batchCommands = append(batchCommands, &command{
-		flagSet: flagSet,
-		aliases: []string{"repos"},
-		handler: handler,
+		flagSet:     flagSet,
+		aliases:     []string{"repos"},
+		handler:     handler,
+		completions: map[string]completer{"f": completeBatchSpecFiles},
 		usageFunc: func() {
 			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
 			flagSet.PrintDefaults()
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func init() {
+	usage := `
+'src batch status' shows the changesets of a batch change, with their state,
+the state of their CI checks and their review state on the code host.
+
+Usage:
+
+    src batch status [command options] NAME
+
+Examples:
+
+  Show the changesets of the batch change hello-world:
+
+    $ src batch status hello-world
+
+  Show the changesets of a batch change in the sourcegraph organization that
+  failed to be published:
+
+    $ src batch status -n sourcegraph -state failed hello-world
+
+  Print the URLs of the open changesets that are waiting for a review, for a
+  reminder:
+
+    $ src batch status -state open -f '{{if eq .ReviewState "PENDING"}}{{.URL}}{{end}}' hello-world
+
+`
+
+	flagSet := flag.NewFlagSet("status", flag.ExitOnError)
+	var (
+		flags      = newBatchManageFlags(flagSet)
+		stateFlag  = flagSet.String("state", "", `Only show changesets in this state, such as "open", "merged" or "failed".`)
+		formatFlag = flagSet.String("f", batchChangesetFormat, `Format for the changesets, using the syntax of Go package text/template. (e.g. "{{.Repository}}: {{.State}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		svc, batchChange, err := batchLookupChange(ctx, flagSet, flags)
+		if err != nil {
+			return err
+		}
+
+		opts := graphql.ListChangesetsOpts{State: strings.ToUpper(*stateFlag)}
+		changesets, err := batchSelectChangesets(ctx, svc, batchChange, opts, "")
+		if err != nil {
+			return errors.Wrapf(err, "listing changesets of batch change %s", batchChange.Name)
+		}
+
+		// The summary goes to stderr, so that the changesets can be processed
+		// by scripts.
+		stats := batchChange.ChangesetsStats
+		fmt.Fprintf(flagSet.Output(), "%s/%s (%s): %d changesets: %d open, %d draft, %d merged, %d closed, %d unpublished, %d processing, %d failed\n",
+			batchChange.Namespace.NamespaceName, batchChange.Name, batchChange.State,
+			stats.Total, stats.Open, stats.Draft, stats.Merged, stats.Closed, stats.Unpublished, stats.Processing+stats.Retrying, stats.Failed,
+		)
+		return batchPrintChangesets(changesets, *formatFlag)
+	}
+
+	// Register the command.
+	batchCommands = append(batchCommands, &command{
+		flagSet: flagSet,
+		handler: handler,
+		usageFunc: func() {
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
+			flagSet.PrintDefaults()
+			fmt.Println(usage)
+		},
+	})
+}
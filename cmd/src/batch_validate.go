@@ -53,8 +53,9 @@ Examples:
 	}
 
 	batchCommands = append(batchCommands, &command{
-		flagSet: flagSet,
-		handler: handler,
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"f": completeBatchSpecFiles},
 		usageFunc: func() {
 			fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src batch %s':\n", flagSet.Name())
 			flagSet.PrintDefaults()
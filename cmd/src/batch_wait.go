@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/batches"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/output"
+)
+
+// batchWaitInterval is how often the changesets are polled while waiting for
+// them to be published.
+var batchWaitInterval = 5 * time.Second
+
+// batchChangesetPending returns whether the Sourcegraph instance is still
+// working on publishing or updating a changeset in the given state. All other
+// states, including FAILED and UNPUBLISHED, don't change by themselves.
+func batchChangesetPending(state string) bool {
+	switch state {
+	case "PROCESSING", "RETRYING", "SCHEDULED":
+		return true
+	default:
+		return false
+	}
+}
+
+// batchWaitForChangesets polls the changesets of the batch change until none
+// of them is pending anymore or the timeout is reached, showing their progress
+// and each change of their state. If changesets failed to be published, it
+// prints their errors and returns an error.
+func batchWaitForChangesets(ctx context.Context, out *output.Output, svc *batches.Service, batchChange *graphql.BatchChange, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		progress output.Progress
+		states   = map[string]string{}
+		ticker   = time.NewTicker(batchWaitInterval)
+	)
+	defer ticker.Stop()
+
+	for {
+		var changesets []*graphql.Changeset
+		err := svc.ListChangesets(ctx, batchChange.ID, graphql.ListChangesetsOpts{}, func(c *graphql.Changeset) error {
+			changesets = append(changesets, c)
+			return nil
+		})
+		if err != nil {
+			if progress != nil {
+				progress.Destroy()
+			}
+			if ctx.Err() == context.DeadlineExceeded {
+				return errors.Errorf("timed out after %s waiting for changesets to be published", timeout)
+			}
+			return errors.Wrap(err, "listing changesets")
+		}
+
+		if progress == nil {
+			progress = out.Progress([]output.ProgressBar{
+				{Label: "Publishing changesets", Max: float64(len(changesets))},
+			}, nil)
+		}
+
+		done := 0
+		var failed []*graphql.Changeset
+		for _, c := range changesets {
+			name := c.ID
+			if c.Repository != nil {
+				name = c.Repository.Name
+			}
+			if previous, ok := states[c.ID]; ok && previous != c.State {
+				progress.WriteLine(output.Linef("", batchChangesetStateStyle(c.State), "%s: %s → %s", name, previous, c.State))
+			}
+			states[c.ID] = c.State
+
+			if !batchChangesetPending(c.State) {
+				done++
+			}
+			if c.State == "FAILED" {
+				failed = append(failed, c)
+			}
+		}
+		progress.SetValue(0, float64(done))
+
+		if done == len(changesets) {
+			progress.Complete()
+			return batchReportFailedChangesets(out, failed)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			progress.Destroy()
+			if ctx.Err() == context.DeadlineExceeded {
+				return errors.Errorf("timed out after %s waiting for %d changesets to be published", timeout, len(changesets)-done)
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+func batchChangesetStateStyle(state string) output.Style {
+	switch state {
+	case "FAILED":
+		return output.StyleWarning
+	case "PROCESSING", "RETRYING", "SCHEDULED":
+		return output.StylePending
+	case "UNPUBLISHED":
+		return output.StyleSuggestion
+	default:
+		return output.StyleSuccess
+	}
+}
+
+// batchReportFailedChangesets prints the code host error of each failed
+// changeset, and returns an error if there are any.
+func batchReportFailedChangesets(out *output.Output, failed []*graphql.Changeset) error {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	shown := make([]batchChangeset, len(failed))
+	for i, c := range failed {
+		shown[i] = newBatchChangeset(c)
+		if shown[i].Repository == "" {
+			shown[i].Repository = shown[i].ID
+		}
+	}
+	sort.Slice(shown, func(i, j int) bool { return shown[i].Repository < shown[j].Repository })
+
+	block := out.Block(output.Linef(output.EmojiFailure, output.StyleWarning, "%d changesets failed to be published:", len(failed)))
+	for _, c := range shown {
+		block.Writef("%s: %s", c.Repository, c.Error)
+	}
+	block.Close()
+
+	return errors.Errorf("%d changesets failed to be published", len(failed))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"github.com/sourcegraph/src-cli/internal/output"
+)
+
+func TestBatchChangesetPending(t *testing.T) {
+	for state, want := range map[string]bool{
+		"PROCESSING":  true,
+		"RETRYING":    true,
+		"SCHEDULED":   true,
+		"UNPUBLISHED": false,
+		"FAILED":      false,
+		"OPEN":        false,
+		"DRAFT":       false,
+		"MERGED":      false,
+		"CLOSED":      false,
+		"DELETED":     false,
+		"READONLY":    false,
+	} {
+		if have := batchChangesetPending(state); have != want {
+			t.Errorf("wrong result for %s: have=%v want=%v", state, have, want)
+		}
+	}
+}
+
+func TestBatchWaitForChangesets(t *testing.T) {
+	old := batchWaitInterval
+	batchWaitInterval = time.Millisecond
+	t.Cleanup(func() { batchWaitInterval = old })
+
+	// The server returns the states of the changesets in the next poll each
+	// time it's asked for them, and then stays at the last poll.
+	newServer := func(t *testing.T, polls [][2]string) *batches.Service {
+		var (
+			mu   sync.Mutex
+			poll int
+		)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct{ Query string }
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if strings.Contains(req.Query, "productVersion") {
+				fmt.Fprint(w, `{"data":{"site":{"productVersion":"3.30.0"}}}`)
+				return
+			}
+
+			mu.Lock()
+			states := polls[poll]
+			if poll < len(polls)-1 {
+				poll++
+			}
+			mu.Unlock()
+
+			nodes := []map[string]interface{}{}
+			for i, state := range states {
+				node := map[string]interface{}{
+					"id":         fmt.Sprintf("C%d", i),
+					"state":      state,
+					"repository": map[string]string{"name": fmt.Sprintf("github.com/sourcegraph/repo%d", i)},
+				}
+				if state == "FAILED" {
+					node["error"] = "permission denied"
+				}
+				nodes = append(nodes, node)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"node": map[string]interface{}{
+						"changesets": map[string]interface{}{
+							"nodes":    nodes,
+							"pageInfo": map[string]interface{}{"hasNextPage": false},
+						},
+					},
+				},
+			})
+		}))
+		t.Cleanup(ts.Close)
+
+		svc := batches.NewService(&batches.ServiceOpts{
+			Client: api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: &bytes.Buffer{}}),
+		})
+		if err := svc.DetermineFeatureFlags(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return svc
+	}
+
+	batchChange := &graphql.BatchChange{ID: "BC1", Name: "hello"}
+
+	t.Run("published", func(t *testing.T) {
+		svc := newServer(t, [][2]string{
+			{"PROCESSING", "PROCESSING"},
+			{"OPEN", "PROCESSING"},
+			{"OPEN", "DRAFT"},
+		})
+		var buf bytes.Buffer
+		out := output.NewOutput(&buf, output.OutputOpts{})
+		if err := batchWaitForChangesets(context.Background(), out, svc, batchChange, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"repo0: PROCESSING → OPEN", "repo1: PROCESSING → DRAFT"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("transition %q not shown in output:\n%s", want, buf.String())
+			}
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		svc := newServer(t, [][2]string{
+			{"PROCESSING", "OPEN"},
+			{"FAILED", "OPEN"},
+		})
+		var buf bytes.Buffer
+		out := output.NewOutput(&buf, output.OutputOpts{})
+		err := batchWaitForChangesets(context.Background(), out, svc, batchChange, time.Minute)
+		if err == nil {
+			t.Fatal("unexpected nil error")
+		}
+		if want := "github.com/sourcegraph/repo0: permission denied"; !strings.Contains(buf.String(), want) {
+			t.Errorf("code host error not shown in output:\n%s", buf.String())
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		svc := newServer(t, [][2]string{{"PROCESSING", "OPEN"}})
+		out := output.NewOutput(&bytes.Buffer{}, output.OutputOpts{})
+		err := batchWaitForChangesets(context.Background(), out, svc, batchChange, 50*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
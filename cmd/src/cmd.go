@@ -7,6 +7,8 @@ import (
 	"log"
 	"os"
 	"strings"
+
+	"github.com/sourcegraph/src-cli/internal/api"
 )
 
 // command is a subcommand handler and its flag set.
@@ -23,6 +25,22 @@ type command struct {
 	// flagSet.Usage function to invoke on e.g. -h flag. If nil, a default one
 	// one is used.
 	usageFunc func()
+
+	// hidden commands are not offered for shell completion.
+	hidden bool
+
+	// pluginOverridable commands are placeholders, such as the suggestions
+	// for moved commands, that a plugin of the same name takes over. Plugins
+	// never replace any other built-in command.
+	pluginOverridable bool
+
+	// subcommands of the command, if its handler runs a nested commander.
+	// This is only used for shell completion.
+	subcommands *commander
+
+	// completions maps flag names to functions that complete their values
+	// in the shell. The empty name completes the positional arguments.
+	completions map[string]completer
 }
 
 // matches tells if the given name matches this command or one of its aliases.
@@ -70,45 +88,84 @@ func (c commander) run(flagSet *flag.FlagSet, cmdName, usageText string, args []
 		}
 	}
 
-	// Find the subcommand to execute.
+	// Find the subcommand to execute. Unknown subcommands, and placeholders
+	// such as the suggestions for moved commands, can be provided by plugins.
 	name := flagSet.Arg(0)
-	for _, cmd := range c {
-		if !cmd.matches(name) {
-			continue
+	cmd := c.lookup(name)
+	isPlugin := false
+	if c.allowsPlugin(name) {
+		if path, ok := lookupPlugin(cmdName, name); ok {
+			cmd = &command{
+				flagSet: flag.NewFlagSet(name, flag.ExitOnError),
+				handler: func(args []string) error { return runPlugin(path, args) },
+			}
+			isPlugin = true
 		}
+	}
+	if cmd == nil {
+		log.Printf("%s: unknown subcommand %q", cmdName, name)
+		log.Fatalf("Run '%s help' for usage.", cmdName)
+	}
 
-		// Read global configuration now.
-		var err error
-		cfg, err = readConfig()
-		if err != nil {
-			log.Fatal("reading config: ", err)
-		}
+	// Read global configuration now.
+	var err error
+	cfg, err = readConfig()
+	if err != nil {
+		log.Fatal("reading config: ", err)
+	}
+	if err := checkOutputFormat(*outputFormatFlag); err != nil {
+		log.Fatal(err)
+	}
 
-		// Parse subcommand flags.
-		args := flagSet.Args()[1:]
-		if err := cmd.flagSet.Parse(args); err != nil {
+	// Parse subcommand flags. Plugins parse their flags themselves.
+	if !isPlugin {
+		if err := cmd.flagSet.Parse(flagSet.Args()[1:]); err != nil {
 			panic(fmt.Sprintf("all registered commands should use flag.ExitOnError: error: %s", err))
 		}
+	}
 
-		// Execute the subcommand.
-		if err := cmd.handler(flagSet.Args()[1:]); err != nil {
-			if _, ok := err.(*usageError); ok {
-				log.Printf("error: %s\n\n", err)
-				cmd.flagSet.Usage()
-				os.Exit(2)
-			}
-			if e, ok := err.(*exitCodeError); ok {
-				if e.error != nil {
-					log.Println(e.error)
-				}
-				os.Exit(e.exitCode)
+	// Execute the subcommand. HTTP interactions recorded with SRC_RECORD are
+	// written once it is done, whether it succeeded or not.
+	err = cmd.handler(flagSet.Args()[1:])
+	if closeErr := api.CloseCassettes(); closeErr != nil {
+		log.Println(closeErr)
+	}
+	if err != nil {
+		if _, ok := err.(*usageError); ok {
+			log.Printf("error: %s\n\n", err)
+			cmd.flagSet.Usage()
+			os.Exit(2)
+		}
+		if e, ok := err.(*exitCodeError); ok {
+			if e.error != nil {
+				log.Println(e.error)
 			}
-			log.Fatal(err)
+			os.Exit(e.exitCode)
 		}
-		os.Exit(0)
+		log.Fatal(err)
+	}
+	if err := flushRecords(os.Stdout); err != nil {
+		log.Fatal(err)
 	}
-	log.Printf("%s: unknown subcommand %q", cmdName, name)
-	log.Fatalf("Run '%s help' for usage.", cmdName)
+	os.Exit(0)
+}
+
+// lookup returns the command with the given name or alias, or nil.
+func (c commander) lookup(name string) *command {
+	for _, cmd := range c {
+		if cmd.matches(name) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// allowsPlugin tells if a plugin may provide the subcommand name, which is
+// only the case if there is no built-in command with that name other than a
+// placeholder.
+func (c commander) allowsPlugin(name string) bool {
+	cmd := c.lookup(name)
+	return cmd == nil || cmd.pluginOverridable
 }
 
 // usageError is an error type that subcommands can return in order to signal
@@ -142,8 +199,10 @@ func didYouMeanOtherCommand(actual string, suggested []string) *command {
 	}
 	msg := fmt.Sprintf("src: unknown subcommand %q\n\nDid you mean:\n\n\t%s", actual, strings.Join(fullSuggestions, "\n\t"))
 	return &command{
-		flagSet:   flag.NewFlagSet(actual, flag.ExitOnError),
-		handler:   func(args []string) error { return errors.New(msg) },
-		usageFunc: func() { log.Println(msg) },
+		flagSet:           flag.NewFlagSet(actual, flag.ExitOnError),
+		hidden:            true,
+		pluginOverridable: true,
+		handler:           func(args []string) error { return errors.New(msg) },
+		usageFunc:         func() { log.Println(msg) },
 	}
 }
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	usage := `'src completion' prints a script that enables shell completion for src.
+
+Usage:
+
+    src completion bash|zsh|fish
+
+Besides commands and flags, repository names, usernames, organization names and
+batch spec files are completed. Repository, user and organization names are
+fetched from the configured Sourcegraph instance.
+
+Examples:
+
+  Enable completion in the current bash session:
+
+    $ source <(src completion bash)
+
+  Enable completion for zsh, in a directory listed in $fpath:
+
+    $ src completion zsh > "${fpath[1]}/_src"
+
+  Enable completion for fish:
+
+    $ src completion fish > ~/.config/fish/completions/src.fish
+`
+
+	flagSet := flag.NewFlagSet("completion", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+	}
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+		if flagSet.NArg() != 1 {
+			return &usageError{errors.New("expected exactly one argument: the shell")}
+		}
+
+		script, ok := completionScripts[flagSet.Arg(0)]
+		if !ok {
+			return &usageError{errors.Errorf("unsupported shell %q", flagSet.Arg(0))}
+		}
+		name := filepath.Base(os.Args[0])
+		fmt.Print(strings.NewReplacer("{{name}}", name, "{{func}}", strings.ReplaceAll(name, "-", "_")).Replace(script))
+		return nil
+	}
+
+	commands = append(commands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+
+	// __complete is called by the completion scripts with the words of the
+	// command line, and prints the candidates for the last word one per line.
+	// The words are preceded by "--", so that they aren't parsed as flags.
+	completeFlagSet := flag.NewFlagSet("__complete", flag.ExitOnError)
+	commands = append(commands, &command{
+		flagSet: completeFlagSet,
+		hidden:  true,
+		handler: func(args []string) error {
+			if len(args) > 0 && args[0] == "--" {
+				args = args[1:]
+			}
+			for _, candidate := range complete(args) {
+				fmt.Println(candidate)
+			}
+			return nil
+		},
+	})
+}
+
+// completer returns the completion candidates for a flag value or argument
+// that starts with prefix.
+type completer func(ctx context.Context, prefix string) ([]string, error)
+
+// complete returns the completion candidates for the last of the given
+// command line words, which may be empty.
+func complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+
+	var (
+		subcommands = &commands
+		cmd         *command
+		flagSet     = flag.CommandLine
+		cmdName     = "src"
+		globalFlags bool
+	)
+	prev, cur := words[:len(words)-1], words[len(words)-1]
+	for i := 0; i < len(prev); i++ {
+		word := prev[i]
+		if strings.HasPrefix(word, "-") {
+			name, value, hasValue := splitFlag(word)
+			f := flagSet.Lookup(name)
+			if f == nil || isBoolFlag(f) || hasValue {
+				if f != nil && hasValue && cmd == nil {
+					_ = flag.CommandLine.Set(name, value)
+					globalFlags = true
+				}
+				continue
+			}
+			// The flag value is the next word, unless that is the one being
+			// completed.
+			if i+1 == len(prev) {
+				return completeValue(cmd, name, cur, "")
+			}
+			i++
+			if cmd == nil {
+				_ = flag.CommandLine.Set(name, prev[i])
+				globalFlags = true
+			}
+			continue
+		}
+
+		if subcommands == nil {
+			continue
+		}
+		next := subcommands.lookup(word)
+		if next == nil {
+			return nil
+		}
+		cmd, flagSet, subcommands = next, next.flagSet, next.subcommands
+		cmdName += " " + word
+	}
+
+	// Global flags such as -profile change the instance that names are
+	// completed from.
+	if globalFlags {
+		var err error
+		if cfg, err = readConfig(); err != nil {
+			return nil
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(cur, "-") && strings.Contains(cur, "="):
+		name, value, _ := splitFlag(cur)
+		return completeValue(cmd, name, value, "-"+name+"=")
+
+	case strings.HasPrefix(cur, "-"):
+		var candidates []string
+		flagSet.VisitAll(func(f *flag.Flag) {
+			if f.Usage != "" && strings.HasPrefix("-"+f.Name, cur) {
+				candidates = append(candidates, "-"+f.Name)
+			}
+		})
+		return candidates
+
+	case subcommands != nil:
+		var candidates []string
+		for _, c := range *subcommands {
+			if name := c.flagSet.Name(); !c.hidden && strings.HasPrefix(name, cur) {
+				candidates = append(candidates, name)
+			}
+		}
+		prefix := pluginName(cmdName, "")
+		for _, p := range discoverPlugins(os.Getenv("PATH")) {
+			name := strings.TrimPrefix(p.Name, prefix)
+			if !p.Shadowed && strings.HasPrefix(p.Name, prefix) && strings.HasPrefix(name, cur) && subcommands.allowsPlugin(name) {
+				candidates = append(candidates, name)
+			}
+		}
+		sort.Strings(candidates)
+		return candidates
+
+	default:
+		return completeValue(cmd, "", cur, "")
+	}
+}
+
+// globalCompletions complete the values of the global flags.
+var globalCompletions = map[string]completer{
+	"o": func(ctx context.Context, prefix string) ([]string, error) {
+		return outputFormatNames(), nil
+	},
+	"profile": func(ctx context.Context, prefix string) ([]string, error) {
+		return cfg.profileNames(), nil
+	},
+}
+
+// completeValue completes the value of the named flag of cmd, or its
+// positional arguments if name is empty. The candidates are prefixed with
+// prefix. If cmd is nil, the value of a global flag is completed.
+func completeValue(cmd *command, name, value, prefix string) []string {
+	completions := globalCompletions
+	if cmd != nil {
+		completions = cmd.completions
+	}
+	if completions[name] == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Errors are ignored, since there is no good way to report them while
+	// completing.
+	values, _ := completions[name](ctx, value)
+	candidates := make([]string, 0, len(values))
+	for _, v := range values {
+		if strings.HasPrefix(v, value) {
+			candidates = append(candidates, prefix+v)
+		}
+	}
+	return candidates
+}
+
+func splitFlag(word string) (name, value string, hasValue bool) {
+	name = strings.TrimLeft(word, "-")
+	if i := strings.Index(name, "="); i >= 0 {
+		return name[:i], name[i+1:], true
+	}
+	return name, "", false
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// completionLimit is the maximum number of names fetched from the Sourcegraph
+// instance for a completion.
+const completionLimit = 50
+
+func completeRepositoryNames(ctx context.Context, prefix string) ([]string, error) {
+	var result struct {
+		Repositories struct {
+			Nodes []struct{ Name string }
+		}
+	}
+	query := `query CompleteRepositories($first: Int, $query: String) {
+  repositories(first: $first, query: $query) {
+    nodes {
+      name
+    }
+  }
+}`
+	if ok, err := cfg.apiClient(nil, ioutil.Discard).NewRequest(query, map[string]interface{}{
+		"first": completionLimit,
+		"query": prefix,
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(result.Repositories.Nodes))
+	for _, node := range result.Repositories.Nodes {
+		names = append(names, node.Name)
+	}
+	return names, nil
+}
+
+func completeUsernames(ctx context.Context, prefix string) ([]string, error) {
+	var result struct {
+		Users struct {
+			Nodes []struct{ Username string }
+		}
+	}
+	query := `query CompleteUsers($first: Int, $query: String) {
+  users(first: $first, query: $query) {
+    nodes {
+      username
+    }
+  }
+}`
+	if ok, err := cfg.apiClient(nil, ioutil.Discard).NewRequest(query, map[string]interface{}{
+		"first": completionLimit,
+		"query": prefix,
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(result.Users.Nodes))
+	for _, node := range result.Users.Nodes {
+		names = append(names, node.Username)
+	}
+	return names, nil
+}
+
+func completeOrgNames(ctx context.Context, prefix string) ([]string, error) {
+	var result struct {
+		Organizations struct {
+			Nodes []struct{ Name string }
+		}
+	}
+	query := `query CompleteOrganizations($first: Int, $query: String) {
+  organizations(first: $first, query: $query) {
+    nodes {
+      name
+    }
+  }
+}`
+	if ok, err := cfg.apiClient(nil, ioutil.Discard).NewRequest(query, map[string]interface{}{
+		"first": completionLimit,
+		"query": prefix,
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(result.Organizations.Nodes))
+	for _, node := range result.Organizations.Nodes {
+		names = append(names, node.Name)
+	}
+	return names, nil
+}
+
+// completeBatchSpecFiles completes YAML files and directories, since batch
+// specs are usually stored in YAML.
+func completeBatchSpecFiles(ctx context.Context, prefix string) ([]string, error) {
+	matches, err := filepath.Glob(prefix + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		switch {
+		case info.IsDir():
+			files = append(files, match+string(filepath.Separator))
+		case strings.HasSuffix(match, ".yaml") || strings.HasSuffix(match, ".yml"):
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for {{name}}
+
+_{{func}}_complete() {
+	local line="${COMP_LINE:0:COMP_POINT}"
+	local -a words
+	read -r -a words <<< "$line"
+	if [[ -z $line || $line == *" " ]]; then
+		words+=("")
+	fi
+
+	local IFS=$'\n'
+	local -a candidates
+	candidates=($({{name}} __complete -- "${words[@]:1}" 2>/dev/null))
+
+	# bash treats "=" as a word break, so only the flag value is replaced.
+	if [[ ${words[${#words[@]}-1]} == -*=* ]]; then
+		candidates=("${candidates[@]#*=}")
+	fi
+
+	COMPREPLY=("${candidates[@]}")
+	if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+		compopt -o nospace
+	fi
+}
+
+complete -F _{{func}}_complete {{name}}
+`,
+
+	"zsh": `#compdef {{name}}
+
+_{{func}}_complete() {
+	local -a candidates dirs
+	candidates=("${(@f)$({{name}} __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	candidates=(${candidates:#})
+
+	# Don't add a space after directories, so that their contents can be
+	# completed next.
+	dirs=(${(M)candidates:#*/})
+	candidates=(${candidates:#*/})
+	compadd -S '' -a dirs
+	compadd -a candidates
+}
+
+compdef _{{func}}_complete {{name}}
+`,
+
+	"fish": `# fish completion for {{name}}
+
+function __{{func}}_complete
+	set -l words (commandline -opc)
+	set -e words[1]
+	{{name}} __complete -- $words (commandline -ct) 2>/dev/null
+end
+
+complete -c {{name}} -f -a '(__{{func}}_complete)'
+`,
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestComplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "src-complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for _, name := range []string{"batch.yaml", "other.yml", "notes.txt", "specs/a.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldCfg := cfg
+	cfg = &config{Profiles: map[string]*profile{"prod": {}, "staging": {}}}
+	t.Cleanup(func() { cfg = oldCfg })
+
+	reposGet := reposCommands.lookup("get")
+	oldCompletions := reposGet.completions
+	reposGet.completions = map[string]completer{
+		"name": func(ctx context.Context, prefix string) ([]string, error) {
+			return []string{"github.com/sourcegraph/sourcegraph", "github.com/sourcegraph/src-cli", "gitlab.com/foo/bar"}, nil
+		},
+	}
+	t.Cleanup(func() { reposGet.completions = oldCompletions })
+
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{
+			words: []string{"ver"},
+			want:  []string{"version"},
+		},
+		{
+			words: []string{"__com"},
+			want:  nil,
+		},
+		{
+			words: []string{"repos", ""},
+			want:  []string{"delete", "disable", "enable", "get", "list"},
+		},
+		{
+			words: []string{"repo", "l"},
+			want:  []string{"list"},
+		},
+		{
+			words: []string{"-v", "orgs", "members", ""},
+			want:  []string{"add", "remove"},
+		},
+		{
+			words: []string{"-pro"},
+			want:  []string{"-profile"},
+		},
+		{
+			words: []string{"-profile", ""},
+			want:  []string{"prod", "staging"},
+		},
+		{
+			words: []string{"-o=n"},
+			want:  []string{"-o=ndjson"},
+		},
+		{
+			words: []string{"repos", "get", "-na"},
+			want:  []string{"-name"},
+		},
+		{
+			words: []string{"repos", "get", "-name", "github.com/sourcegraph/s"},
+			want:  []string{"github.com/sourcegraph/sourcegraph", "github.com/sourcegraph/src-cli"},
+		},
+		{
+			words: []string{"repos", "get", "-name=git"},
+			want:  []string{"-name=github.com/sourcegraph/sourcegraph", "-name=github.com/sourcegraph/src-cli", "-name=gitlab.com/foo/bar"},
+		},
+		{
+			words: []string{"batch", "apply", "-f", dir + "/"},
+			want:  []string{filepath.Join(dir, "batch.yaml"), filepath.Join(dir, "other.yml"), filepath.Join(dir, "specs") + "/"},
+		},
+		{
+			words: []string{"batch", "validate", "-f=" + dir + "/s"},
+			want:  []string{"-f=" + filepath.Join(dir, "specs") + "/"},
+		},
+		{
+			words: []string{"unknown", ""},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, complete(tt.words)); diff != "" {
+			t.Errorf("wrong candidates for %q (-want +got):\n%s", tt.words, diff)
+		}
+	}
+}
@@ -29,9 +29,11 @@ Usage:
 
 The commands are:
 
-	get       gets the effective (merged) settings
-	edit      updates settings
-	list      lists the partial settings (that, when merged, yield the effective settings)
+	get           gets the effective (merged) settings
+	edit          updates settings
+	list          lists the partial settings (that, when merged, yield the effective settings)
+	profiles      manages the named configuration profiles of src itself
+	use-profile   selects the configuration profile to use
 
 Use "src config [command] -h" for more information about a command.
 `
@@ -44,8 +46,9 @@ Use "src config [command] -h" for more information about a command.
 
 	// Register the command.
 	commands = append(commands, &command{
-		flagSet: flagSet,
-		handler: handler,
+		flagSet:     flagSet,
+		handler:     handler,
+		subcommands: &configCommands,
 		usageFunc: func() {
 			fmt.Println(usage)
 		},
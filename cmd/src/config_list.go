@@ -55,6 +55,7 @@ Examples:
 		if err != nil {
 			return err
 		}
+		expectRecords()
 
 		var query string
 		var queryVars map[string]interface{}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var configProfilesCommands commander
+
+func init() {
+	usage := `'src config profiles' manages the named configuration profiles stored in the src config file.
+
+Profiles allow switching between multiple Sourcegraph instances. Each profile
+defines an endpoint, an access token, additional HTTP headers and TLS settings:
+
+	{
+	  "currentProfile": "staging",
+	  "profiles": {
+	    "staging": {
+	      "endpoint": "https://sourcegraph.staging.example.com",
+	      "accessToken": "...",
+	      "additionalHeaders": {"X-Foo": "bar"},
+	      "insecureSkipVerify": false
+	    }
+	  }
+	}
+
+The profile to use is selected with the global -profile flag, the SRC_PROFILE
+environment variable or the "currentProfile" setting, in that order.
+
+Usage:
+
+	src config profiles command [command options]
+
+The commands are:
+
+	list      lists the configured profiles
+
+Use "src config profiles [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("profiles", flag.ExitOnError)
+	handler := func(args []string) error {
+		configProfilesCommands.run(flagSet, "src config profiles", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	configCommands = append(configCommands, &command{
+		flagSet:     flagSet,
+		aliases:     []string{"profile"},
+		handler:     handler,
+		subcommands: &configProfilesCommands,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  List the configured profiles. The profile currently in use is marked with an asterisk:
+
+    	$ src config profiles list
+
+  List the names of all profiles:
+
+    	$ src config profiles list -f '{{.Name}}'
+
+`
+
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src config profiles %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		formatFlag = flagSet.String("f", "{{if .Current}}*{{else}} {{end}} {{.Name}}\t{{.Endpoint}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.Name}}: {{.Endpoint}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+		expectRecords()
+
+		for _, name := range cfg.profileNames() {
+			p := cfg.Profiles[name]
+			if err := execTemplate(tmpl, struct {
+				Name               string
+				Endpoint           string
+				InsecureSkipVerify bool
+				Current            bool
+			}{
+				Name:               name,
+				Endpoint:           p.Endpoint,
+				InsecureSkipVerify: p.InsecureSkipVerify,
+				Current:            name == cfg.Profile,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	configProfilesCommands = append(configProfilesCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
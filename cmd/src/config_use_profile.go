@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  Use the profile named prod for all subsequent commands:
+
+    	$ src config use-profile prod
+
+  Stop using a profile, and fall back to SRC_ENDPOINT and SRC_ACCESS_TOKEN:
+
+    	$ src config use-profile -unset
+
+`
+
+	flagSet := flag.NewFlagSet("use-profile", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src config %s [profile]':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		unsetFlag = flagSet.Bool("unset", false, "Unset the current profile.")
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		var name string
+		if *unsetFlag {
+			if flagSet.NArg() != 0 {
+				return &usageError{errors.New("no profile name may be given with -unset")}
+			}
+		} else {
+			if flagSet.NArg() != 1 {
+				return &usageError{errors.New("expected exactly one argument: the name of the profile")}
+			}
+			name = flagSet.Arg(0)
+			if _, ok := cfg.Profiles[name]; !ok {
+				return fmt.Errorf("profile %q is not defined, available profiles are: %s", name, strings.Join(cfg.profileNames(), ", "))
+			}
+		}
+
+		path, err := editConfigFile(func(raw map[string]interface{}) error {
+			if name == "" {
+				delete(raw, "currentProfile")
+			} else {
+				raw["currentProfile"] = name
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if name == "" {
+			fmt.Fprintf(proseOutput(), "Unset the current profile in %s.\n", path)
+		} else {
+			fmt.Fprintf(proseOutput(), "Now using profile %q (%s).\n", name, cfg.Profiles[name].Endpoint)
+		}
+		return nil
+	}
+
+	// Register the command.
+	configCommands = append(configCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
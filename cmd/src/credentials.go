@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/sourcegraph/src-cli/internal/credentials"
+)
+
+// credentialStore returns the credential store configured with
+// CredentialHelper, or nil if none is configured.
+func (c *config) credentialStore() (credentials.Store, error) {
+	if c.CredentialHelper == "" {
+		return nil, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.New(c.CredentialHelper, credentials.Opts{
+		Dir:        filepath.Join(dir, "src"),
+		Passphrase: os.Getenv("SRC_CREDENTIALS_PASSPHRASE"),
+	})
+}
+
+// accessToken returns the access token for the configured endpoint. Unless an
+// access token is set explicitly in the config file or the environment, it is
+// read from the credential store. An empty token is returned if none is
+// found.
+func (c *config) accessToken(ctx context.Context) (string, error) {
+	if c.AccessToken != "" {
+		return c.AccessToken, nil
+	}
+
+	store, err := c.credentialStore()
+	if err != nil || store == nil {
+		return "", err
+	}
+
+	token, err := store.Get(ctx, c.Endpoint)
+	if err == credentials.ErrNotFound {
+		return "", nil
+	}
+	return token, err
+}
@@ -0,0 +1,55 @@
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConfigAccessToken(t *testing.T) {
+	ctx := context.Background()
+
+	// A stand-in credential helper that only knows about one endpoint.
+	helper := `!f() { cat > /dev/null; echo password=helpertoken; }; f`
+
+	t.Run("explicit token takes precedence", func(t *testing.T) {
+		cfg := &config{Endpoint: "https://example.com", AccessToken: "abc", CredentialHelper: helper}
+		if token, err := cfg.accessToken(ctx); err != nil {
+			t.Fatal(err)
+		} else if token != "abc" {
+			t.Errorf("wrong token: have=%q want=%q", token, "abc")
+		}
+	})
+
+	t.Run("no helper", func(t *testing.T) {
+		cfg := &config{Endpoint: "https://example.com"}
+		if token, err := cfg.accessToken(ctx); err != nil {
+			t.Fatal(err)
+		} else if token != "" {
+			t.Errorf("unexpected token: %q", token)
+		}
+	})
+
+	t.Run("helper is used at request time", func(t *testing.T) {
+		var authorization string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			fmt.Fprintln(w, `{"data":{"currentUser":{"username":"alice"}}}`)
+		}))
+		defer s.Close()
+
+		cfg := &config{Endpoint: s.URL, CredentialHelper: helper}
+		client := cfg.apiClient(nil, ioutil.Discard)
+		if _, err := client.NewQuery(`query { currentUser { username } }`).Do(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		if want := "token helpertoken"; authorization != want {
+			t.Errorf("wrong authorization header: have=%q want=%q", authorization, want)
+		}
+	})
+}
@@ -150,10 +150,10 @@ Copy an extension from Sourcegraph.com to your private registry.
 			return err
 		}
 
-		fmt.Println("Extension published!")
+		fmt.Fprintln(proseOutput(), "Extension published!")
 		fmt.Println()
-		fmt.Printf("\tExtension ID: %s\n\n", publishResult.ExtensionRegistry.PublishExtension.Extension.ExtensionID)
-		fmt.Printf("View, enable, and configure it at: %s\n", cfg.Endpoint+publishResult.ExtensionRegistry.PublishExtension.Extension.URL)
+		fmt.Fprintf(proseOutput(), "\tExtension ID: %s\n\n", publishResult.ExtensionRegistry.PublishExtension.Extension.ExtensionID)
+		fmt.Fprintf(proseOutput(), "View, enable, and configure it at: %s\n", cfg.Endpoint+publishResult.ExtensionRegistry.PublishExtension.Extension.URL)
 		return nil
 	}
 
@@ -64,7 +64,7 @@ Examples:
 			return err
 		}
 
-		fmt.Printf("Extension with ID %q deleted.\n", *extensionIDFlag)
+		fmt.Fprintf(proseOutput(), "Extension with ID %q deleted.\n", *extensionIDFlag)
 		return nil
 	}
 
@@ -48,6 +48,7 @@ Examples:
 		if err != nil {
 			return err
 		}
+		expectRecords()
 
 		client := cfg.apiClient(apiFlags, flagSet.Output())
 
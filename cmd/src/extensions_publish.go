@@ -170,10 +170,10 @@ Notes:
 			return err
 		}
 
-		fmt.Println("Extension published!")
+		fmt.Fprintln(proseOutput(), "Extension published!")
 		fmt.Println()
-		fmt.Printf("\tExtension ID: %s\n\n", result.ExtensionRegistry.PublishExtension.Extension.ExtensionID)
-		fmt.Printf("View, enable, and configure it at: %s\n", cfg.Endpoint+result.ExtensionRegistry.PublishExtension.Extension.URL)
+		fmt.Fprintf(proseOutput(), "\tExtension ID: %s\n\n", result.ExtensionRegistry.PublishExtension.Extension.ExtensionID)
+		fmt.Fprintf(proseOutput(), "View, enable, and configure it at: %s\n", cfg.Endpoint+result.ExtensionRegistry.PublishExtension.Extension.URL)
 		return nil
 	}
 
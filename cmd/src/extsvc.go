@@ -34,9 +34,10 @@ Use "src extsvc [command] -h" for more information about a command.
 
 	// Register the command.
 	commands = append(commands, &command{
-		flagSet: flagSet,
-		aliases: []string{"extsvc", "external-service"},
-		handler: handler,
+		flagSet:     flagSet,
+		aliases:     []string{"extsvc", "external-service"},
+		handler:     handler,
+		subcommands: &extsvcCommands,
 		usageFunc: func() {
 			fmt.Println(usage)
 		},
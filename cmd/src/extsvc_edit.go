@@ -122,7 +122,7 @@ Examples:
 			}
 			return err
 		} else if ok {
-			fmt.Println("External service updated:", id)
+			fmt.Fprintln(proseOutput(), "External service updated:", id)
 		}
 		return nil
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 
@@ -39,11 +40,6 @@ Examples:
 			return err
 		}
 
-		first := *firstFlag
-		if first == -1 {
-			first = 9999999 // GraphQL API doesn't support negative for unlimited query
-		}
-
 		var formatStr string
 		if *formatFlag != "" {
 			formatStr = *formatFlag
@@ -55,15 +51,32 @@ Examples:
 		if err != nil {
 			return err
 		}
+		expectRecords()
 
 		ctx := context.Background()
 		client := cfg.apiClient(apiFlags, flagSet.Output())
 
-		queryVars := map[string]interface{}{
-			"first": first,
-		}
+		// The template is executed once for all external services, so they
+		// are collected from all pages first.
 		var result externalServicesListResult
-		if ok, err := client.NewRequest(externalServicesListQuery, queryVars).Do(ctx, &result); err != nil || !ok {
+		if err := api.Paginate(ctx, client, api.PaginateOpts{
+			Query: externalServicesListQuery,
+			Path:  []string{"externalServices"},
+			Limit: *firstFlag,
+			OnPage: func(connection json.RawMessage) error {
+				nodes := result.ExternalServices.Nodes
+				err := json.Unmarshal(connection, &result.ExternalServices)
+				result.ExternalServices.Nodes = nodes
+				return err
+			},
+		}, func(node json.RawMessage) error {
+			var externalService map[string]interface{}
+			if err := json.Unmarshal(node, &externalService); err != nil {
+				return err
+			}
+			result.ExternalServices.Nodes = append(result.ExternalServices.Nodes, externalService)
+			return nil
+		}); err != nil {
 			return err
 		}
 		return execTemplate(tmpl, result.ExternalServices)
@@ -78,8 +91,8 @@ Examples:
 }
 
 const externalServicesListQuery = `
-	query ($first: Int!) {
-		externalServices(first: $first) {
+	query ($first: Int!, $after: String) {
+		externalServices(first: $first, after: $after) {
 			nodes {
 				id
 				kind
@@ -90,6 +103,7 @@ const externalServicesListQuery = `
 			}
 			totalCount
 			pageInfo {
+				endCursor
 				hasNextPage
 			}
 		}
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
 
 	humanize "github.com/dustin/go-humanize"
+	"github.com/mattn/go-runewidth"
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/jsonx"
+	"github.com/sourcegraph/src-cli/internal/output"
+	"gopkg.in/yaml.v3"
 )
 
 func parseTemplate(text string) (*template.Template, error) {
@@ -83,6 +91,10 @@ func parseTemplate(text string) (*template.Template, error) {
 			}
 			return humanize.Time(t), nil
 		},
+		"humanizeTime": humanize.Time,
+		"humanizeBytes": func(size int64) string {
+			return humanize.Bytes(uint64(size))
+		},
 
 		// Register search-specific template functions
 		"searchSequentialLineNumber":        searchTemplateFuncs["searchSequentialLineNumber"],
@@ -115,6 +127,9 @@ func parseTemplate(text string) (*template.Template, error) {
 }
 
 func execTemplate(tmpl *template.Template, data interface{}) error {
+	if *outputFormatFlag != "" {
+		return emitRecord(data)
+	}
 	if err := tmpl.Execute(os.Stdout, data); err != nil {
 		return err
 	}
@@ -126,3 +141,295 @@ func execTemplate(tmpl *template.Template, data interface{}) error {
 func marshalIndent(v interface{}) ([]byte, error) {
 	return json.MarshalIndent(v, "", "  ")
 }
+
+// outputFormats are the structured output formats that can be selected with
+// the global -o flag instead of the -f templates of the individual commands.
+var outputFormats = map[string]func(w io.Writer, values []interface{}) error{
+	"json":   writeJSONRecords,
+	"ndjson": writeNDJSONRecords,
+	"yaml":   writeYAMLRecords,
+	"csv":    writeCSVRecords,
+	"table":  writeTableRecords,
+}
+
+// outputFormatNames returns the names of all structured output formats,
+// sorted alphabetically.
+func outputFormatNames() []string {
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkOutputFormat(name string) error {
+	if _, ok := outputFormats[name]; name != "" && !ok {
+		return errors.Errorf("unknown output format %q, must be one of: %s", name, strings.Join(outputFormatNames(), ", "))
+	}
+	return nil
+}
+
+// records collects the values that a command emits through execTemplate when
+// a structured output format is selected, so that they can be written all at
+// once when the command is done: this is required for formats such as JSON
+// and tables, which can't be written line by line.
+var records struct {
+	expected bool
+	values   []interface{}
+}
+
+// expectRecords marks the running command as one that produces records, so
+// that with a structured output format an empty list is still written as
+// such, rather than nothing at all.
+func expectRecords() {
+	records.expected = true
+}
+
+// proseOutput returns the writer for human-readable messages of commands
+// that change things, such as confirmations. With a structured output
+// format, stdout is reserved for records, so they go to stderr instead.
+func proseOutput() io.Writer {
+	if *outputFormatFlag != "" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// emitRecord adds v to the records written in the selected structured output
+// format, for commands that don't use execTemplate. Records are written right
+// away with ndjson, so that the output of long lists begins immediately and
+// isn't held in memory.
+func emitRecord(v interface{}) error {
+	if *outputFormatFlag == "ndjson" {
+		return writeNDJSONRecords(os.Stdout, []interface{}{v})
+	}
+	records.values = append(records.values, v)
+	return nil
+}
+
+// flushRecords writes the collected records to w in the selected structured
+// output format. Nothing is written for commands that don't produce records.
+func flushRecords(w io.Writer) error {
+	if *outputFormatFlag == "" || (!records.expected && len(records.values) == 0) {
+		return nil
+	}
+	values := records.values
+	if values == nil {
+		values = []interface{}{}
+	}
+	records.expected, records.values = false, nil
+	return outputFormats[*outputFormatFlag](w, values)
+}
+
+func writeJSONRecords(w io.Writer, values []interface{}) error {
+	data, err := marshalIndent(values)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func writeNDJSONRecords(w io.Writer, values []interface{}) error {
+	enc := json.NewEncoder(w)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeYAMLRecords(w io.Writer, values []interface{}) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	// Decoding the JSON into a node, rather than into maps, preserves the
+	// order of the fields. YAML is a superset of JSON, so the node only needs
+	// to be switched to block style before encoding it again.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	resetYAMLStyle(&doc)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+func writeCSVRecords(w io.Writer, values []interface{}) error {
+	columns, rows, err := tabulateRecords(values)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func writeTableRecords(w io.Writer, values []interface{}) error {
+	columns, rows, err := tabulateRecords(values)
+	if err != nil {
+		return err
+	}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = strings.ToUpper(column)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = strings.Join(strings.Fields(cell), " ")
+		}
+	}
+
+	// Size the columns to fit their widest cell, but shrink the widest columns
+	// if the table doesn't fit into the terminal.
+	widths := make([]int, len(columns))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if width := runewidth.StringWidth(cell); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+	if out := output.NewOutput(w, output.OutputOpts{}); out.IsTTY() {
+		shrinkColumns(widths, out.Width())
+	}
+
+	for _, row := range append([][]string{header}, rows...) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = runewidth.FillRight(runewidth.Truncate(cell, widths[i], "…"), widths[i])
+		}
+		line := strings.TrimRight(strings.Join(cells, tableColumnSeparator), " ")
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	tableColumnSeparator = "  "
+	tableMinColumnWidth  = 8
+)
+
+// shrinkColumns narrows the widest columns until the table fits into the
+// given width, without making any column narrower than tableMinColumnWidth.
+func shrinkColumns(widths []int, available int) {
+	total := len(tableColumnSeparator) * (len(widths) - 1)
+	for _, width := range widths {
+		total += width
+	}
+	for total > available {
+		widest := 0
+		for i, width := range widths {
+			if width > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= tableMinColumnWidth {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+// tabulateRecords turns records into rows of cells for CSV and table output.
+// The columns are the fields of the records' JSON representation in the
+// order they first appear in; nested values are rendered as compact JSON.
+func tabulateRecords(values []interface{}) (columns []string, rows [][]string, err error) {
+	index := map[string]int{}
+	fields := make([]map[string]string, len(values))
+	for i, v := range values {
+		keys, cells, err := recordFields(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, key := range keys {
+			if _, ok := index[key]; !ok {
+				index[key] = len(columns)
+				columns = append(columns, key)
+			}
+		}
+		fields[i] = cells
+	}
+
+	rows = make([][]string, len(fields))
+	for i, cells := range fields {
+		rows[i] = make([]string, len(columns))
+		for j, column := range columns {
+			rows[i][j] = cells[column]
+		}
+	}
+	return columns, rows, nil
+}
+
+// recordFields returns the names of the top-level fields of the JSON
+// representation of v in order, and the cell for each field. Values that
+// aren't JSON objects are returned as a single field named "value".
+func recordFields(v interface{}) ([]string, map[string]string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("{")) {
+		cell, err := recordCell(data)
+		return []string{"value"}, map[string]string{"value": cell}, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	var keys []string
+	cells := map[string]string{}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := token.(string)
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, nil, err
+		}
+		if cells[key], err = recordCell(raw); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, cells, nil
+}
+
+func recordCell(raw json.RawMessage) (string, error) {
+	switch {
+	case bytes.Equal(raw, []byte("null")):
+		return "", nil
+	case bytes.HasPrefix(raw, []byte(`"`)):
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	default:
+		return string(raw), nil
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutputFormats(t *testing.T) {
+	type repo struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Stars       int      `json:"stars"`
+		Topics      []string `json:"topics"`
+		Mirror      *string  `json:"mirror"`
+	}
+	values := []interface{}{
+		repo{Name: "github.com/sourcegraph/sourcegraph", Description: "Code search", Stars: 5000, Topics: []string{"code", "search"}},
+		repo{Name: "github.com/sourcegraph/src-cli", Description: "The \"src\" CLI,\nfor Sourcegraph", Stars: 200},
+	}
+
+	tests := map[string]string{
+		"json": `[
+  {
+    "name": "github.com/sourcegraph/sourcegraph",
+    "description": "Code search",
+    "stars": 5000,
+    "topics": [
+      "code",
+      "search"
+    ],
+    "mirror": null
+  },
+  {
+    "name": "github.com/sourcegraph/src-cli",
+    "description": "The \"src\" CLI,\nfor Sourcegraph",
+    "stars": 200,
+    "topics": null,
+    "mirror": null
+  }
+]
+`,
+		"ndjson": `{"name":"github.com/sourcegraph/sourcegraph","description":"Code search","stars":5000,"topics":["code","search"],"mirror":null}
+{"name":"github.com/sourcegraph/src-cli","description":"The \"src\" CLI,\nfor Sourcegraph","stars":200,"topics":null,"mirror":null}
+`,
+		"yaml": `- name: github.com/sourcegraph/sourcegraph
+  description: Code search
+  stars: 5000
+  topics:
+    - code
+    - search
+  mirror: null
+- name: github.com/sourcegraph/src-cli
+  description: |-
+    The "src" CLI,
+    for Sourcegraph
+  stars: 200
+  topics: null
+  mirror: null
+`,
+		"csv": `name,description,stars,topics,mirror
+github.com/sourcegraph/sourcegraph,Code search,5000,"[""code"",""search""]",
+github.com/sourcegraph/src-cli,"The ""src"" CLI,
+for Sourcegraph",200,,
+`,
+		"table": `NAME                                DESCRIPTION                     STARS  TOPICS             MIRROR
+github.com/sourcegraph/sourcegraph  Code search                     5000   ["code","search"]
+github.com/sourcegraph/src-cli      The "src" CLI, for Sourcegraph  200
+`,
+	}
+
+	for format, want := range tests {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := outputFormats[format](&buf, values); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, buf.String()); diff != "" {
+				t.Errorf("wrong output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFlushRecords(t *testing.T) {
+	format := "json"
+	setOutputFormat(t, &format)
+
+	t.Run("no records", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := flushRecords(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("unexpected output for a command without records: %q", buf.String())
+		}
+	})
+
+	t.Run("parsed template without records", func(t *testing.T) {
+		if _, err := parseTemplate("{{.}}"); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := flushRecords(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("unexpected output for a command without records: %q", buf.String())
+		}
+	})
+
+	t.Run("empty list", func(t *testing.T) {
+		expectRecords()
+
+		var buf bytes.Buffer
+		if err := flushRecords(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := buf.String(), "[]\n"; have != want {
+			t.Errorf("wrong output: have=%q want=%q", have, want)
+		}
+	})
+
+	t.Run("records from templates", func(t *testing.T) {
+		tmpl, err := parseTemplate("{{.}}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{"a", "b"} {
+			if err := execTemplate(tmpl, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := flushRecords(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := buf.String(), "[\n  \"a\",\n  \"b\"\n]\n"; have != want {
+			t.Errorf("wrong output: have=%q want=%q", have, want)
+		}
+	})
+}
+
+func TestCheckOutputFormat(t *testing.T) {
+	for _, format := range []string{"", "json", "ndjson", "yaml", "csv", "table"} {
+		if err := checkOutputFormat(format); err != nil {
+			t.Errorf("unexpected error for %q: %s", format, err)
+		}
+	}
+	if err := checkOutputFormat("xml"); err == nil {
+		t.Error("unexpected nil error for unknown format")
+	}
+}
+
+func TestProseOutput(t *testing.T) {
+	format := ""
+	setOutputFormat(t, &format)
+	if proseOutput() != os.Stdout {
+		t.Error("prose isn't written to stdout without an output format")
+	}
+
+	format = "json"
+	if proseOutput() != os.Stderr {
+		t.Error("prose isn't written to stderr with an output format")
+	}
+}
+
+func setOutputFormat(t *testing.T, format *string) {
+	t.Helper()
+
+	old := outputFormatFlag
+	outputFormatFlag = format
+	records.expected, records.values = false, nil
+	t.Cleanup(func() {
+		outputFormatFlag = old
+		records.expected, records.values = false, nil
+	})
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,6 +10,9 @@ import (
 	"os"
 	"strings"
 
+	"github.com/mattn/go-isatty"
+	"github.com/pkg/browser"
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/src-cli/internal/api"
 )
 
@@ -18,7 +21,13 @@ func init() {
 
 Usage:
 
-    src login SOURCEGRAPH_URL
+    src login [options] SOURCEGRAPH_URL
+
+If no valid access token is configured for the instance and src is run in an
+interactive terminal, the access token creation page of the instance is opened
+in your browser, and you're asked to paste the new access token into the
+terminal. The access token is then verified and stored in a configuration
+profile (see "src config profiles").
 
 Examples:
 
@@ -29,6 +38,10 @@ Examples:
   Authenticate to Sourcegraph.com:
 
     $ src login https://sourcegraph.com
+
+  Authenticate and store the access token in the profile named staging:
+
+    $ src login -profile-name=staging https://sourcegraph.staging.example.com
 `
 
 	flagSet := flag.NewFlagSet("login", flag.ExitOnError)
@@ -38,7 +51,9 @@ Examples:
 	}
 
 	var (
-		apiFlags = api.NewFlags(flagSet)
+		noBrowserFlag   = flagSet.Bool("no-browser", false, "Don't open the browser to create an access token. The URL is printed instead.")
+		profileNameFlag = flagSet.String("profile-name", "", "The name of the profile to store the access token in. (default: the current profile if it uses the same endpoint, otherwise the host name of the endpoint)")
+		apiFlags        = api.NewFlags(flagSet)
 	)
 
 	handler := func(args []string) error {
@@ -53,9 +68,58 @@ Examples:
 			return &usageError{errors.New("expected exactly one argument: the Sourcegraph URL, or SRC_ENDPOINT to be set")}
 		}
 
-		client := cfg.apiClient(apiFlags, ioutil.Discard)
+		ctx := context.Background()
+		endpoint = cleanEndpoint(endpoint)
+
+		// Check the configured access token first, unless we already know that
+		// it can't be used for the requested endpoint.
+		// Errors from the credential store are treated like a missing token here,
+		// and reported by loginCmd if there is no interactive terminal.
+		configuredToken, _ := cfg.accessToken(ctx)
+		if configuredToken != "" && cfg.Endpoint == endpoint {
+			var out bytes.Buffer
+			err := loginCmd(ctx, cfg, cfg.apiClient(apiFlags, ioutil.Discard), endpoint, &out)
+			if err == nil || !isatty.IsTerminal(os.Stdin.Fd()) {
+				_, _ = io.Copy(os.Stdout, &out)
+				return err
+			}
+		} else if !isatty.IsTerminal(os.Stdin.Fd()) {
+			return loginCmd(ctx, cfg, cfg.apiClient(apiFlags, ioutil.Discard), endpoint, os.Stdout)
+		}
+
+		opts := browserLoginOpts{endpoint: endpoint, in: os.Stdin, out: os.Stdout}
+		if !*noBrowserFlag {
+			opts.openURL = browser.OpenURL
+		}
+		token, err := browserLogin(opts)
+		if err != nil {
+			return err
+		}
 
-		return loginCmd(context.Background(), cfg, client, endpoint, os.Stdout)
+		// Verify the new token before storing it.
+		loginCfg := *cfg
+		loginCfg.Endpoint = endpoint
+		loginCfg.AccessToken = token
+		loginCfg.ConfigFilePath = ""
+		if err := loginCmd(ctx, &loginCfg, loginCfg.apiClient(apiFlags, ioutil.Discard), endpoint, os.Stdout); err != nil {
+			return err
+		}
+
+		name := loginProfileName(cfg, *profileNameFlag, endpoint)
+		store, err := loginCfg.credentialStore()
+		if err != nil {
+			return err
+		}
+		path, err := saveLoginProfile(ctx, name, endpoint, token, store)
+		if err != nil {
+			return errors.Wrap(err, "storing access token")
+		}
+		if store != nil {
+			fmt.Fprintf(proseOutput(), "💾 Stored the access token with credential helper %q, and made profile %q in %s the current profile.\n", loginCfg.CredentialHelper, name, path)
+		} else {
+			fmt.Fprintf(proseOutput(), "💾 Stored the access token in profile %q in %s, and made it the current profile.\n", name, path)
+		}
+		return nil
 	}
 
 	commands = append(commands, &command{
@@ -82,12 +146,18 @@ func loginCmd(ctx context.Context, cfg *config, client api.Client, endpointArg s
    To verify that it's working, run this command again.
 `, endpointArg, endpointArg)
 
-	if cfg.ConfigFilePath != "" {
+	if cfg.ConfigFilePath != "" && cfg.Profile == "" {
 		fmt.Fprintln(out)
 		fmt.Fprintf(out, "⚠️  Warning: Configuring src with a JSON file is deprecated. Please migrate to using the env vars SRC_ENDPOINT and SRC_ACCESS_TOKEN instead, and then remove %s. See https://github.com/sourcegraph/src-cli#readme for more information.\n", cfg.ConfigFilePath)
 	}
 
-	noToken := cfg.AccessToken == ""
+	token, err := cfg.accessToken(ctx)
+	if err != nil {
+		printProblem(fmt.Sprintf("Unable to read the access token from the credential store: %s", err))
+		return exitCode1
+	}
+
+	noToken := token == ""
 	endpointConflict := endpointArg != cfg.Endpoint
 	if noToken || endpointConflict {
 		fmt.Fprintln(out)
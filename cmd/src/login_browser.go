@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/sourcegraph/src-cli/internal/credentials"
+)
+
+// browserLoginOpts are the options for browserLogin.
+type browserLoginOpts struct {
+	// endpoint is the Sourcegraph instance to obtain an access token for.
+	endpoint string
+
+	// in is read for the access token pasted by the user.
+	in  io.Reader
+	out io.Writer
+
+	// openURL opens the given URL in the user's browser. If nil, the URL is
+	// only printed.
+	openURL func(string) error
+}
+
+// browserLogin obtains an access token for the given endpoint interactively:
+// it opens the access token creation page of the Sourcegraph instance in the
+// browser, and reads the new token pasted by the user from opts.in.
+func browserLogin(opts browserLoginOpts) (string, error) {
+	tokenURL := opts.endpoint + "/user/settings/tokens/new"
+
+	fmt.Fprintln(opts.out)
+	if opts.openURL != nil {
+		fmt.Fprintf(opts.out, "🌐 Opening %s in your browser to create an access token.\n", opts.endpoint)
+		if err := opts.openURL(tokenURL); err != nil {
+			fmt.Fprintf(opts.out, "   Unable to open the browser: %s\n", err)
+		}
+	}
+	fmt.Fprintf(opts.out, "   If the browser doesn't open, visit:\n\n   %s\n\n", tokenURL)
+	fmt.Fprint(opts.out, "   Paste the new access token here: ")
+
+	line, err := bufio.NewReader(opts.in).ReadString('\n')
+	fmt.Fprintln(opts.out)
+	if token := strings.TrimSpace(line); token != "" {
+		return token, nil
+	}
+	if err != nil && err != io.EOF {
+		return "", errors.Wrap(err, "reading access token")
+	}
+	return "", errors.New("no access token entered")
+}
+
+// saveLoginProfile stores the endpoint and access token in the named profile
+// of the config file, and makes it the current profile. Other settings of an
+// existing profile, such as additional headers, are preserved. If store is
+// not nil, the access token is stored in it instead of the config file.
+func saveLoginProfile(ctx context.Context, name, endpoint, token string, store credentials.Store) (string, error) {
+	if store != nil {
+		if err := store.Store(ctx, endpoint, token); err != nil {
+			return "", errors.Wrap(err, "storing access token in credential store")
+		}
+	}
+
+	return editConfigFile(func(raw map[string]interface{}) error {
+		profiles, ok := raw["profiles"].(map[string]interface{})
+		if !ok {
+			if raw["profiles"] != nil {
+				return errors.New(`"profiles" in the config file must be an object`)
+			}
+			profiles = map[string]interface{}{}
+			raw["profiles"] = profiles
+		}
+
+		p, ok := profiles[name].(map[string]interface{})
+		if !ok {
+			p = map[string]interface{}{}
+			profiles[name] = p
+		}
+		p["endpoint"] = endpoint
+		if store != nil {
+			delete(p, "accessToken")
+		} else {
+			p["accessToken"] = token
+		}
+
+		raw["currentProfile"] = name
+		return nil
+	})
+}
+
+// loginProfileName returns the name of the profile that credentials for
+// endpoint should be stored in: the requested name if one is given, the
+// profile currently in use if it points to the same endpoint, or else a
+// profile named after the endpoint's host.
+func loginProfileName(cfg *config, requested, endpoint string) string {
+	if requested != "" {
+		return requested
+	}
+	if p, ok := cfg.Profiles[cfg.Profile]; ok && cleanEndpoint(p.Endpoint) == endpoint {
+		return cfg.Profile
+	}
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return endpoint
+}
@@ -7,8 +7,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestLogin(t *testing.T) {
@@ -91,3 +95,98 @@ func TestLogin(t *testing.T) {
 		}
 	})
 }
+
+func TestBrowserLogin(t *testing.T) {
+	t.Run("pasted", func(t *testing.T) {
+		var out bytes.Buffer
+		var opened string
+		token, err := browserLogin(browserLoginOpts{
+			endpoint: "https://sourcegraph.example.com",
+			in:       strings.NewReader("  xyz  \n"),
+			out:      &out,
+			openURL: func(u string) error {
+				opened = u
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "xyz" {
+			t.Errorf("wrong token: have=%q want=%q", token, "xyz")
+		}
+		if want := "https://sourcegraph.example.com/user/settings/tokens/new"; opened != want {
+			t.Errorf("wrong URL opened: have=%q want=%q", opened, want)
+		}
+	})
+
+	t.Run("nothing pasted", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := browserLogin(browserLoginOpts{
+			endpoint: "https://sourcegraph.example.com",
+			in:       strings.NewReader("\n"),
+			out:      &out,
+		})
+		if err == nil {
+			t.Fatal("unexpected nil error")
+		}
+		if !strings.Contains(out.String(), "https://sourcegraph.example.com/user/settings/tokens/new") {
+			t.Errorf("token URL not printed: %q", out.String())
+		}
+	})
+}
+
+func TestSaveLoginProfile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testHomeDir = tmpDir
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+		testHomeDir = ""
+	})
+
+	existing := `{"unknown": 1, "profiles": {"prod": {"endpoint": "https://old.example.com", "accessToken": "old", "additionalHeaders": {"x-foo": "bar"}}}}`
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "src-config.json"), []byte(existing), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := saveLoginProfile(ctx, "prod", "https://prod.example.com", "new", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveLoginProfile(ctx, "staging", "https://staging.example.com", "stagingtoken", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := readConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]*profile{
+		"prod": {
+			Endpoint:          "https://prod.example.com",
+			AccessToken:       "new",
+			AdditionalHeaders: map[string]string{"x-foo": "bar"},
+		},
+		"staging": {
+			Endpoint:    "https://staging.example.com",
+			AccessToken: "stagingtoken",
+		},
+	}
+	if diff := cmp.Diff(want, cfg.Profiles); diff != "" {
+		t.Errorf("wrong profiles (-want +got):\n%s", diff)
+	}
+	if cfg.Profile != "staging" || cfg.Endpoint != "https://staging.example.com" {
+		t.Errorf("last login was not made the current profile: %q", cfg.Profile)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(tmpDir, "src-config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"unknown": 1`) {
+		t.Errorf("unknown field was not preserved:\n%s", data)
+	}
+}
@@ -29,9 +29,10 @@ Use "src lsif [command] -h" for more information about a command.
 
 	// Register the command.
 	commands = append(commands, &command{
-		flagSet: flagSet,
-		aliases: []string{"lsif"},
-		handler: handler,
+		flagSet:     flagSet,
+		aliases:     []string{"lsif"},
+		handler:     handler,
+		subcommands: &lsifCommands,
 		usageFunc: func() {
 			fmt.Println(usage)
 		},
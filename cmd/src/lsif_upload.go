@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"github.com/pkg/browser"
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/lib/codeintel/utils"
+	"github.com/sourcegraph/src-cli/internal/api"
 	"github.com/sourcegraph/src-cli/internal/codeintel"
 )
 
@@ -160,7 +162,7 @@ Examples:
 		// internally.
 		flags.verbosity = lsifUploadVerbosity(*flags.rawVerbosity)
 
-		if !*flags.json {
+		if !*flags.json && *outputFormatFlag == "" {
 			fmt.Println(argsString)
 		}
 
@@ -176,9 +178,18 @@ Examples:
 			return &usageError{err}
 		}
 
+		accessToken, err := cfg.accessToken(context.Background())
+		if err != nil {
+			return errors.Wrap(err, "getting access token")
+		}
+		transport, err := api.NewRoundTripper(cfg.clientOpts(nil, os.Stdout))
+		if err != nil {
+			return err
+		}
+
 		opts := codeintel.UploadIndexOpts{
 			Endpoint:             cfg.Endpoint,
-			AccessToken:          cfg.AccessToken,
+			AccessToken:          accessToken,
 			AdditionalHeaders:    cfg.AdditionalHeaders,
 			Path:                 *flags.uploadRoute,
 			Repo:                 *flags.repo,
@@ -201,7 +212,7 @@ Examples:
 		go func() {
 			defer wg.Done()
 
-			if *flags.json || *flags.noProgress || flags.verbosity > 0 {
+			if *flags.json || *outputFormatFlag != "" || *flags.noProgress || flags.verbosity > 0 {
 				return
 			}
 
@@ -217,7 +228,7 @@ Examples:
 			})
 		}()
 
-		uploadID, err := codeintel.UploadIndex(opts)
+		uploadID, err := codeintel.UploadIndex(opts, &http.Client{Transport: transport})
 		close(opts.UploadProgressEvents) // Stop progress bar updates
 		wg.Wait()                        // Wait for progress bar goroutine to clear screen
 		if err != nil {
@@ -248,8 +259,8 @@ Examples:
 
 		uploadURL := fmt.Sprintf("%s/%s/-/settings/code-intelligence/lsif-uploads/%s", endpointWithoutAuth.String(), *flags.repo, uploadID)
 
-		if *flags.json {
-			serialized, err := json.Marshal(map[string]interface{}{
+		if *flags.json || *outputFormatFlag != "" {
+			uploaded := map[string]interface{}{
 				"repo":      *flags.repo,
 				"commit":    *flags.commit,
 				"root":      *flags.root,
@@ -257,12 +268,19 @@ Examples:
 				"indexer":   *flags.indexer,
 				"uploadId":  uploadID,
 				"uploadUrl": uploadURL,
-			})
-			if err != nil {
-				return err
 			}
+			if *outputFormatFlag != "" {
+				if err := emitRecord(uploaded); err != nil {
+					return err
+				}
+			} else {
+				serialized, err := json.Marshal(uploaded)
+				if err != nil {
+					return err
+				}
 
-			fmt.Println(string(serialized))
+				fmt.Println(string(serialized))
+			}
 		} else {
 			fmt.Printf("LSIF dump successfully uploaded for processing.\n")
 			fmt.Printf("View processing status at %s\n", uploadURL)
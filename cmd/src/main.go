@@ -25,10 +25,15 @@ Usage:
 Environment variables
 	SRC_ACCESS_TOKEN  Sourcegraph access token
 	SRC_ENDPOINT      endpoint to use, if unset will default to "https://sourcegraph.com"
+	SRC_PROFILE       name of the configuration profile to use
+	SRC_RECORD        path of a file to record all HTTP requests and responses to, with credentials removed
+	SRC_REPLAY        path of a file recorded with SRC_RECORD to replay responses from, instead of contacting the endpoint
 
 The options are:
 
 	-v                               print verbose output
+	-profile=NAME                    use the named configuration profile (see "src config profiles")
+	-o=FORMAT                        print the output of commands as json, ndjson, yaml, csv or table instead of using their -f templates
 
 The commands are:
 
@@ -44,13 +49,16 @@ The commands are:
 	lsif            manages LSIF data
 	serve-git       serves your local git repositories over HTTP for Sourcegraph to pull
 	version         display and compare the src-cli version against the recommended version for your instance
+	completion      prints shell completion scripts for bash, zsh and fish
 
 Use "src [command] -h" for more information about a command.
 
 `
 
 var (
-	verbose = flag.Bool("v", false, "print verbose output")
+	verbose          = flag.Bool("v", false, "print verbose output")
+	profileName      = flag.String("profile", "", "use the named configuration profile")
+	outputFormatFlag = flag.String("o", "", "print the output of commands as json, ndjson, yaml, csv or table")
 
 	// The following arguments are deprecated which is why they are no longer documented
 	configPath = flag.String("config", "", "")
@@ -72,48 +80,65 @@ var cfg *config
 
 // config represents the config format.
 type config struct {
-	Endpoint          string            `json:"endpoint"`
-	AccessToken       string            `json:"accessToken"`
-	AdditionalHeaders map[string]string `json:"additionalHeaders"`
+	Endpoint           string            `json:"endpoint"`
+	AccessToken        string            `json:"accessToken"`
+	AdditionalHeaders  map[string]string `json:"additionalHeaders"`
+	InsecureSkipVerify bool              `json:"insecureSkipVerify,omitempty"`
+	CABundle           string            `json:"caBundle,omitempty"`
+	ClientCert         string            `json:"clientCert,omitempty"`
+	ClientKey          string            `json:"clientKey,omitempty"`
+	Proxy              string            `json:"proxy,omitempty"`
+
+	// CredentialHelper names the credential store that access tokens are
+	// read from if AccessToken is empty. See credentials.New.
+	CredentialHelper string `json:"credentialHelper,omitempty"`
+
+	// Profiles are named sets of connection settings. The profile to use is
+	// selected with the -profile flag, the SRC_PROFILE environment variable,
+	// or CurrentProfile, in that order.
+	Profiles       map[string]*profile `json:"profiles,omitempty"`
+	CurrentProfile string              `json:"currentProfile,omitempty"`
+
+	// Profile is the name of the profile the configuration was resolved
+	// from, or empty if no profile is in use.
+	Profile string `json:"-"`
 
 	ConfigFilePath string
 }
 
 // apiClient returns an api.Client built from the configuration.
 func (c *config) apiClient(flags *api.Flags, out io.Writer) api.Client {
-	return api.NewClient(api.ClientOpts{
-		Endpoint:          c.Endpoint,
-		AccessToken:       c.AccessToken,
-		AdditionalHeaders: c.AdditionalHeaders,
-		Flags:             flags,
-		Out:               out,
-	})
+	return api.NewClient(c.clientOpts(flags, out))
+}
+
+// clientOpts returns the api.ClientOpts described by the configuration.
+func (c *config) clientOpts(flags *api.Flags, out io.Writer) api.ClientOpts {
+	return api.ClientOpts{
+		Endpoint:           c.Endpoint,
+		AccessToken:        c.AccessToken,
+		AccessTokenFunc:    c.accessToken,
+		AdditionalHeaders:  c.AdditionalHeaders,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		CABundlePath:       c.CABundle,
+		ClientCertPath:     c.ClientCert,
+		ClientKeyPath:      c.ClientKey,
+		ProxyURL:           c.Proxy,
+		RecordPath:         os.Getenv("SRC_RECORD"),
+		ReplayPath:         os.Getenv("SRC_REPLAY"),
+		Flags:              flags,
+		Out:                out,
+	}
 }
 
 var testHomeDir string // used by tests to mock the user's $HOME
 
 // readConfig reads the config file from the given path.
 func readConfig() (*config, error) {
-	cfgPath := *configPath
-	userSpecified := *configPath != ""
-
-	var homeDir string
-	if testHomeDir != "" {
-		homeDir = testHomeDir
-	} else {
-		u, err := user.Current()
-		if err != nil {
-			return nil, err
-		}
-		homeDir = u.HomeDir
-	}
-
-	if !userSpecified {
-		cfgPath = filepath.Join(homeDir, "src-config.json")
-	} else if strings.HasPrefix(cfgPath, "~/") {
-		cfgPath = filepath.Join(homeDir, cfgPath[2:])
+	cfgPath, userSpecified, err := configFilePath()
+	if err != nil {
+		return nil, err
 	}
-	data, err := ioutil.ReadFile(os.ExpandEnv(cfgPath))
+	data, err := ioutil.ReadFile(cfgPath)
 	if err != nil && (!os.IsNotExist(err) || userSpecified) {
 		return nil, err
 	}
@@ -125,32 +150,84 @@ func readConfig() (*config, error) {
 		}
 	}
 
-	envToken := os.Getenv("SRC_ACCESS_TOKEN")
-	envEndpoint := os.Getenv("SRC_ENDPOINT")
+	// A profile selected explicitly with the flag or environment variable
+	// takes precedence over the SRC_ENDPOINT and SRC_ACCESS_TOKEN environment
+	// variables, whereas the current profile stored in the config file is
+	// overridden if both are set.
+	name := *profileName
+	if name == "" {
+		name = os.Getenv("SRC_PROFILE")
+	}
+	explicitProfile := name != ""
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
 
-	if userSpecified {
-		// If a config file is present, either zero or both environment variables must be present.
-		// We don't want to partially apply environment variables.
-		if envToken == "" && envEndpoint != "" {
-			return nil, errConfigMerge
+	var profileHeaders map[string]string
+	if name != "" {
+		p, ok := cfg.Profiles[name]
+		if !ok {
+			return nil, errors.Errorf("profile %q is not defined in %s", name, cfgPath)
 		}
-		if envToken != "" && envEndpoint == "" {
-			return nil, errConfigMerge
+		cfg.Profile = name
+		cfg.Endpoint = p.Endpoint
+		cfg.AccessToken = p.AccessToken
+		cfg.InsecureSkipVerify = p.InsecureSkipVerify
+		cfg.CABundle = p.CABundle
+		cfg.ClientCert = p.ClientCert
+		cfg.ClientKey = p.ClientKey
+		cfg.Proxy = p.Proxy
+		if p.CredentialHelper != "" {
+			cfg.CredentialHelper = p.CredentialHelper
 		}
+		profileHeaders = p.AdditionalHeaders
 	}
 
-	// Apply config overrides.
-	if envToken != "" {
-		cfg.AccessToken = envToken
-	}
-	if envEndpoint != "" {
-		cfg.Endpoint = envEndpoint
+	if !explicitProfile {
+		envToken := os.Getenv("SRC_ACCESS_TOKEN")
+		envEndpoint := os.Getenv("SRC_ENDPOINT")
+
+		if userSpecified {
+			// If a config file is present, either zero or both environment variables must be present.
+			// We don't want to partially apply environment variables.
+			if envToken == "" && envEndpoint != "" {
+				return nil, errConfigMerge
+			}
+			if envToken != "" && envEndpoint == "" {
+				return nil, errConfigMerge
+			}
+		}
+
+		// The token of the current profile must not be sent to another
+		// endpoint, and a token from the environment, which may be meant
+		// for another instance, must not be sent to the endpoint of the
+		// profile. So the environment only overrides the profile if it
+		// sets both.
+		if name != "" && (envToken == "" || envEndpoint == "") {
+			envToken, envEndpoint = "", ""
+		}
+
+		// Apply config overrides.
+		if envToken != "" {
+			cfg.AccessToken = envToken
+		}
+		if envEndpoint != "" {
+			cfg.Endpoint = envEndpoint
+		}
 	}
 	if cfg.Endpoint == "" {
 		cfg.Endpoint = "https://sourcegraph.com"
 	}
 
-	cfg.AdditionalHeaders = parseAdditionalHeaders()
+	// Headers from the environment are applied on top of those defined in
+	// the profile.
+	cfg.AdditionalHeaders = map[string]string{}
+	for k, v := range profileHeaders {
+		cfg.AdditionalHeaders[strings.ToLower(k)] = v
+	}
+	for k, v := range parseAdditionalHeaders() {
+		cfg.AdditionalHeaders[k] = v
+	}
 
 	// Lastly, apply endpoint flag if set
 	if endpoint != nil && *endpoint != "" {
@@ -162,6 +239,31 @@ func readConfig() (*config, error) {
 	return &cfg, nil
 }
 
+// configFilePath returns the path of the config file, and whether it was
+// specified by the user with the -config flag.
+func configFilePath() (string, bool, error) {
+	cfgPath := *configPath
+	userSpecified := *configPath != ""
+
+	var homeDir string
+	if testHomeDir != "" {
+		homeDir = testHomeDir
+	} else {
+		u, err := user.Current()
+		if err != nil {
+			return "", false, err
+		}
+		homeDir = u.HomeDir
+	}
+
+	if !userSpecified {
+		cfgPath = filepath.Join(homeDir, "src-config.json")
+	} else if strings.HasPrefix(cfgPath, "~/") {
+		cfgPath = filepath.Join(homeDir, cfgPath[2:])
+	}
+	return os.ExpandEnv(cfgPath), userSpecified, nil
+}
+
 func cleanEndpoint(urlStr string) string {
 	return strings.TrimSuffix(urlStr, "/")
 }
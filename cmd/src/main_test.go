@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -14,10 +15,15 @@ func TestReadConfig(t *testing.T) {
 	tests := []struct {
 		name         string
 		fileContents *config
+		// homeConfig writes fileContents to the default config file path
+		// instead of passing it with -config.
+		homeConfig   bool
 		envToken     string
 		envFooHeader string
 		envEndpoint  string
+		envProfile   string
 		flagEndpoint string
+		flagProfile  string
 		want         *config
 		wantErr      string
 	}{
@@ -140,6 +146,221 @@ func TestReadConfig(t *testing.T) {
 				AdditionalHeaders: map[string]string{"foo": "bar"},
 			},
 		},
+		{
+			name: "current profile",
+			fileContents: &config{
+				CurrentProfile: "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+					"staging": {
+						Endpoint:           "https://staging.example.com",
+						AccessToken:        "stagingtoken",
+						AdditionalHeaders:  map[string]string{"X-Staging": "yes"},
+						InsecureSkipVerify: true,
+					},
+				},
+			},
+			want: &config{
+				Endpoint:          "https://prod.example.com",
+				AccessToken:       "prodtoken",
+				AdditionalHeaders: map[string]string{},
+				CurrentProfile:    "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+					"staging": {
+						Endpoint:           "https://staging.example.com",
+						AccessToken:        "stagingtoken",
+						AdditionalHeaders:  map[string]string{"X-Staging": "yes"},
+						InsecureSkipVerify: true,
+					},
+				},
+				Profile: "prod",
+			},
+		},
+		{
+			name: "current profile is overridden by environment",
+			fileContents: &config{
+				CurrentProfile: "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+					"staging": {
+						Endpoint:           "https://staging.example.com",
+						AccessToken:        "stagingtoken",
+						AdditionalHeaders:  map[string]string{"X-Staging": "yes"},
+						InsecureSkipVerify: true,
+					},
+				},
+			},
+			envEndpoint: "https://example.com",
+			envToken:    "abc",
+			want: &config{
+				Endpoint:          "https://example.com",
+				AccessToken:       "abc",
+				AdditionalHeaders: map[string]string{},
+				CurrentProfile:    "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+					"staging": {
+						Endpoint:           "https://staging.example.com",
+						AccessToken:        "stagingtoken",
+						AdditionalHeaders:  map[string]string{"X-Staging": "yes"},
+						InsecureSkipVerify: true,
+					},
+				},
+				Profile: "prod",
+			},
+		},
+		{
+			name:       "current profile ignores only SRC_ACCESS_TOKEN",
+			homeConfig: true,
+			fileContents: &config{
+				CurrentProfile: "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+				},
+			},
+			envToken: "abc",
+			want: &config{
+				Endpoint:          "https://prod.example.com",
+				AccessToken:       "prodtoken",
+				AdditionalHeaders: map[string]string{},
+				CurrentProfile:    "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+				},
+				Profile: "prod",
+			},
+		},
+		{
+			name:       "current profile ignores only SRC_ENDPOINT",
+			homeConfig: true,
+			fileContents: &config{
+				CurrentProfile: "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+				},
+			},
+			envEndpoint: "https://example.com",
+			want: &config{
+				Endpoint:          "https://prod.example.com",
+				AccessToken:       "prodtoken",
+				AdditionalHeaders: map[string]string{},
+				CurrentProfile:    "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+				},
+				Profile: "prod",
+			},
+		},
+		{
+			name: "profile flag overrides environment and current profile",
+			fileContents: &config{
+				CurrentProfile: "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+					"staging": {
+						Endpoint:           "https://staging.example.com",
+						AccessToken:        "stagingtoken",
+						AdditionalHeaders:  map[string]string{"X-Staging": "yes"},
+						InsecureSkipVerify: true,
+					},
+				},
+			},
+			flagProfile:  "staging",
+			envEndpoint:  "https://example.com",
+			envToken:     "abc",
+			envFooHeader: "bar",
+			want: &config{
+				Endpoint:           "https://staging.example.com",
+				AccessToken:        "stagingtoken",
+				AdditionalHeaders:  map[string]string{"x-staging": "yes", "foo": "bar"},
+				InsecureSkipVerify: true,
+				CurrentProfile:     "prod",
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+					"staging": {
+						Endpoint:           "https://staging.example.com",
+						AccessToken:        "stagingtoken",
+						AdditionalHeaders:  map[string]string{"X-Staging": "yes"},
+						InsecureSkipVerify: true,
+					},
+				},
+				Profile: "staging",
+			},
+		},
+		{
+			name: "profile from environment",
+			fileContents: &config{
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+					"staging": {
+						Endpoint:           "https://staging.example.com",
+						AccessToken:        "stagingtoken",
+						AdditionalHeaders:  map[string]string{"X-Staging": "yes"},
+						InsecureSkipVerify: true,
+					},
+				},
+			},
+			envProfile: "staging",
+			want: &config{
+				Endpoint:           "https://staging.example.com",
+				AccessToken:        "stagingtoken",
+				AdditionalHeaders:  map[string]string{"x-staging": "yes"},
+				InsecureSkipVerify: true,
+				Profiles: map[string]*profile{
+					"prod": {
+						Endpoint:    "https://prod.example.com/",
+						AccessToken: "prodtoken",
+					},
+					"staging": {
+						Endpoint:           "https://staging.example.com",
+						AccessToken:        "stagingtoken",
+						AdditionalHeaders:  map[string]string{"X-Staging": "yes"},
+						InsecureSkipVerify: true,
+					},
+				},
+				Profile: "staging",
+			},
+		},
+		{
+			name:        "unknown profile",
+			flagProfile: "nope",
+			want:        nil,
+			wantErr:     "profile \"nope\" is not defined in ",
+		},
 	}
 
 	for _, test := range tests {
@@ -153,6 +374,7 @@ func TestReadConfig(t *testing.T) {
 			}
 			setEnv("SRC_ACCESS_TOKEN", test.envToken)
 			setEnv("SRC_ENDPOINT", test.envEndpoint)
+			setEnv("SRC_PROFILE", test.envProfile)
 
 			tmpDir, err := ioutil.TempDir("", "")
 			if err != nil {
@@ -167,6 +389,11 @@ func TestReadConfig(t *testing.T) {
 				t.Cleanup(func() { endpoint = nil })
 			}
 
+			if test.flagProfile != "" {
+				*profileName = test.flagProfile
+				t.Cleanup(func() { *profileName = "" })
+			}
+
 			if test.fileContents != nil {
 				oldConfigPath := *configPath
 				t.Cleanup(func() { *configPath = oldConfigPath })
@@ -176,11 +403,16 @@ func TestReadConfig(t *testing.T) {
 					t.Fatal(err)
 				}
 				filePath := filepath.Join(tmpDir, "config.json")
+				if test.homeConfig {
+					filePath = filepath.Join(tmpDir, "src-config.json")
+				}
 				err = ioutil.WriteFile(filePath, data, 0600)
 				if err != nil {
 					t.Fatal(err)
 				}
-				*configPath = filePath
+				if !test.homeConfig {
+					*configPath = filePath
+				}
 			}
 
 			if err := os.Setenv("SRC_HEADER_FOO", test.envFooHeader); err != nil {
@@ -194,6 +426,9 @@ func TestReadConfig(t *testing.T) {
 			var errMsg string
 			if err != nil {
 				errMsg = err.Error()
+				if test.wantErr != "" && strings.HasPrefix(errMsg, test.wantErr) {
+					errMsg = test.wantErr
+				}
 			}
 			if diff := cmp.Diff(test.wantErr, errMsg); diff != "" {
 				t.Errorf("err: %v", diff)
@@ -59,7 +59,7 @@ Examples:
 			return err
 		}
 
-		fmt.Printf("Organization %q created.\n", *nameFlag)
+		fmt.Fprintf(proseOutput(), "Organization %q created.\n", *nameFlag)
 		return nil
 	}
 
@@ -63,7 +63,7 @@ Examples:
 			return err
 		}
 
-		fmt.Printf("Organization with ID %q deleted.\n", *orgIDFlag)
+		fmt.Fprintf(proseOutput(), "Organization with ID %q deleted.\n", *orgIDFlag)
 		return nil
 	}
 
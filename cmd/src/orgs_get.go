@@ -70,8 +70,9 @@ Examples:
 
 	// Register the command.
 	orgsCommands = append(orgsCommands, &command{
-		flagSet:   flagSet,
-		handler:   handler,
-		usageFunc: usageFunc,
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"name": completeOrgNames},
+		usageFunc:   usageFunc,
 	})
 }
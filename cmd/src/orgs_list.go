@@ -50,6 +50,7 @@ Examples:
 		if err != nil {
 			return err
 		}
+		expectRecords()
 
 		query := `query Organizations(
   $first: Int,
@@ -59,14 +59,15 @@ Examples:
 			return err
 		}
 
-		fmt.Printf("User %q added as member to organization with ID %q.\n", *usernameFlag, *orgIDFlag)
+		fmt.Fprintf(proseOutput(), "User %q added as member to organization with ID %q.\n", *usernameFlag, *orgIDFlag)
 		return nil
 	}
 
 	// Register the command.
 	orgsMembersCommands = append(orgsMembersCommands, &command{
-		flagSet:   flagSet,
-		handler:   handler,
-		usageFunc: usageFunc,
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"username": completeUsernames},
+		usageFunc:   usageFunc,
 	})
 }
@@ -58,7 +58,7 @@ Examples:
 			return err
 		}
 
-		fmt.Printf("User %q removed as member from organization with ID %q.\n", *userIDFlag, *orgIDFlag)
+		fmt.Fprintf(proseOutput(), "User %q removed as member from organization with ID %q.\n", *userIDFlag, *orgIDFlag)
 		return nil
 	}
 
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var pluginsCommands commander
+
+func init() {
+	usage := `'src plugins' manages plugins: executables that add subcommands to src.
+
+Any executable named src-NAME in a directory in your $PATH can be run as
+'src NAME'. For a subcommand of another command, such as 'src batch NAME', the
+executable is named src-batch-NAME. Plugins are only run if there is no
+built-in command with the same name.
+
+Plugins are run with the resolved configuration in their environment:
+
+	SRC_ENDPOINT      the endpoint of the Sourcegraph instance
+	SRC_ACCESS_TOKEN  the access token, if one is configured
+	SRC_HEADER_NAME   the additional HTTP headers to send
+	SRC_PROFILE       the configuration profile in use, if any
+
+so that they can call 'src api' or the Sourcegraph API directly.
+
+Usage:
+
+	src plugins command [command options]
+
+The commands are:
+
+	list      lists the plugins found in $PATH
+
+Use "src plugins [command] -h" for more information about a command.
+`
+
+	flagSet := flag.NewFlagSet("plugins", flag.ExitOnError)
+	handler := func(args []string) error {
+		pluginsCommands.run(flagSet, "src plugins", usage, args)
+		return nil
+	}
+
+	// Register the command.
+	commands = append(commands, &command{
+		flagSet:     flagSet,
+		aliases:     []string{"plugin"},
+		handler:     handler,
+		subcommands: &pluginsCommands,
+		usageFunc: func() {
+			fmt.Println(usage)
+		},
+	})
+}
+
+// pluginPrefix is the prefix of the executable names of plugins.
+const pluginPrefix = "src-"
+
+// plugin is an executable that provides a subcommand of src.
+type plugin struct {
+	// Name is the name of the executable, without extension.
+	Name string `json:"name"`
+	// Command is the src command that runs the plugin.
+	Command string `json:"command"`
+	// Path is the path to the executable.
+	Path string `json:"path"`
+	// Shadowed is true if another executable with the same name comes first
+	// in $PATH, so that this one is never run.
+	Shadowed bool `json:"shadowed"`
+}
+
+// pluginName returns the executable name of the plugin for the subcommand
+// name of the command cmdName, such as "src-batch-foo" for "src batch" and
+// "foo".
+func pluginName(cmdName, name string) string {
+	return strings.Join(append(strings.Fields(cmdName), name), "-")
+}
+
+// lookupPlugin returns the path to the plugin for the subcommand name of the
+// command cmdName, or false if there is none.
+func lookupPlugin(cmdName, name string) (string, bool) {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	path, err := exec.LookPath(pluginName(cmdName, name))
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// runPlugin runs the plugin at path with args, passing the resolved
+// configuration through the environment. The exit code of the plugin is
+// returned as an *exitCodeError.
+func runPlugin(path string, args []string) error {
+	env, err := pluginEnv(context.Background(), os.Environ())
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return &exitCodeError{exitCode: exitErr.ExitCode()}
+		}
+		return errors.Wrapf(err, "running plugin %s", path)
+	}
+	return nil
+}
+
+// pluginEnv returns environ with the configuration variables replaced by the
+// resolved configuration.
+func pluginEnv(ctx context.Context, environ []string) ([]string, error) {
+	token, err := cfg.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		name := strings.SplitN(kv, "=", 2)[0]
+		switch {
+		case name == "SRC_ENDPOINT", name == "SRC_ACCESS_TOKEN", name == "SRC_PROFILE":
+		case strings.HasPrefix(name, additionalHeaderPrefix):
+		default:
+			env = append(env, kv)
+		}
+	}
+
+	env = append(env, "SRC_ENDPOINT="+cfg.Endpoint)
+	if token != "" {
+		env = append(env, "SRC_ACCESS_TOKEN="+token)
+	}
+	if cfg.Profile != "" {
+		env = append(env, "SRC_PROFILE="+cfg.Profile)
+	}
+	for name, value := range cfg.AdditionalHeaders {
+		env = append(env, additionalHeaderPrefix+strings.ToUpper(name)+"="+value)
+	}
+	return env, nil
+}
+
+// discoverPlugins returns all plugins in the directories in path, in the
+// order in which they are found.
+func discoverPlugins(path string) []*plugin {
+	var plugins []*plugin
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dir = "."
+		}
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			name := info.Name()
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			// Credential helpers share the prefix, but aren't subcommands.
+			if !strings.HasPrefix(name, pluginPrefix) || strings.HasPrefix(name, "src-credential-") {
+				continue
+			}
+			path := filepath.Join(dir, info.Name())
+			if info.Mode()&os.ModeSymlink != 0 {
+				if info, err = os.Stat(path); err != nil {
+					continue
+				}
+			}
+			if !isExecutable(info) {
+				continue
+			}
+
+			plugins = append(plugins, &plugin{
+				Name:     name,
+				Command:  "src " + strings.TrimPrefix(name, pluginPrefix),
+				Path:     path,
+				Shadowed: seen[name],
+			})
+			seen[name] = true
+		}
+	}
+	return plugins
+}
+
+func isExecutable(info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(info.Name()))
+		return ext == ".exe" || ext == ".bat" || ext == ".cmd"
+	}
+	return info.Mode()&0111 != 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func init() {
+	usage := `
+Examples:
+
+  List the plugins found in $PATH:
+
+    	$ src plugins list
+
+  List the paths of all plugins:
+
+    	$ src plugins list -f '{{.Path}}'
+
+`
+
+	flagSet := flag.NewFlagSet("list", flag.ExitOnError)
+	usageFunc := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of 'src plugins %s':\n", flagSet.Name())
+		flagSet.PrintDefaults()
+		fmt.Println(usage)
+	}
+	var (
+		formatFlag = flagSet.String("f", "{{.Command}}\t{{.Path}}{{if .Shadowed}} (shadowed){{end}}", `Format for the output, using the syntax of Go package text/template. (e.g. "{{.Name}}: {{.Path}}" or "{{.|json}}")`)
+	)
+
+	handler := func(args []string) error {
+		if err := flagSet.Parse(args); err != nil {
+			return err
+		}
+
+		tmpl, err := parseTemplate(*formatFlag)
+		if err != nil {
+			return err
+		}
+		expectRecords()
+
+		for _, p := range discoverPlugins(os.Getenv("PATH")) {
+			if err := execTemplate(tmpl, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Register the command.
+	pluginsCommands = append(pluginsCommands, &command{
+		flagSet:   flagSet,
+		handler:   handler,
+		usageFunc: usageFunc,
+	})
+}
@@ -0,0 +1,157 @@
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiscoverPlugins(t *testing.T) {
+	dir1, dir2 := tempPluginDir(t), tempPluginDir(t)
+	writePlugin(t, dir1, "src-foo", "#!/bin/sh\n", 0755)
+	writePlugin(t, dir1, "src-batch-bar", "#!/bin/sh\n", 0755)
+	writePlugin(t, dir1, "src-notexecutable", "", 0644)
+	writePlugin(t, dir1, "src-credential-store", "#!/bin/sh\n", 0755)
+	writePlugin(t, dir1, "other", "#!/bin/sh\n", 0755)
+	writePlugin(t, dir2, "src-foo", "#!/bin/sh\n", 0755)
+	if err := os.Symlink(filepath.Join(dir1, "src-foo"), filepath.Join(dir2, "src-linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	have := discoverPlugins(strings.Join([]string{dir1, filepath.Join(dir1, "missing"), dir2}, string(os.PathListSeparator)))
+	want := []*plugin{
+		{Name: "src-batch-bar", Command: "src batch-bar", Path: filepath.Join(dir1, "src-batch-bar")},
+		{Name: "src-foo", Command: "src foo", Path: filepath.Join(dir1, "src-foo")},
+		{Name: "src-foo", Command: "src foo", Path: filepath.Join(dir2, "src-foo"), Shadowed: true},
+		{Name: "src-linked", Command: "src linked", Path: filepath.Join(dir2, "src-linked")},
+	}
+	if diff := cmp.Diff(want, have); diff != "" {
+		t.Errorf("wrong plugins (-want +got):\n%s", diff)
+	}
+}
+
+func TestLookupPlugin(t *testing.T) {
+	dir := tempPluginDir(t)
+	writePlugin(t, dir, "src-foo", "#!/bin/sh\n", 0755)
+	writePlugin(t, dir, "src-batch-bar", "#!/bin/sh\n", 0755)
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir)
+	t.Cleanup(func() { os.Setenv("PATH", oldPath) })
+
+	for _, tt := range []struct {
+		cmdName, name string
+		want          string
+	}{
+		{cmdName: "src", name: "foo", want: filepath.Join(dir, "src-foo")},
+		{cmdName: "src batch", name: "bar", want: filepath.Join(dir, "src-batch-bar")},
+		{cmdName: "src", name: "bar"},
+		{cmdName: "src", name: "../src-foo"},
+		{cmdName: "src", name: ""},
+	} {
+		have, ok := lookupPlugin(tt.cmdName, tt.name)
+		if have != tt.want || ok != (tt.want != "") {
+			t.Errorf("lookupPlugin(%q, %q): have=(%q, %v) want=%q", tt.cmdName, tt.name, have, ok, tt.want)
+		}
+	}
+}
+
+func TestCommanderAllowsPlugin(t *testing.T) {
+	c := commander{
+		{flagSet: flag.NewFlagSet("list", flag.ExitOnError), aliases: []string{"ls"}},
+		{flagSet: flag.NewFlagSet("__complete", flag.ExitOnError), hidden: true},
+		didYouMeanOtherCommand("publish", []string{"extensions publish"}),
+	}
+	for name, want := range map[string]bool{
+		"foo":        true,
+		"publish":    true,
+		"list":       false,
+		"ls":         false,
+		"__complete": false,
+	} {
+		if have := c.allowsPlugin(name); have != want {
+			t.Errorf("allowsPlugin(%q): have=%v want=%v", name, have, want)
+		}
+	}
+}
+
+func TestPluginEnv(t *testing.T) {
+	oldCfg := cfg
+	cfg = &config{
+		Endpoint:          "https://sourcegraph.example.com",
+		AccessToken:       "abc",
+		AdditionalHeaders: map[string]string{"x-foo": "bar"},
+		Profile:           "prod",
+	}
+	t.Cleanup(func() { cfg = oldCfg })
+
+	have, err := pluginEnv(context.Background(), []string{
+		"HOME=/home/alice",
+		"SRC_ENDPOINT=https://other.example.com",
+		"SRC_ACCESS_TOKEN=xyz",
+		"SRC_HEADER_X_OLD=baz",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(have)
+	want := []string{
+		"HOME=/home/alice",
+		"SRC_ACCESS_TOKEN=abc",
+		"SRC_ENDPOINT=https://sourcegraph.example.com",
+		"SRC_HEADER_X-FOO=bar",
+		"SRC_PROFILE=prod",
+	}
+	if diff := cmp.Diff(want, have); diff != "" {
+		t.Errorf("wrong environment (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunPlugin(t *testing.T) {
+	oldCfg := cfg
+	cfg = &config{Endpoint: "https://sourcegraph.example.com"}
+	t.Cleanup(func() { cfg = oldCfg })
+
+	dir := tempPluginDir(t)
+	out := filepath.Join(dir, "out")
+	writePlugin(t, dir, "src-foo", "#!/bin/sh\necho \"$SRC_ENDPOINT $*\" > "+out+"\nexit 3\n", 0755)
+
+	err := runPlugin(filepath.Join(dir, "src-foo"), []string{"-x", "y"})
+	if e, ok := err.(*exitCodeError); !ok || e.exitCode != 3 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have, want := string(data), "https://sourcegraph.example.com -x y\n"; have != want {
+		t.Errorf("wrong plugin output: have=%q want=%q", have, want)
+	}
+}
+
+func tempPluginDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "src-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func writePlugin(t *testing.T, dir, name, content string, mode os.FileMode) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+}
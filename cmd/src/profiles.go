@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// profile is a named set of connection settings for a Sourcegraph instance,
+// stored in the config file.
+type profile struct {
+	Endpoint           string            `json:"endpoint"`
+	AccessToken        string            `json:"accessToken,omitempty"`
+	AdditionalHeaders  map[string]string `json:"additionalHeaders,omitempty"`
+	InsecureSkipVerify bool              `json:"insecureSkipVerify,omitempty"`
+	CABundle           string            `json:"caBundle,omitempty"`
+	ClientCert         string            `json:"clientCert,omitempty"`
+	ClientKey          string            `json:"clientKey,omitempty"`
+	Proxy              string            `json:"proxy,omitempty"`
+	CredentialHelper   string            `json:"credentialHelper,omitempty"`
+}
+
+// profileNames returns the names of all profiles defined in the config,
+// sorted alphabetically.
+func (c *config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// editConfigFile reads the config file, applies edit to its raw JSON object
+// and writes it back, creating the file if it doesn't exist yet. Working on
+// the raw object ensures that unknown fields are preserved.
+func editConfigFile(edit func(raw map[string]interface{}) error) (string, error) {
+	path, _, err := configFilePath()
+	if err != nil {
+		return "", err
+	}
+
+	raw := map[string]interface{}{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	} else if err == nil {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return "", errors.Wrapf(err, "parsing %s", path)
+		}
+	}
+
+	if err := edit(raw); err != nil {
+		return "", err
+	}
+
+	data, err = marshalIndent(raw)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	// The config file may contain access tokens, so it should only be
+	// readable by the user.
+	return path, ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
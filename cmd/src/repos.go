@@ -34,9 +34,10 @@ Use "src repos [command] -h" for more information about a command.
 
 	// Register the command.
 	commands = append(commands, &command{
-		flagSet: flagSet,
-		aliases: []string{"repo"},
-		handler: handler,
+		flagSet:     flagSet,
+		aliases:     []string{"repo"},
+		handler:     handler,
+		subcommands: &reposCommands,
 		usageFunc: func() {
 			fmt.Println(usage)
 		},
@@ -72,8 +72,9 @@ Examples:
 
 	// Register the command.
 	reposCommands = append(reposCommands, &command{
-		flagSet:   flagSet,
-		handler:   deleteRepositories,
-		usageFunc: printUsage,
+		flagSet:     flagSet,
+		handler:     deleteRepositories,
+		completions: map[string]completer{"": completeRepositoryNames},
+		usageFunc:   printUsage,
 	})
 }
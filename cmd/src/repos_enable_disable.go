@@ -59,7 +59,7 @@ func initReposEnableDisable(cmdName string, enable bool, usage string) {
 			return err
 		}
 
-		fmt.Printf("repository %sd: %s\n", cmdName, repoName)
+		fmt.Fprintf(proseOutput(), "repository %sd: %s\n", cmdName, repoName)
 		return nil
 	}
 
@@ -83,9 +83,10 @@ func initReposEnableDisable(cmdName string, enable bool, usage string) {
 
 	// Register the command.
 	reposCommands = append(reposCommands, &command{
-		flagSet:   flagSet,
-		handler:   handler,
-		usageFunc: usageFunc,
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"": completeRepositoryNames},
+		usageFunc:   usageFunc,
 	})
 }
 
@@ -67,8 +67,9 @@ Examples:
 
 	// Register the command.
 	reposCommands = append(reposCommands, &command{
-		flagSet:   flagSet,
-		handler:   handler,
-		usageFunc: usageFunc,
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"name": completeRepositoryNames},
+		usageFunc:   usageFunc,
 	})
 }
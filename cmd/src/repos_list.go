@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"strings"
@@ -63,9 +64,11 @@ Examples:
 		if err != nil {
 			return err
 		}
+		expectRecords()
 
 		query := `query Repositories(
   $first: Int,
+  $after: String,
   $query: String,
   $cloned: Boolean,
   $notCloned: Boolean,
@@ -76,6 +79,7 @@ Examples:
 ) {
   repositories(
     first: $first,
+    after: $after,
     query: $query,
     cloned: $cloned,
     notCloned: $notCloned,
@@ -87,6 +91,10 @@ Examples:
     nodes {
       ...RepositoryFields
     }
+    pageInfo {
+      endCursor
+      hasNextPage
+    }
   }
 }
 ` + repositoryFragment
@@ -101,36 +109,32 @@ Examples:
 			return fmt.Errorf("invalid -order-by flag value: %q", *orderByFlag)
 		}
 
-		var result struct {
-			Repositories struct {
-				Nodes []Repository
+		return api.Paginate(context.Background(), client, api.PaginateOpts{
+			Query: query,
+			Vars: map[string]interface{}{
+				"query":      api.NullString(*queryFlag),
+				"cloned":     *clonedFlag,
+				"notCloned":  *notClonedFlag,
+				"indexed":    *indexedFlag,
+				"notIndexed": *notIndexedFlag,
+				"orderBy":    orderBy,
+				"descending": *descendingFlag,
+			},
+			Path:  []string{"repositories"},
+			Limit: *firstFlag,
+		}, func(node json.RawMessage) error {
+			var repo Repository
+			if err := json.Unmarshal(node, &repo); err != nil {
+				return err
 			}
-		}
-		if ok, err := client.NewRequest(query, map[string]interface{}{
-			"first":      api.NullInt(*firstFlag),
-			"query":      api.NullString(*queryFlag),
-			"cloned":     *clonedFlag,
-			"notCloned":  *notClonedFlag,
-			"indexed":    *indexedFlag,
-			"notIndexed": *notIndexedFlag,
-			"orderBy":    orderBy,
-			"descending": *descendingFlag,
-		}).Do(context.Background(), &result); err != nil || !ok {
-			return err
-		}
 
-		for _, repo := range result.Repositories.Nodes {
 			if *namesWithoutHostFlag {
 				firstSlash := strings.Index(repo.Name, "/")
 				fmt.Println(repo.Name[firstSlash+len("/"):])
-				continue
+				return nil
 			}
-
-			if err := execTemplate(tmpl, repo); err != nil {
-				return err
-			}
-		}
-		return nil
+			return execTemplate(tmpl, repo)
+		})
 	}
 
 	// Register the command.
@@ -65,10 +65,15 @@ Other tips:
 		}
 
 		if *streamFlag {
+			// Streamed results are written as they arrive, so ndjson is the
+			// only structured output format that can be supported.
+			if *outputFormatFlag != "" && *outputFormatFlag != "ndjson" {
+				return &usageError{fmt.Errorf("streaming search only supports the ndjson output format, not %q", *outputFormatFlag)}
+			}
 			opts := streaming.Opts{
 				Display: *display,
 				Trace:   apiFlags.Trace(),
-				Json:    *jsonFlag,
+				Json:    *jsonFlag || *outputFormatFlag == "ndjson",
 			}
 			client := cfg.apiClient(apiFlags, flagSet.Output())
 			return streamSearch(flagSet.Arg(0), opts, client, os.Stdout)
@@ -85,7 +90,7 @@ Other tips:
 		queryString := flagSet.Arg(0)
 
 		// For pagination, pipe our own output to 'less -R'
-		if *lessFlag && !*jsonFlag && isatty.IsTerminal(os.Stdout.Fd()) {
+		if *lessFlag && !*jsonFlag && *outputFormatFlag == "" && isatty.IsTerminal(os.Stdout.Fd()) {
 			cmdPath, err := os.Executable()
 			if err != nil {
 				return err
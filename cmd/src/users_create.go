@@ -62,10 +62,10 @@ Examples:
 			return err
 		}
 
-		fmt.Printf("User %q created.\n", *usernameFlag)
+		fmt.Fprintf(proseOutput(), "User %q created.\n", *usernameFlag)
 		if *resetPasswordURLFlag && result.CreateUser.ResetPasswordURL != "" {
 			fmt.Println()
-			fmt.Printf("\tReset pasword URL: %s\n", result.CreateUser.ResetPasswordURL)
+			fmt.Fprintf(proseOutput(), "\tReset pasword URL: %s\n", result.CreateUser.ResetPasswordURL)
 		}
 		return nil
 	}
@@ -98,7 +98,7 @@ Examples:
 			return err
 		}
 
-		fmt.Printf("User with ID %q deleted.\n", *userIDFlag)
+		fmt.Fprintf(proseOutput(), "User with ID %q deleted.\n", *userIDFlag)
 		return nil
 	}
 
@@ -66,8 +66,9 @@ Examples:
 
 	// Register the command.
 	usersCommands = append(usersCommands, &command{
-		flagSet:   flagSet,
-		handler:   handler,
-		usageFunc: usageFunc,
+		flagSet:     flagSet,
+		handler:     handler,
+		completions: map[string]completer{"username": completeUsernames},
+		usageFunc:   usageFunc,
 	})
 }
@@ -56,6 +56,7 @@ Examples:
 		if err != nil {
 			return err
 		}
+		expectRecords()
 		vars := map[string]interface{}{
 			"first": api.NullInt(*firstFlag),
 			"query": api.NullString(*queryFlag),
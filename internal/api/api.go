@@ -4,7 +4,6 @@ package api
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,10 +11,12 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	ioaux "github.com/jig/teereadcloser"
 	"github.com/kballard/go-shellquote"
 	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/lib/codeintel/utils"
 )
 
@@ -42,6 +43,10 @@ type Client interface {
 	NewHTTPRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error)
 
 	// Do runs an http.Request against the Sourcegraph API.
+	//
+	// Requests with an idempotent method, or whose context has been marked
+	// with WithRetrySafe, are retried according to the client's RetryPolicy.
+	// Other requests are attempted exactly once.
 	Do(req *http.Request) (*http.Response, error)
 }
 
@@ -65,6 +70,15 @@ type Request interface {
 type client struct {
 	opts       ClientOpts
 	httpClient *http.Client
+	retry      RetryPolicy
+
+	// transportErr is set if the transport could not be created from the
+	// options, and is returned when a request is created.
+	transportErr error
+
+	accessToken     string
+	accessTokenErr  error
+	accessTokenOnce sync.Once
 }
 
 // request is the internal concrete type implementing Request.
@@ -81,6 +95,28 @@ type ClientOpts struct {
 	AccessToken       string
 	AdditionalHeaders map[string]string
 
+	// AccessTokenFunc, if set and AccessToken is empty, is called to obtain
+	// the access token when the first request is created. This allows the
+	// token to be read from a credential store only when it is needed.
+	AccessTokenFunc func(ctx context.Context) (string, error)
+
+	// InsecureSkipVerify disables the validation of TLS certificates, in
+	// addition to the -insecure-skip-verify flag.
+	InsecureSkipVerify bool
+
+	// CABundlePath is the path to a PEM file of CA certificates that are
+	// trusted in addition to the system roots.
+	CABundlePath string
+
+	// ClientCertPath and ClientKeyPath are the paths to a PEM encoded client
+	// certificate and private key used for mutual TLS.
+	ClientCertPath string
+	ClientKeyPath  string
+
+	// ProxyURL is the URL of the proxy that all requests are sent through. If
+	// empty, the proxy is taken from the environment.
+	ProxyURL string
+
 	// Flags are the standard API client flags provided by NewFlags. If nil,
 	// default values will be used.
 	Flags *Flags
@@ -88,6 +124,18 @@ type ClientOpts struct {
 	// Out is the writer that will be used when outputting diagnostics, such as
 	// curl commands when -get-curl is enabled.
 	Out io.Writer
+
+	// RetryPolicy overrides the policy used to retry failed requests. If nil,
+	// DefaultRetryPolicy is used with the number of retries taken from Flags.
+	RetryPolicy *RetryPolicy
+
+	// RecordPath is the path of a cassette file to record all HTTP
+	// interactions to, with credentials scrubbed.
+	RecordPath string
+
+	// ReplayPath is the path of a cassette file to replay HTTP interactions
+	// from, instead of sending requests to the endpoint.
+	ReplayPath string
 }
 
 // NewClient creates a new API client.
@@ -101,22 +149,37 @@ func NewClient(opts ClientOpts) Client {
 		flags = defaultFlags()
 	}
 
-	httpClient := http.DefaultClient
-	if flags.insecureSkipVerify != nil && *flags.insecureSkipVerify {
-		httpClient = &http.Client{
-			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
-		}
+	opts.Flags = flags
+	transport, transportErr := NewRoundTripper(opts)
+	httpClient := &http.Client{Transport: transport}
+
+	retry := DefaultRetryPolicy
+	if opts.RetryPolicy != nil {
+		retry = *opts.RetryPolicy
+	} else if flags.retries != nil {
+		retry.MaxAttempts = *flags.retries + 1
 	}
 
 	return &client{
 		opts: ClientOpts{
-			Endpoint:          opts.Endpoint,
-			AccessToken:       opts.AccessToken,
-			AdditionalHeaders: opts.AdditionalHeaders,
-			Flags:             flags,
-			Out:               opts.Out,
+			Endpoint:           opts.Endpoint,
+			AccessToken:        opts.AccessToken,
+			AccessTokenFunc:    opts.AccessTokenFunc,
+			AdditionalHeaders:  opts.AdditionalHeaders,
+			InsecureSkipVerify: opts.InsecureSkipVerify,
+			CABundlePath:       opts.CABundlePath,
+			ClientCertPath:     opts.ClientCertPath,
+			ClientKeyPath:      opts.ClientKeyPath,
+			ProxyURL:           opts.ProxyURL,
+			Flags:              flags,
+			Out:                opts.Out,
+			RetryPolicy:        &retry,
+			RecordPath:         opts.RecordPath,
+			ReplayPath:         opts.ReplayPath,
 		},
-		httpClient: httpClient,
+		httpClient:   httpClient,
+		transportErr: transportErr,
+		retry:        retry,
 	}
 }
 
@@ -146,7 +209,14 @@ func (c *client) NewGzippedQuery(query string) Request {
 }
 
 func (c *client) Do(req *http.Request) (*http.Response, error) {
-	return c.httpClient.Do(req)
+	if c.transportErr != nil {
+		return nil, c.transportErr
+	}
+
+	newRequest, rewindable := rewindableRequest(req)
+	retryable := rewindable && (isIdempotentMethod(req.Method) || isRetrySafe(req.Context()))
+
+	return c.doWithRetry(req.Context(), retryable, newRequest)
 }
 
 func (c *client) NewHTTPRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
@@ -159,12 +229,20 @@ func (c *client) NewHTTPRequest(ctx context.Context, method, p string, body io.R
 }
 
 func (c *client) createHTTPRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	if c.transportErr != nil {
+		return nil, c.transportErr
+	}
+
 	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.opts.Endpoint, "/")+"/"+p, body)
 	if err != nil {
 		return nil, err
 	}
-	if c.opts.AccessToken != "" {
-		req.Header.Set("Authorization", "token "+c.opts.AccessToken)
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
 	}
 	if *c.opts.Flags.trace {
 		req.Header.Set("X-Sourcegraph-Should-Trace", "true")
@@ -176,9 +254,25 @@ func (c *client) createHTTPRequest(ctx context.Context, method, p string, body i
 	return req, nil
 }
 
+// getAccessToken returns the access token to authenticate requests with,
+// calling AccessTokenFunc at most once.
+func (c *client) getAccessToken(ctx context.Context) (string, error) {
+	if c.opts.AccessToken != "" || c.opts.AccessTokenFunc == nil {
+		return c.opts.AccessToken, nil
+	}
+
+	c.accessTokenOnce.Do(func() {
+		c.accessToken, c.accessTokenErr = c.opts.AccessTokenFunc(ctx)
+		if c.accessTokenErr != nil {
+			c.accessTokenErr = errors.Wrap(c.accessTokenErr, "getting access token")
+		}
+	})
+	return c.accessToken, c.accessTokenErr
+}
+
 func (r *request) do(ctx context.Context, result interface{}) (bool, error) {
 	if *r.client.opts.Flags.getCurl {
-		curl, err := r.curlCmd()
+		curl, err := r.curlCmd(ctx)
 		if err != nil {
 			return false, err
 		}
@@ -210,23 +304,29 @@ func (r *request) do(ctx context.Context, result interface{}) (bool, error) {
 		return false, err
 	}
 
-	var bufBody io.Reader = bytes.NewBuffer(reqBody)
-	if r.gzip {
-		bufBody = codeintelutils.Gzip(bufBody)
-	}
+	// Create the HTTP request. This is done once per attempt, since the
+	// body can only be read once.
+	newRequest := func() (*http.Request, error) {
+		var bufBody io.Reader = bytes.NewBuffer(reqBody)
+		if r.gzip {
+			bufBody = codeintelutils.Gzip(bufBody)
+		}
 
-	// Create the HTTP request.
-	req, err := r.client.NewHTTPRequest(ctx, "POST", ".api/graphql", bufBody)
-	if err != nil {
-		return false, err
-	}
+		req, err := r.client.NewHTTPRequest(ctx, "POST", ".api/graphql", bufBody)
+		if err != nil {
+			return nil, err
+		}
 
-	if r.gzip {
-		req.Header.Set("Content-Encoding", "gzip")
+		if r.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		return req, nil
 	}
 
-	// Perform the request.
-	resp, err := r.client.httpClient.Do(req)
+	// Perform the request. Queries can always be retried, but mutations
+	// only if the caller has explicitly marked them as safe to retry.
+	retryable := !isMutation(r.query) || isRetrySafe(ctx)
+	resp, err := r.client.doWithRetry(ctx, retryable, newRequest)
 	if err != nil {
 		return false, err
 	}
@@ -308,7 +408,12 @@ type rawResult struct {
 	Errors []interface{} `json:"errors,omitempty"`
 }
 
-func (r *request) curlCmd() (string, error) {
+func (r *request) curlCmd(ctx context.Context) (string, error) {
+	token, err := r.client.getAccessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
 	data, err := json.Marshal(map[string]interface{}{
 		"query":     r.query,
 		"variables": r.vars,
@@ -318,8 +423,8 @@ func (r *request) curlCmd() (string, error) {
 	}
 
 	s := "curl \\\n"
-	if r.client.opts.AccessToken != "" {
-		s += fmt.Sprintf("   %s \\\n", shellquote.Join("-H", "Authorization: token "+r.client.opts.AccessToken))
+	if token != "" {
+		s += fmt.Sprintf("   %s \\\n", shellquote.Join("-H", "Authorization: token "+token))
 	}
 	for k, v := range r.client.opts.AdditionalHeaders {
 		s += fmt.Sprintf("   %s \\\n", shellquote.Join("-H", k+": "+v))
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// NewRoundTripper returns the HTTP round tripper that clients created with
+// the given options use. This is the transport returned by NewTransport,
+// wrapped to record to or replay from a cassette if RecordPath or ReplayPath
+// is set.
+func NewRoundTripper(opts ClientOpts) (http.RoundTripper, error) {
+	if opts.RecordPath != "" && opts.ReplayPath != "" {
+		return nil, errors.New("HTTP interactions can't be recorded and replayed at the same time")
+	}
+
+	if opts.ReplayPath != "" {
+		c, err := openCassette(opts.ReplayPath, false)
+		if err != nil {
+			return nil, err
+		}
+		return &replayTransport{cassette: c}, nil
+	}
+
+	transport, err := NewTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RecordPath != "" {
+		c, err := openCassette(opts.RecordPath, true)
+		if err != nil {
+			return nil, err
+		}
+		return &recordTransport{cassette: c, transport: transport, headers: opts.AdditionalHeaders}, nil
+	}
+	return transport, nil
+}
+
+// cassette is a file of recorded HTTP interactions.
+//
+// Interactions are matched on a fingerprint of the request method, path,
+// query and body, so that cassettes can be replayed against any endpoint.
+// Identical requests are replayed in the order in which they were recorded.
+//
+// Recorded interactions are kept in memory and written to the file by
+// CloseCassettes.
+type cassette struct {
+	path   string
+	record bool
+
+	mu           sync.Mutex
+	interactions []*interaction
+	replayed     map[string]int
+}
+
+// interaction is a recorded HTTP request and its response.
+type interaction struct {
+	Fingerprint string `json:"fingerprint"`
+
+	// GraphQL is set for GraphQL requests, to make cassettes easier to read.
+	GraphQL *graphQLRecord `json:"graphql,omitempty"`
+
+	Request  requestRecord  `json:"request"`
+	Response responseRecord `json:"response"`
+}
+
+type graphQLRecord struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type requestRecord struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	body
+}
+
+type responseRecord struct {
+	StatusCode int         `json:"statusCode"`
+	Headers    http.Header `json:"headers,omitempty"`
+	body
+
+	// Truncated is set if the body wasn't read to the end, because it was
+	// closed early or reading it failed. Only the part that was read is
+	// recorded.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// body is a recorded request or response body. Bodies that aren't valid UTF-8,
+// such as repository archives, are stored base64-encoded.
+type body struct {
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"bodyEncoding,omitempty"`
+}
+
+func newBody(data []byte) body {
+	if utf8.Valid(data) {
+		return body{Body: string(data)}
+	}
+	return body{Body: base64.StdEncoding.EncodeToString(data), BodyEncoding: "base64"}
+}
+
+func (b body) bytes() ([]byte, error) {
+	if b.BodyEncoding == "base64" {
+		return base64.StdEncoding.DecodeString(b.Body)
+	}
+	return []byte(b.Body), nil
+}
+
+type cassetteFile struct {
+	Interactions []*interaction `json:"interactions"`
+}
+
+var (
+	cassettesMu sync.Mutex
+	cassettes   = map[string]*cassette{}
+)
+
+// openCassette returns the cassette at path. All clients in the process share
+// a cassette, so that their interactions end up in the same file. If record is
+// true, the cassette starts out empty.
+func openCassette(path string, record bool) (*cassette, error) {
+	cassettesMu.Lock()
+	defer cassettesMu.Unlock()
+
+	if c, ok := cassettes[path]; ok {
+		return c, nil
+	}
+
+	c := &cassette{path: path, record: record, replayed: map[string]int{}}
+	if !record {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading cassette")
+		}
+		var file cassetteFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, errors.Wrapf(err, "parsing cassette %s", path)
+		}
+		c.interactions = file.Interactions
+	}
+	cassettes[path] = c
+	return c, nil
+}
+
+// CloseCassettes writes the interactions recorded in this process to their
+// cassettes. It must be called before the process exits, and clients must not
+// be used afterwards.
+func CloseCassettes() error {
+	cassettesMu.Lock()
+	defer cassettesMu.Unlock()
+
+	var firstErr error
+	for path, c := range cassettes {
+		if err := c.write(); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "writing cassette %s", path)
+		}
+		delete(cassettes, path)
+	}
+	return firstErr
+}
+
+func (c *cassette) add(i *interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, i)
+}
+
+// write writes the recorded interactions to the cassette file. Nothing is
+// written for cassettes that are replayed.
+func (c *cassette) write() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.record {
+		return nil
+	}
+	data, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, append(data, '\n'), 0600)
+}
+
+// next returns the next recorded interaction with the given fingerprint. Once
+// all of them have been replayed, the last one is repeated.
+func (c *cassette) next(fingerprint string) *interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matches []*interaction
+	for _, i := range c.interactions {
+		if i.Fingerprint == fingerprint {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	n := c.replayed[fingerprint]
+	c.replayed[fingerprint] = n + 1
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	return matches[n]
+}
+
+// readRequestBody reads and restores the body of req, and returns it
+// decompressed if it is gzipped.
+func readRequestBody(req *http.Request) (raw, decoded []byte, err error) {
+	if req.Body == nil {
+		return nil, nil, nil
+	}
+	raw, err = ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	if req.Header.Get("Content-Encoding") != "gzip" {
+		return raw, raw, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	decoded, err = ioutil.ReadAll(zr)
+	return raw, decoded, err
+}
+
+func fingerprint(method, requestURI string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, method+" "+requestURI+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordTransport performs requests with transport and records them to the
+// cassette.
+type recordTransport struct {
+	cassette  *cassette
+	transport http.RoundTripper
+	headers   map[string]string
+}
+
+// sensitiveHeaders are the headers whose values are always scrubbed from
+// cassettes.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	_, body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	scrub := t.scrubber(req)
+	scrubbedBody := []byte(scrub.Replace(string(body)))
+	i := &interaction{
+		Fingerprint: fingerprint(req.Method, req.URL.RequestURI(), body),
+		Request: requestRecord{
+			Method:  req.Method,
+			URL:     scrub.Replace(req.URL.RequestURI()),
+			Headers: scrubHeaders(req.Header, scrub),
+			body:    newBody(scrubbedBody),
+		},
+		Response: responseRecord{
+			StatusCode: resp.StatusCode,
+			Headers:    scrubHeaders(resp.Header, scrub),
+		},
+	}
+	var gql graphQLRecord
+	if json.Unmarshal(scrubbedBody, &gql) == nil && gql.Query != "" {
+		i.GraphQL = &gql
+	}
+
+	// The response body is recorded as it is read, so that streamed
+	// responses such as search results still arrive incrementally.
+	resp.Body = &recordingBody{ReadCloser: resp.Body, done: func(data []byte, truncated bool) {
+		i.Response.body = newBody([]byte(scrub.Replace(string(data))))
+		i.Response.Truncated = truncated
+		t.cassette.add(i)
+	}}
+	return resp, nil
+}
+
+// scrubber returns a replacer that removes the secrets sent with req.
+func (t *recordTransport) scrubber(req *http.Request) *strings.Replacer {
+	var secrets []string
+	for _, name := range sensitiveHeaders {
+		for _, value := range req.Header[http.CanonicalHeaderKey(name)] {
+			secrets = append(secrets, value)
+			// Also scrub the credentials without their scheme, such as the
+			// access token in "token ACCESS_TOKEN".
+			if fields := strings.Fields(value); len(fields) == 2 {
+				secrets = append(secrets, fields[1])
+			}
+		}
+	}
+	for _, value := range t.headers {
+		secrets = append(secrets, value)
+	}
+	if password, ok := req.URL.User.Password(); ok {
+		secrets = append(secrets, password)
+	}
+
+	var oldnew []string
+	for _, secret := range secrets {
+		if secret != "" {
+			oldnew = append(oldnew, secret, "REDACTED")
+		}
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+func scrubHeaders(headers http.Header, scrub *strings.Replacer) http.Header {
+	scrubbed := make(http.Header, len(headers))
+	for name, values := range headers {
+		for _, value := range values {
+			scrubbed.Add(name, scrub.Replace(value))
+		}
+	}
+	for _, name := range sensitiveHeaders {
+		if scrubbed.Get(name) != "" {
+			scrubbed.Set(name, "REDACTED")
+		}
+	}
+	return scrubbed
+}
+
+// recordingBody is a response body that calls done with everything that was
+// read from it once it is closed, and whether that is less than the whole
+// body.
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	eof  bool
+	done func(data []byte, truncated bool)
+	once sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	// The rest of the body isn't read, since streamed responses would only
+	// end once the server ends them.
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.buf.Bytes(), !b.eof) })
+	return err
+}
+
+// replayTransport responds to requests with the interactions recorded in the
+// cassette, without making any network requests.
+type replayTransport struct {
+	cassette *cassette
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	_, body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	i := t.cassette.next(fingerprint(req.Method, req.URL.RequestURI(), body))
+	if i == nil {
+		return nil, errors.Errorf("no recorded response for %s %s in cassette %s", req.Method, req.URL.RequestURI(), t.cassette.path)
+	}
+	respBody, err := i.Response.bytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding recorded response")
+	}
+
+	header := i.Response.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	var r io.Reader = bytes.NewReader(respBody)
+	contentLength := int64(len(respBody))
+	if i.Response.Truncated {
+		// Callers that read past the recorded part of the body get an error,
+		// rather than a body that looks complete.
+		r = io.MultiReader(r, &errReader{err: io.ErrUnexpectedEOF})
+		contentLength = -1
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode)),
+		StatusCode:    i.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(r),
+		ContentLength: contentLength,
+		Request:       req,
+	}, nil
+}
+
+// errReader is a reader that always fails with err.
+type errReader struct{ err error }
+
+func (r *errReader) Read(p []byte) (int, error) { return 0, r.err }
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestCassette(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	path := filepath.Join(dir, "cassette.json")
+	archive := []byte{0x1f, 0x8b, 0x00, 0xff, 0xfe}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if have, want := r.Header.Get("Authorization"), "token secret-token"; have != want {
+			t.Errorf("wrong Authorization header: have=%q want=%q", have, want)
+		}
+		switch r.URL.Path {
+		case "/.api/graphql":
+			var req struct{ Variables map[string]interface{} }
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decoding request: %s", err)
+			}
+			w.Write([]byte(`{"data":{"user":{"username":"` + req.Variables["name"].(string) + `"}}}`))
+		case "/archive":
+			w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	query := `query User($name: String!) { user(username: $name) { username } }`
+	queryUser := func(client Client, name string) string {
+		t.Helper()
+		var result struct{ User struct{ Username string } }
+		if ok, err := client.NewRequest(query, map[string]interface{}{"name": name}).Do(ctx, &result); err != nil || !ok {
+			t.Fatalf("unexpected result: ok=%v err=%v", ok, err)
+		}
+		return result.User.Username
+	}
+	fetchArchive := func(client Client) []byte {
+		t.Helper()
+		req, err := client.NewHTTPRequest(ctx, "GET", "archive", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	recorder := NewClient(ClientOpts{
+		Endpoint:    ts.URL,
+		AccessToken: "secret-token",
+		RecordPath:  path,
+		Out:         ioutil.Discard,
+	})
+	if have := queryUser(recorder, "alice"); have != "alice" {
+		t.Errorf("wrong username: %q", have)
+	}
+	if have := queryUser(recorder, "bob"); have != "bob" {
+		t.Errorf("wrong username: %q", have)
+	}
+	if have := fetchArchive(recorder); !bytes.Equal(have, archive) {
+		t.Errorf("wrong archive: %v", have)
+	}
+	// Secrets are also scrubbed from the GraphQL variables.
+	queryUser(recorder, "secret-token")
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("cassette written before it was closed: %v", err)
+	}
+	if err := CloseCassettes(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Errorf("access token not scrubbed from cassette:\n%s", data)
+	}
+	if !strings.Contains(string(data), `"bodyEncoding": "base64"`) {
+		t.Errorf("binary body not base64-encoded:\n%s", data)
+	}
+
+	// The server is gone: all responses must come from the cassette, no matter
+	// the endpoint or access token.
+	ts.Close()
+	replayer := NewClient(ClientOpts{
+		Endpoint:   "https://sourcegraph.example.com",
+		ReplayPath: path,
+		Out:        ioutil.Discard,
+	})
+	if have := queryUser(replayer, "bob"); have != "bob" {
+		t.Errorf("wrong replayed username: %q", have)
+	}
+	if have := queryUser(replayer, "alice"); have != "alice" {
+		t.Errorf("wrong replayed username: %q", have)
+	}
+	if have := fetchArchive(replayer); !bytes.Equal(have, archive) {
+		t.Errorf("wrong replayed archive: %v", have)
+	}
+
+	var result interface{}
+	_, err = replayer.NewRequest(query, map[string]interface{}{"name": "carol"}).Do(ctx, &result)
+	if err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("unexpected error for unrecorded request: %v", err)
+	}
+}
+
+func TestCassette_Gzip(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "cassette.json")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(ts.Close)
+
+	post := func(transport http.RoundTripper, url string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte("payload"))
+		zw.Close()
+
+		req, err := http.NewRequest("POST", url+"/upload", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return string(data)
+	}
+
+	recorder, err := NewRoundTripper(ClientOpts{RecordPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post(recorder, ts.URL)
+	if err := CloseCassettes(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"body": "payload"`) {
+		t.Errorf("request body not decompressed:\n%s", data)
+	}
+
+	replayer, err := NewRoundTripper(ClientOpts{ReplayPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := post(replayer, "http://example.com"); have != "ok" {
+		t.Errorf("wrong replayed response: %q", have)
+	}
+}
+
+func TestRecordingBody_Close(t *testing.T) {
+	type recording struct {
+		data      string
+		truncated bool
+	}
+	newRecordingBody := func(body io.ReadCloser) (*recordingBody, *[]recording) {
+		var recorded []recording
+		return &recordingBody{ReadCloser: body, done: func(data []byte, truncated bool) {
+			recorded = append(recorded, recording{string(data), truncated})
+		}}, &recorded
+	}
+
+	t.Run("read to the end", func(t *testing.T) {
+		b, recorded := newRecordingBody(ioutil.NopCloser(strings.NewReader("complete")))
+		if _, err := ioutil.ReadAll(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]recording{{"complete", false}}, *recorded, cmp.AllowUnexported(recording{})); diff != "" {
+			t.Errorf("wrong recording (-want +have):\n%s", diff)
+		}
+	})
+
+	t.Run("closed early", func(t *testing.T) {
+		// The stream never ends, so closing must not wait for the rest of it.
+		pr, pw := io.Pipe()
+		go pw.Write([]byte("first result\n"))
+
+		b, recorded := newRecordingBody(pr)
+		buf := make([]byte, len("first result\n"))
+		if _, err := io.ReadFull(b, buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]recording{{"first result\n", true}}, *recorded, cmp.AllowUnexported(recording{})); diff != "" {
+			t.Errorf("wrong recording (-want +have):\n%s", diff)
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		underlying := &failingBody{}
+		b, recorded := newRecordingBody(underlying)
+		if _, err := ioutil.ReadAll(b); err == nil {
+			t.Error("unexpected nil error")
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !underlying.closed {
+			t.Error("underlying body not closed")
+		}
+		if diff := cmp.Diff([]recording{{"", true}}, *recorded, cmp.AllowUnexported(recording{})); diff != "" {
+			t.Errorf("wrong recording (-want +have):\n%s", diff)
+		}
+	})
+}
+
+type failingBody struct{ closed bool }
+
+func (b *failingBody) Read(p []byte) (int, error) { return 0, errors.New("connection reset") }
+func (b *failingBody) Close() error               { b.closed = true; return nil }
+
+func TestReplayTransport_Truncated(t *testing.T) {
+	c := &cassette{
+		interactions: []*interaction{{
+			Fingerprint: fingerprint("GET", "/stream", nil),
+			Response: responseRecord{
+				StatusCode: http.StatusOK,
+				body:       newBody([]byte("first result\n")),
+				Truncated:  true,
+			},
+		}},
+		replayed: map[string]int{},
+	}
+	req, err := http.NewRequest("GET", "http://example.com/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&replayTransport{cassette: c}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("wrong error: %v", err)
+	}
+	if string(data) != "first result\n" {
+		t.Errorf("wrong body: %q", data)
+	}
+}
+
+func TestNewRoundTripper_RecordAndReplay(t *testing.T) {
+	if _, err := NewRoundTripper(ClientOpts{RecordPath: "a", ReplayPath: "b"}); err == nil {
+		t.Error("unexpected nil error")
+	}
+}
@@ -9,6 +9,11 @@ type Flags struct {
 	getCurl            *bool
 	trace              *bool
 	insecureSkipVerify *bool
+	caBundle           *string
+	clientCert         *string
+	clientKey          *string
+	proxy              *string
+	retries            *int
 }
 
 func (f *Flags) Trace() bool {
@@ -26,15 +31,27 @@ func NewFlags(flagSet *flag.FlagSet) *Flags {
 		getCurl:            flagSet.Bool("get-curl", false, "Print the curl command for executing this query and exit (WARNING: includes printing your access token!)"),
 		trace:              flagSet.Bool("trace", false, "Log the trace ID for requests. See https://docs.sourcegraph.com/admin/observability/tracing"),
 		insecureSkipVerify: flagSet.Bool("insecure-skip-verify", false, "Skip validation of TLS certificates against trusted chains"),
+		caBundle:           flagSet.String("ca-bundle", "", "Path to a PEM file of CA certificates to trust in addition to the system roots"),
+		clientCert:         flagSet.String("client-cert", "", "Path to a PEM encoded client certificate for mutual TLS. Requires -client-key"),
+		clientKey:          flagSet.String("client-key", "", "Path to the PEM encoded private key of the client certificate"),
+		proxy:              flagSet.String("proxy", "", "URL of the proxy to send requests through. Defaults to the HTTP_PROXY and HTTPS_PROXY environment variables"),
+		retries:            flagSet.Int("retries", DefaultRetryPolicy.MaxAttempts-1, "Number of times to retry requests that fail with a transient error. Only queries and idempotent requests are retried"),
 	}
 }
 
 func defaultFlags() *Flags {
 	d := false
+	e := ""
+	r := 0
 	return &Flags{
 		dump:               &d,
 		getCurl:            &d,
 		trace:              &d,
 		insecureSkipVerify: &d,
+		caBundle:           &e,
+		clientCert:         &e,
+		clientKey:          &e,
+		proxy:              &e,
+		retries:            &r,
 	}
 }
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPageSize is the number of nodes requested per page when paginating,
+// unless PaginateOpts.PageSize is set.
+const DefaultPageSize = 100
+
+// PaginateOpts describes a GraphQL connection to paginate over.
+type PaginateOpts struct {
+	// Query is the GraphQL query. It must declare the variables $first: Int
+	// and $after: String, pass them to the connection, and request its
+	// nodes and pageInfo { endCursor hasNextPage }.
+	Query string
+
+	// Vars are the other variables of the query.
+	Vars map[string]interface{}
+
+	// Path is the path of fields from the root of the query to the
+	// connection, such as []string{"repositories"}.
+	Path []string
+
+	// Limit is the maximum number of nodes to fetch. If negative, all nodes
+	// are fetched. A limit of 0 is passed to the server as is, in a single
+	// request.
+	Limit int
+
+	// PageSize is the number of nodes requested at once.
+	PageSize int
+
+	// OnPage, if set, is called with each page of the connection before its
+	// nodes, so that other fields of the connection such as totalCount can be
+	// read.
+	OnPage func(connection json.RawMessage) error
+}
+
+// Paginate fetches the nodes of a GraphQL connection page by page, following
+// the end cursor of each page, and calls fn with each node as soon as its page
+// has arrived. This keeps memory bounded and requests small, no matter how
+// large the connection is.
+//
+// Pagination stops when fn returns an error, which is then returned.
+func Paginate(ctx context.Context, client Client, opts PaginateOpts, fn func(node json.RawMessage) error) error {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	var after *string
+	fetched := 0
+	for {
+		first := pageSize
+		if opts.Limit >= 0 && opts.Limit-fetched < first {
+			first = opts.Limit - fetched
+		}
+
+		vars := make(map[string]interface{}, len(opts.Vars)+2)
+		for k, v := range opts.Vars {
+			vars[k] = v
+		}
+		vars["first"] = first
+		vars["after"] = after
+
+		var data json.RawMessage
+		if ok, err := client.NewRequest(opts.Query, vars).Do(ctx, &data); err != nil || !ok {
+			return err
+		}
+		connection, err := lookupPath(data, opts.Path)
+		if err != nil || connection == nil {
+			return err
+		}
+
+		var page struct {
+			Nodes    []json.RawMessage
+			PageInfo struct {
+				EndCursor   *string
+				HasNextPage bool
+			}
+		}
+		if err := json.Unmarshal(connection, &page); err != nil {
+			return errors.Wrapf(err, "parsing page of %s", strings.Join(opts.Path, "."))
+		}
+
+		if opts.OnPage != nil {
+			if err := opts.OnPage(connection); err != nil {
+				return err
+			}
+		}
+		for _, node := range page.Nodes {
+			if err := fn(node); err != nil {
+				return err
+			}
+		}
+		fetched += len(page.Nodes)
+
+		if !page.PageInfo.HasNextPage || len(page.Nodes) == 0 || (opts.Limit >= 0 && fetched >= opts.Limit) {
+			return nil
+		}
+		if page.PageInfo.EndCursor == nil {
+			return errors.Errorf("%s has more results, but the server returned no cursor to fetch them", strings.Join(opts.Path, "."))
+		}
+		after = page.PageInfo.EndCursor
+	}
+}
+
+// lookupPath returns the value at path in the JSON object data, or nil if the
+// value is null.
+func lookupPath(data json.RawMessage, path []string) (json.RawMessage, error) {
+	for i, field := range path {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", strings.Join(path[:i], "."))
+		}
+		if object == nil {
+			return nil, nil
+		}
+		var ok bool
+		if data, ok = object[field]; !ok {
+			return nil, errors.Errorf("field %s not found in result", strings.Join(path[:i+1], "."))
+		}
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	return data, nil
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newPaginatedServer returns a server for a connection of total nodes at
+// registry.items, and records the variables of each request.
+func newPaginatedServer(t *testing.T, total int, withCursor bool) (*httptest.Server, *[]map[string]interface{}) {
+	t.Helper()
+
+	var requests []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]interface{}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding request: %s", err)
+		}
+		requests = append(requests, body.Variables)
+
+		start := 0
+		if after, ok := body.Variables["after"].(string); ok {
+			start, _ = strconv.Atoi(after)
+		}
+		end := start + int(body.Variables["first"].(float64))
+		if end > total {
+			end = total
+		}
+
+		nodes := []map[string]int{}
+		for i := start; i < end; i++ {
+			nodes = append(nodes, map[string]int{"n": i})
+		}
+		var endCursor *string
+		if withCursor {
+			c := strconv.Itoa(end)
+			endCursor = &c
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"registry": map[string]interface{}{
+					"items": map[string]interface{}{
+						"nodes":      nodes,
+						"totalCount": total,
+						"pageInfo": map[string]interface{}{
+							"endCursor":   endCursor,
+							"hasNextPage": end < total,
+						},
+					},
+				},
+			},
+		})
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts, &requests
+}
+
+func TestPaginate(t *testing.T) {
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		total    int
+		limit    int
+		wantN    int
+		wantReqs []map[string]interface{}
+	}{
+		"all": {
+			total: 5,
+			limit: -1,
+			wantN: 5,
+			wantReqs: []map[string]interface{}{
+				{"first": 2.0, "after": nil, "query": "foo"},
+				{"first": 2.0, "after": "2", "query": "foo"},
+				{"first": 2.0, "after": "4", "query": "foo"},
+			},
+		},
+		"limit within page": {
+			total: 5,
+			limit: 3,
+			wantN: 3,
+			wantReqs: []map[string]interface{}{
+				{"first": 2.0, "after": nil, "query": "foo"},
+				{"first": 1.0, "after": "2", "query": "foo"},
+			},
+		},
+		"limit beyond total": {
+			total: 3,
+			limit: 10,
+			wantN: 3,
+			wantReqs: []map[string]interface{}{
+				{"first": 2.0, "after": nil, "query": "foo"},
+				{"first": 2.0, "after": "2", "query": "foo"},
+			},
+		},
+		"empty": {
+			total: 0,
+			limit: -1,
+			wantN: 0,
+			wantReqs: []map[string]interface{}{
+				{"first": 2.0, "after": nil, "query": "foo"},
+			},
+		},
+		"zero limit": {
+			total: 5,
+			limit: 0,
+			wantN: 0,
+			wantReqs: []map[string]interface{}{
+				{"first": 0.0, "after": nil, "query": "foo"},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts, requests := newPaginatedServer(t, tc.total, true)
+			client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+			var nodes []int
+			pages := 0
+			err := Paginate(ctx, client, PaginateOpts{
+				Query:    `query { registry { items { nodes { n } } } }`,
+				Vars:     map[string]interface{}{"query": "foo"},
+				Path:     []string{"registry", "items"},
+				Limit:    tc.limit,
+				PageSize: 2,
+				OnPage: func(connection json.RawMessage) error {
+					pages++
+					return nil
+				},
+			}, func(node json.RawMessage) error {
+				var v struct{ N int }
+				if err := json.Unmarshal(node, &v); err != nil {
+					return err
+				}
+				nodes = append(nodes, v.N)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(nodes) != tc.wantN {
+				t.Errorf("wrong number of nodes: have=%d want=%d", len(nodes), tc.wantN)
+			}
+			for i, n := range nodes {
+				if n != i {
+					t.Errorf("wrong node at %d: %d", i, n)
+				}
+			}
+			if diff := cmp.Diff(tc.wantReqs, *requests); diff != "" {
+				t.Errorf("wrong requests (-want +got):\n%s", diff)
+			}
+			if pages != len(tc.wantReqs) {
+				t.Errorf("wrong number of pages: have=%d want=%d", pages, len(tc.wantReqs))
+			}
+		})
+	}
+
+	t.Run("callback error", func(t *testing.T) {
+		ts, requests := newPaginatedServer(t, 5, true)
+		client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+		want := fmt.Errorf("stop")
+		err := Paginate(ctx, client, PaginateOpts{
+			Path:     []string{"registry", "items"},
+			Limit:    -1,
+			PageSize: 2,
+		}, func(node json.RawMessage) error { return want })
+		if err != want {
+			t.Errorf("wrong error: have=%v want=%v", err, want)
+		}
+		if len(*requests) != 1 {
+			t.Errorf("wrong number of requests: %d", len(*requests))
+		}
+	})
+
+	t.Run("missing cursor", func(t *testing.T) {
+		ts, _ := newPaginatedServer(t, 5, false)
+		client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+		err := Paginate(ctx, client, PaginateOpts{
+			Path:     []string{"registry", "items"},
+			Limit:    -1,
+			PageSize: 2,
+		}, func(node json.RawMessage) error { return nil })
+		if err == nil {
+			t.Error("unexpected nil error")
+		}
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		ts, _ := newPaginatedServer(t, 5, true)
+		client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+
+		err := Paginate(ctx, client, PaginateOpts{
+			Path:  []string{"registry", "other"},
+			Limit: -1,
+		}, func(node json.RawMessage) error { return nil })
+		if err == nil {
+			t.Error("unexpected nil error")
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy configures how the client retries requests that fail with a
+// transient error, such as a network error or a 502 from a load balancer.
+//
+// Only requests that are safe to repeat are retried: GraphQL queries, HTTP
+// requests with an idempotent method, and any request whose context has been
+// marked with WithRetrySafe.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts that will be made, including
+	// the first one. Values less than 2 disable retries.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry. Each subsequent retry
+	// doubles the delay, up to MaxBackoff.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the upper bound on the delay between two attempts. It also
+	// caps delays requested by the server through the Retry-After header.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of the computed delay, between 0 and 1, that is
+	// randomly added or subtracted to avoid many clients retrying in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is the retry policy used when no explicit policy is
+// provided in ClientOpts. The number of attempts is controlled by the -retries
+// flag.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.2,
+}
+
+type retrySafeKey struct{}
+
+// WithRetrySafe returns a context that marks requests made with it as safe to
+// retry, even if they would otherwise not be considered idempotent, such as
+// GraphQL mutations or POST requests.
+func WithRetrySafe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retrySafeKey{}, true)
+}
+
+func isRetrySafe(ctx context.Context) bool {
+	safe, _ := ctx.Value(retrySafeKey{}).(bool)
+	return safe
+}
+
+// isIdempotentMethod returns true if method is defined as idempotent by RFC
+// 7231.
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isMutation returns true if the given GraphQL document contains a mutation
+// operation.
+func isMutation(query string) bool {
+	for _, line := range strings.Split(query, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "mutation") {
+			return true
+		}
+	}
+	return false
+}
+
+// retryableStatus returns true if the status code indicates a transient
+// failure that is worth retrying.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay to wait before the given retry attempt, which
+// starts at 1 for the first retry.
+func (p RetryPolicy) backoff(retry int, resp *http.Response) time.Duration {
+	delay := time.Duration(float64(p.MinBackoff) * math.Pow(2, float64(retry-1)))
+	if p.MaxBackoff > 0 && (delay > p.MaxBackoff || delay <= 0) {
+		delay = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		delta := p.Jitter * float64(delay)
+		delay += time.Duration(delta * (2*rand.Float64() - 1))
+	}
+
+	if resp != nil {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && after > delay {
+			delay = after
+		}
+	}
+
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which can either
+// be a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now), true
+	}
+	return 0, false
+}
+
+// doWithRetry sends the requests returned by newRequest until a response is
+// received that should not be retried, or until the retry policy is
+// exhausted. newRequest is called once per attempt, so that request bodies can
+// be recreated.
+func (c *client) doWithRetry(ctx context.Context, retryable bool, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	attempts := c.retry.MaxAttempts
+	if !retryable || attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if attempt >= attempts || ctx.Err() != nil {
+			return resp, err
+		}
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := c.retry.backoff(attempt, resp)
+		if resp != nil {
+			// Drain the body so that the connection can be reused.
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// rewindableRequest returns a function that returns req on the first call,
+// and a copy of req with a fresh body on subsequent calls. If the body of req
+// cannot be recreated, ok is false.
+func rewindableRequest(req *http.Request) (newRequest func() (*http.Request, error), ok bool) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return func() (*http.Request, error) { return req, nil }, false
+	}
+
+	first := true
+	return func() (*http.Request, error) {
+		if first {
+			first = false
+			return req, nil
+		}
+
+		clone := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "recreating request body")
+			}
+			clone.Body = body
+		}
+		return clone, nil
+	}, true
+}
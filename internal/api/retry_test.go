@@ -0,0 +1,280 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  time.Millisecond,
+	MaxBackoff:  10 * time.Millisecond,
+}
+
+// newFlakyServer returns a server that fails the first failures requests with
+// the given status code before succeeding.
+func newFlakyServer(t *testing.T, failures int32, status int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading body: %s", err)
+		}
+		if r.Method == "POST" && len(body) == 0 {
+			t.Errorf("unexpected empty body on attempt %d", atomic.LoadInt32(&requests)+1)
+		}
+
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"data": {"ok": true}}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts, &requests
+}
+
+func newRetryTestClient(endpoint string) Client {
+	policy := testRetryPolicy
+	return NewClient(ClientOpts{
+		Endpoint:    endpoint,
+		Out:         ioutil.Discard,
+		RetryPolicy: &policy,
+	})
+}
+
+func TestRetry_GraphQL(t *testing.T) {
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		query        string
+		ctx          context.Context
+		failures     int32
+		status       int
+		wantErr      bool
+		wantRequests int32
+	}{
+		"query succeeds after retries": {
+			query:        `query { ok }`,
+			failures:     2,
+			status:       http.StatusBadGateway,
+			wantRequests: 3,
+		},
+		"query gives up after max attempts": {
+			query:        `query { ok }`,
+			failures:     5,
+			status:       http.StatusServiceUnavailable,
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		"query is not retried on non-transient errors": {
+			query:        `query { ok }`,
+			failures:     1,
+			status:       http.StatusInternalServerError,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		"mutation is not retried": {
+			query:        "# comment\nmutation { ok }",
+			failures:     1,
+			status:       http.StatusBadGateway,
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		"mutation marked as safe is retried": {
+			query:        `mutation { ok }`,
+			ctx:          WithRetrySafe(ctx),
+			failures:     1,
+			status:       http.StatusBadGateway,
+			wantRequests: 2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts, requests := newFlakyServer(t, tc.failures, tc.status)
+			client := newRetryTestClient(ts.URL)
+
+			reqCtx := tc.ctx
+			if reqCtx == nil {
+				reqCtx = ctx
+			}
+
+			for _, req := range []Request{
+				client.NewQuery(tc.query),
+				client.NewGzippedQuery(tc.query),
+			} {
+				atomic.StoreInt32(requests, 0)
+
+				var result struct{ OK bool }
+				_, err := req.Do(reqCtx, &result)
+				if tc.wantErr && err == nil {
+					t.Fatal("unexpected nil error")
+				} else if !tc.wantErr && err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if !tc.wantErr && !result.OK {
+					t.Error("result was not unmarshalled")
+				}
+
+				if have := atomic.LoadInt32(requests); have != tc.wantRequests {
+					t.Errorf("wrong number of requests: have=%d want=%d", have, tc.wantRequests)
+				}
+			}
+		})
+	}
+}
+
+func TestRetry_Do(t *testing.T) {
+	ctx := context.Background()
+
+	for name, tc := range map[string]struct {
+		method       string
+		ctx          context.Context
+		wantStatus   int
+		wantRequests int32
+	}{
+		"GET is retried": {
+			method:       "GET",
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		"POST is not retried": {
+			method:       "POST",
+			wantStatus:   http.StatusBadGateway,
+			wantRequests: 1,
+		},
+		"POST marked as safe is retried with its body": {
+			method:       "POST",
+			ctx:          WithRetrySafe(ctx),
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts, requests := newFlakyServer(t, 1, http.StatusBadGateway)
+			client := newRetryTestClient(ts.URL)
+
+			reqCtx := tc.ctx
+			if reqCtx == nil {
+				reqCtx = ctx
+			}
+
+			req, err := client.NewHTTPRequest(reqCtx, tc.method, "foo", bytes.NewBufferString("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("wrong status code: have=%d want=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if have := atomic.LoadInt32(requests); have != tc.wantRequests {
+				t.Errorf("wrong number of requests: have=%d want=%d", have, tc.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetry_ContextCancelled(t *testing.T) {
+	ts, requests := newFlakyServer(t, 5, http.StatusTooManyRequests)
+	policy := RetryPolicy{MaxAttempts: 5, MinBackoff: time.Hour, MaxBackoff: time.Hour}
+	client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard, RetryPolicy: &policy})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.NewQuery(`query { ok }`).Do(ctx, nil); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: have=%v want=%v", err, context.DeadlineExceeded)
+	}
+	if have := atomic.LoadInt32(requests); have != 1 {
+		t.Errorf("wrong number of requests: have=%d want=1", have)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	for retry, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 8 * time.Second,
+		5: 10 * time.Second,
+	} {
+		if have := p.backoff(retry, nil); have != want {
+			t.Errorf("retry %d: wrong backoff: have=%s want=%s", retry, have, want)
+		}
+	}
+
+	t.Run("jitter", func(t *testing.T) {
+		p := p
+		p.Jitter = 0.5
+		for i := 0; i < 100; i++ {
+			if have := p.backoff(2, nil); have < time.Second || have > 3*time.Second {
+				t.Fatalf("backoff out of range: %s", have)
+			}
+		}
+	})
+
+	t.Run("Retry-After", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{"Retry-After": []string{"5"}}}
+		if have, want := p.backoff(1, resp), 5*time.Second; have != want {
+			t.Errorf("wrong backoff: have=%s want=%s", have, want)
+		}
+
+		resp.Header.Set("Retry-After", "3600")
+		if have, want := p.backoff(1, resp), 10*time.Second; have != want {
+			t.Errorf("wrong capped backoff: have=%s want=%s", have, want)
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for value, want := range map[string]time.Duration{
+		"0":                             0,
+		"120":                           2 * time.Minute,
+		"Mon, 01 Mar 2021 12:00:30 GMT": 30 * time.Second,
+	} {
+		have, ok := parseRetryAfter(value, now)
+		if !ok {
+			t.Errorf("%q: unexpected parse failure", value)
+		} else if have != want {
+			t.Errorf("%q: have=%s want=%s", value, have, want)
+		}
+	}
+
+	for _, value := range []string{"", "-1", "soon"} {
+		if _, ok := parseRetryAfter(value, now); ok {
+			t.Errorf("%q: unexpected parse success", value)
+		}
+	}
+}
+
+func TestIsMutation(t *testing.T) {
+	for query, want := range map[string]bool{
+		`query { currentUser { id } }`:         false,
+		`{ currentUser { id } }`:               false,
+		"\n  mutation Foo($x: ID!) { foo }":    true,
+		"# mutation in a comment\nquery { x }": false,
+	} {
+		if have := isMutation(query); have != want {
+			t.Errorf("%q: have=%v want=%v", strings.TrimSpace(query), have, want)
+		}
+	}
+}
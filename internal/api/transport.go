@@ -0,0 +1,113 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// TransportSettings are the TLS and proxy settings that clients created with
+// some options use.
+type TransportSettings struct {
+	InsecureSkipVerify bool
+	CABundlePath       string
+	ClientCertPath     string
+	ClientKeyPath      string
+
+	// ProxyURL is empty if the proxy is taken from the environment.
+	ProxyURL string
+}
+
+// NewTransportSettings returns the TLS and proxy settings for the given
+// options, so that they can also be passed to tools that make their own
+// requests, such as git.
+//
+// Settings given through Flags take precedence over those in opts.
+func NewTransportSettings(opts ClientOpts) TransportSettings {
+	flags := opts.Flags
+	if flags == nil {
+		flags = defaultFlags()
+	}
+
+	return TransportSettings{
+		InsecureSkipVerify: opts.InsecureSkipVerify || (flags.insecureSkipVerify != nil && *flags.insecureSkipVerify),
+		CABundlePath:       flagOrDefault(flags.caBundle, opts.CABundlePath),
+		ClientCertPath:     flagOrDefault(flags.clientCert, opts.ClientCertPath),
+		ClientKeyPath:      flagOrDefault(flags.clientKey, opts.ClientKeyPath),
+		ProxyURL:           flagOrDefault(flags.proxy, opts.ProxyURL),
+	}
+}
+
+// NewTransport returns the HTTP transport that clients created with the given
+// options use, so that requests made outside of Client, such as LSIF uploads,
+// can honor the same TLS and proxy settings.
+//
+// Settings given through Flags take precedence over those in opts.
+func NewTransport(opts ClientOpts) (*http.Transport, error) {
+	settings := NewTransportSettings(opts)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{}
+
+	if settings.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if path := settings.CABundlePath; path != "" {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading CA bundle")
+		}
+
+		// The CA bundle is trusted in addition to the system roots, so that
+		// a bundle for an internal CA doesn't break requests to public hosts.
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in CA bundle %s", path)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certPath, keyPath := settings.ClientCertPath, settings.ClientKeyPath
+	if certPath != "" || keyPath != "" {
+		if certPath == "" || keyPath == "" {
+			return nil, errors.New("both a client certificate and a client key must be given")
+		}
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	// Without an explicit proxy, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// environment variables are honored as by http.DefaultTransport.
+	if proxy := settings.ProxyURL; proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing proxy URL %q", proxy)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.Errorf("invalid proxy URL %q: scheme and host are required", proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	return transport, nil
+}
+
+func flagOrDefault(flag *string, value string) string {
+	if flag != nil && *flag != "" {
+		return *flag
+	}
+	return value
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransport_CABundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"ok": true}}`))
+	}))
+	defer ts.Close()
+
+	dir := tempDir(t)
+	caPath := writePEM(t, dir, "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+
+	t.Run("untrusted", func(t *testing.T) {
+		client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard})
+		if _, err := client.NewQuery(`query { ok }`).Do(context.Background(), nil); err == nil {
+			t.Fatal("unexpected nil error for untrusted certificate")
+		}
+	})
+
+	t.Run("trusted", func(t *testing.T) {
+		client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard, CABundlePath: caPath})
+		if _, err := client.NewQuery(`query { ok }`).Do(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("invalid bundle", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.pem")
+		if err := ioutil.WriteFile(invalid, []byte("not a certificate"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard, CABundlePath: invalid})
+		_, err := client.NewQuery(`query { ok }`).Do(context.Background(), nil)
+		if err == nil || !strings.Contains(err.Error(), "no certificates found") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestTransport_ClientCertificate(t *testing.T) {
+	dir := tempDir(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "src-cli test client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := writePEM(t, dir, "client.pem", "CERTIFICATE", der)
+	keyPath := writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+
+	clientCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"ok": true}}`))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+	caPath := writePEM(t, dir, "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+
+	t.Run("without certificate", func(t *testing.T) {
+		client := NewClient(ClientOpts{Endpoint: ts.URL, Out: ioutil.Discard, CABundlePath: caPath})
+		if _, err := client.NewQuery(`query { ok }`).Do(context.Background(), nil); err == nil {
+			t.Fatal("unexpected nil error without client certificate")
+		}
+	})
+
+	t.Run("with certificate", func(t *testing.T) {
+		client := NewClient(ClientOpts{
+			Endpoint:       ts.URL,
+			Out:            ioutil.Discard,
+			CABundlePath:   caPath,
+			ClientCertPath: certPath,
+			ClientKeyPath:  keyPath,
+		})
+		if _, err := client.NewQuery(`query { ok }`).Do(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("certificate without key", func(t *testing.T) {
+		if _, err := NewTransport(ClientOpts{ClientCertPath: certPath}); err == nil {
+			t.Fatal("unexpected nil error")
+		}
+	})
+}
+
+func TestTransport_Proxy(t *testing.T) {
+	// The proxy receives requests with absolute URLs, and answers them itself
+	// instead of forwarding them.
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte(`{"data": {"ok": true}}`))
+	}))
+	defer proxy.Close()
+
+	client := NewClient(ClientOpts{
+		Endpoint: "http://sourcegraph.example.com",
+		Out:      ioutil.Discard,
+		ProxyURL: proxy.URL,
+	})
+	if _, err := client.NewQuery(`query { ok }`).Do(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://sourcegraph.example.com/.api/graphql"; proxied != want {
+		t.Errorf("wrong proxied URL: have=%q want=%q", proxied, want)
+	}
+
+	t.Run("flag takes precedence", func(t *testing.T) {
+		flags := defaultFlags()
+		invalid := "not a URL"
+		flags.proxy = &invalid
+
+		transport, err := NewTransport(ClientOpts{ProxyURL: proxy.URL, Flags: flags})
+		if err == nil {
+			u, _ := transport.Proxy(&http.Request{URL: &url.URL{Scheme: "http", Host: "example.com"}})
+			t.Fatalf("unexpected nil error, proxy is %v", u)
+		}
+	})
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "src-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -1,8 +1,12 @@
 package batches
 
 import (
+	"bytes"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gobwas/glob"
 	"github.com/hashicorp/go-multierror"
@@ -12,6 +16,7 @@ import (
 	"github.com/sourcegraph/batch-change-utils/yaml"
 	"github.com/sourcegraph/src-cli/internal/batches/docker"
 	"github.com/sourcegraph/src-cli/schema"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 // Some general notes about the struct definitions below.
@@ -39,6 +44,28 @@ type BatchSpec struct {
 	TransformChanges  *TransformChanges        `json:"transformChanges,omitempty" yaml:"transformChanges,omitempty"`
 	ImportChangesets  []ImportChangeset        `json:"importChangesets,omitempty" yaml:"importChangesets"`
 	ChangesetTemplate *ChangesetTemplate       `json:"changesetTemplate,omitempty" yaml:"changesetTemplate"`
+
+	// Resources and Network are the defaults for steps that don't set their
+	// own.
+	Resources *StepResources `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Network   string         `json:"network,omitempty" yaml:"network,omitempty"`
+
+	// Fetch is how repositories are fetched: "archive", the default, or
+	// "git". See FetchMethods.
+	Fetch string `json:"fetch,omitempty" yaml:"fetch,omitempty"`
+
+	// Matrix are the parameters that the steps are run with. Each entry
+	// results in a separate task in every workspace.
+	Matrix []map[string]interface{} `json:"matrix,omitempty" yaml:"matrix,omitempty"`
+}
+
+// matrixEntries returns the entries of the matrix that a task is built for in
+// each workspace. Without a matrix, that is a single nil entry.
+func (spec *BatchSpec) matrixEntries() []map[string]interface{} {
+	if len(spec.Matrix) == 0 {
+		return []map[string]interface{}{nil}
+	}
+	return spec.Matrix
 }
 
 type ChangesetTemplate struct {
@@ -82,12 +109,123 @@ type Step struct {
 	Run       string            `json:"run,omitempty" yaml:"run"`
 	Container string            `json:"container,omitempty" yaml:"container"`
 	Env       env.Environment   `json:"env,omitempty" yaml:"env"`
+	Secrets   Secrets           `json:"secrets,omitempty" yaml:"secrets,omitempty"`
 	Files     map[string]string `json:"files,omitempty" yaml:"files,omitempty"`
 	Outputs   Outputs           `json:"outputs,omitempty" yaml:"outputs,omitempty"`
 
+	IfCondition interface{} `json:"if,omitempty" yaml:"if,omitempty"`
+
+	Timeout      string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries      int    `json:"retries,omitempty" yaml:"retries,omitempty"`
+	AllowFailure bool   `json:"allowFailure,omitempty" yaml:"allowFailure,omitempty"`
+
+	Resources *StepResources `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Network   string         `json:"network,omitempty" yaml:"network,omitempty"`
+
+	Commit *StepCommit `json:"commit,omitempty" yaml:"commit,omitempty"`
+
 	image docker.Image
 }
 
+// StepCommit ends a commit of the changeset after the step that it's set on.
+// The commit contains the changes made since the previous one.
+type StepCommit struct {
+	Message string `json:"message,omitempty" yaml:"message"`
+}
+
+// StepResources limits the resources that the container of a step can use. A
+// zero value means that there is no limit.
+type StepResources struct {
+	CPUs      float64 `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	Memory    string  `json:"memory,omitempty" yaml:"memory,omitempty"`
+	PidsLimit int     `json:"pidsLimit,omitempty" yaml:"pidsLimit,omitempty"`
+}
+
+var memoryLimitPattern = regexp.MustCompile(`^[0-9]+[bkmgBKMG]?$`)
+
+// Validate returns an error if any of the limits is invalid.
+func (r StepResources) Validate() error {
+	if r.CPUs < 0 {
+		return errors.Errorf("cpus must be positive, got %v", r.CPUs)
+	}
+	if r.Memory != "" && !memoryLimitPattern.MatchString(r.Memory) {
+		return errors.Errorf("memory must be a number of bytes with an optional unit (b, k, m or g), got %q", r.Memory)
+	}
+	if r.PidsLimit < 0 {
+		return errors.Errorf("pidsLimit must be positive, got %d", r.PidsLimit)
+	}
+	return nil
+}
+
+// IsZero returns true if no limit is set.
+func (r StepResources) IsZero() bool { return r == StepResources{} }
+
+// withDefaults returns the resources, with the limits that aren't set taken
+// from defaults.
+func (r *StepResources) withDefaults(defaults StepResources) StepResources {
+	if r == nil {
+		return defaults
+	}
+
+	res := *r
+	if res.CPUs == 0 {
+		res.CPUs = defaults.CPUs
+	}
+	if res.Memory == "" {
+		res.Memory = defaults.Memory
+	}
+	if res.PidsLimit == 0 {
+		res.PidsLimit = defaults.PidsLimit
+	}
+	return res
+}
+
+// StepNetworks are the networks that step containers can be attached to.
+var StepNetworks = []string{"none", "bridge", "host"}
+
+// ValidateStepNetwork returns an error if network isn't one of StepNetworks.
+// An empty network is valid, and leaves the choice to the runtime.
+func ValidateStepNetwork(network string) error {
+	if network == "" {
+		return nil
+	}
+	for _, n := range StepNetworks {
+		if network == n {
+			return nil
+		}
+	}
+	return errors.Errorf("network must be one of %s, got %q", strings.Join(StepNetworks, ", "), network)
+}
+
+// timeout returns the maximum duration of a single attempt to execute the
+// step, or 0 if the step has no timeout of its own.
+func (s *Step) timeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("timeout must be positive, got %s", s.Timeout)
+	}
+	return d, nil
+}
+
+// condition returns the "if" condition of the step as a template, or "" if the
+// step has none and should always be executed.
+func (s *Step) condition() string {
+	switch c := s.IfCondition.(type) {
+	case bool:
+		return strconv.FormatBool(c)
+	case string:
+		return c
+	default:
+		return ""
+	}
+}
+
 type Outputs map[string]Output
 
 type Output struct {
@@ -136,6 +274,51 @@ func ParseBatchSpec(data []byte, features featureFlags) (*BatchSpec, error) {
 		}
 	}
 
+	if !features.allowMultipleCommits {
+		for i, step := range spec.Steps {
+			if step.Commit != nil {
+				errs = multierror.Append(errs, errors.Errorf("step %d includes a commit, which is not supported in this Sourcegraph version", i+1))
+			}
+		}
+	}
+
+	if spec.Resources != nil {
+		if err := spec.Resources.Validate(); err != nil {
+			errs = multierror.Append(errs, errors.Wrap(err, "batch spec has invalid resources"))
+		}
+	}
+	if err := ValidateStepNetwork(spec.Network); err != nil {
+		errs = multierror.Append(errs, errors.Wrap(err, "batch spec has an invalid network"))
+	}
+
+	for i, step := range spec.Steps {
+		if _, err := step.timeout(); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "step %d has an invalid timeout", i+1))
+		}
+		if step.Resources != nil {
+			if err := step.Resources.Validate(); err != nil {
+				errs = multierror.Append(errs, errors.Wrapf(err, "step %d has invalid resources", i+1))
+			}
+		}
+		if err := ValidateStepNetwork(step.Network); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "step %d has an invalid network", i+1))
+		}
+		for name, secret := range step.Secrets {
+			if err := secret.validate(); err != nil {
+				errs = multierror.Append(errs, errors.Wrapf(err, "step %d has an invalid secret %s", i+1, name))
+			}
+		}
+
+		// The top-level settings are defaults for all steps.
+		if spec.Resources != nil {
+			resources := step.Resources.withDefaults(*spec.Resources)
+			spec.Steps[i].Resources = &resources
+		}
+		if step.Network == "" {
+			spec.Steps[i].Network = spec.Network
+		}
+	}
+
 	if len(spec.Steps) != 0 && spec.ChangesetTemplate == nil {
 		errs = multierror.Append(errs, errors.New("batch spec includes steps but no changesetTemplate"))
 	}
@@ -151,6 +334,87 @@ func ParseBatchSpec(data []byte, features featureFlags) (*BatchSpec, error) {
 	return &spec, errs.ErrorOrNil()
 }
 
+// clientOnlySpecFields and clientOnlyStepFields are the fields of batch specs
+// and their steps that only src-cli knows about, as opposed to the Sourcegraph
+// instance, whose batch spec schema doesn't allow them.
+var (
+	clientOnlySpecFields = []string{"resources", "network", "fetch", "matrix"}
+	clientOnlyStepFields = []string{"if", "timeout", "retries", "allowFailure", "resources", "network", "secrets", "commit"}
+)
+
+// serverBatchSpec returns the raw batch spec with the fields that only
+// src-cli knows about removed, so that it can be sent to Sourcegraph. The raw
+// spec is returned as it is if it has none of them.
+func serverBatchSpec(raw string) (string, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal([]byte(raw), &doc); err != nil {
+		return "", errors.Wrap(err, "parsing batch spec")
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return raw, nil
+	}
+
+	spec := doc.Content[0]
+	removed := removeMappingKeys(spec, clientOnlySpecFields)
+	if steps := mappingValue(spec, "steps"); steps != nil && steps.Kind == yamlv3.SequenceNode {
+		for _, step := range steps.Content {
+			if step.Kind == yamlv3.MappingNode && removeMappingKeys(step, clientOnlyStepFields) {
+				removed = true
+			}
+		}
+	}
+	if !removed {
+		return raw, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return "", errors.Wrap(err, "serializing batch spec")
+	}
+	if err := enc.Close(); err != nil {
+		return "", errors.Wrap(err, "serializing batch spec")
+	}
+	return buf.String(), nil
+}
+
+// removeMappingKeys removes the given keys from the YAML mapping, and returns
+// true if any of them were present.
+func removeMappingKeys(mapping *yamlv3.Node, keys []string) bool {
+	removed := false
+	content := mapping.Content[:0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if containsString(keys, key.Value) {
+			removed = true
+			continue
+		}
+		content = append(content, key, value)
+	}
+	mapping.Content = content
+	return removed
+}
+
+// mappingValue returns the value of the key in the YAML mapping, or nil.
+func mappingValue(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (on *OnQueryOrRepository) String() string {
 	if on.RepositoriesMatchingQuery != "" {
 		return on.RepositoriesMatchingQuery
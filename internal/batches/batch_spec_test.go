@@ -1,6 +1,10 @@
 package batches
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
 
 func TestParseBatchSpec(t *testing.T) {
 	t.Run("valid", func(t *testing.T) {
@@ -27,6 +31,117 @@ changesetTemplate:
 		}
 	})
 
+	t.Run("step conditions", func(t *testing.T) {
+		const spec = `
+name: hello-world
+on:
+  - repositoriesMatchingQuery: file:README.md
+steps:
+  - run: echo Hello World | tee -a $(find -name README.md)
+    container: alpine:3
+    if: ${{ contains repository.search_result_paths "README.md" }}
+  - run: echo Goodbye
+    container: alpine:3
+    if: false
+changesetTemplate:
+  title: Hello World
+  body: My first batch change!
+  branch: hello-world
+  commit:
+    message: Append Hello World to all README.md files
+`
+
+		parsed, err := ParseBatchSpec([]byte(spec), featureFlags{})
+		if err != nil {
+			t.Fatalf("parsing valid spec returned error: %s", err)
+		}
+		if len(parsed.Steps) != 2 {
+			t.Fatalf("wrong number of steps: %d", len(parsed.Steps))
+		}
+		if have, want := parsed.Steps[0].condition(), `${{ contains repository.search_result_paths "README.md" }}`; have != want {
+			t.Errorf("wrong condition: have=%q want=%q", have, want)
+		}
+		if have, want := parsed.Steps[1].condition(), "false"; have != want {
+			t.Errorf("wrong condition: have=%q want=%q", have, want)
+		}
+	})
+
+	t.Run("step resources", func(t *testing.T) {
+		const spec = `
+name: hello-world
+on:
+  - repositoriesMatchingQuery: file:README.md
+resources:
+  cpus: 2
+  memory: 1g
+network: none
+steps:
+  - run: echo Hello World | tee -a $(find -name README.md)
+    container: alpine:3
+  - run: npm install
+    container: node:14
+    resources:
+      memory: 4g
+      pidsLimit: 100
+    network: bridge
+changesetTemplate:
+  title: Hello World
+  body: My first batch change!
+  branch: hello-world
+  commit:
+    message: Append Hello World to all README.md files
+`
+
+		parsed, err := ParseBatchSpec([]byte(spec), featureFlags{})
+		if err != nil {
+			t.Fatalf("parsing valid spec returned error: %s", err)
+		}
+		if len(parsed.Steps) != 2 {
+			t.Fatalf("wrong number of steps: %d", len(parsed.Steps))
+		}
+
+		// The top-level settings are the defaults for each step.
+		for i, want := range []struct {
+			resources StepResources
+			network   string
+		}{
+			{StepResources{CPUs: 2, Memory: "1g"}, "none"},
+			{StepResources{CPUs: 2, Memory: "4g", PidsLimit: 100}, "bridge"},
+		} {
+			step := parsed.Steps[i]
+			if step.Resources == nil || *step.Resources != want.resources {
+				t.Errorf("wrong resources for step %d: have=%+v want=%+v", i+1, step.Resources, want.resources)
+			}
+			if step.Network != want.network {
+				t.Errorf("wrong network for step %d: have=%q want=%q", i+1, step.Network, want.network)
+			}
+		}
+	})
+
+	t.Run("invalid step resources", func(t *testing.T) {
+		const spec = `
+name: hello-world
+on:
+  - repositoriesMatchingQuery: file:README.md
+steps:
+  - run: echo Hello World | tee -a $(find -name README.md)
+    container: alpine:3
+    resources:
+      memory: lots
+    network: internet
+changesetTemplate:
+  title: Hello World
+  body: My first batch change!
+  branch: hello-world
+  commit:
+    message: Append Hello World to all README.md files
+`
+
+		if _, err := ParseBatchSpec([]byte(spec), featureFlags{}); err == nil {
+			t.Fatal("no error returned")
+		}
+	})
+
 	t.Run("missing changesetTemplate", func(t *testing.T) {
 		const spec = `
 name: hello-world
@@ -46,6 +161,106 @@ steps:
 		wantErr := `1 error occurred:
 	* batch spec includes steps but no changesetTemplate
 
+`
+		haveErr := err.Error()
+		if haveErr != wantErr {
+			t.Fatalf("wrong error. want=%q, have=%q", wantErr, haveErr)
+		}
+	})
+
+	t.Run("matrix", func(t *testing.T) {
+		const spec = `
+name: bump-dependencies
+on:
+  - repositoriesMatchingQuery: file:go.mod
+matrix:
+  - package: github.com/pkg/errors
+    version: v0.9.1
+  - package: github.com/google/go-cmp
+    version: v0.5.5
+steps:
+  - run: go get ${{ matrix.package }}@${{ matrix.version }}
+    container: golang:1.16
+changesetTemplate:
+  title: Bump ${{ matrix.package }} to ${{ matrix.version }}
+  branch: bump/${{ replace matrix.package "/" "-" }}
+  commit:
+    message: Bump ${{ matrix.package }} to ${{ matrix.version }}
+`
+
+		parsed, err := ParseBatchSpec([]byte(spec), featureFlags{})
+		if err != nil {
+			t.Fatalf("parsing valid spec returned error: %s", err)
+		}
+		want := []map[string]interface{}{
+			{"package": "github.com/pkg/errors", "version": "v0.9.1"},
+			{"package": "github.com/google/go-cmp", "version": "v0.5.5"},
+		}
+		if diff := cmp.Diff(want, parsed.Matrix); diff != "" {
+			t.Errorf("wrong matrix (-want +have):\n%s", diff)
+		}
+	})
+
+	t.Run("matrix with constant branch", func(t *testing.T) {
+		const spec = `
+name: bump-dependencies
+on:
+  - repositoriesMatchingQuery: file:go.mod
+matrix:
+  - package: github.com/pkg/errors
+  - package: github.com/google/go-cmp
+steps:
+  - run: go get ${{ matrix.package }}
+    container: golang:1.16
+changesetTemplate:
+  title: Bump ${{ matrix.package }}
+  branch: bump-dependencies
+  commit:
+    message: Bump ${{ matrix.package }}
+`
+
+		// Whether the entries end up on the same branch is only known once
+		// the branch has been rendered, which ValidateChangesetSpecs checks.
+		if _, err := ParseBatchSpec([]byte(spec), featureFlags{}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("step commits", func(t *testing.T) {
+		const spec = `
+name: update-go
+on:
+  - repositoriesMatchingQuery: file:go.mod
+steps:
+  - run: go mod edit -go=1.16
+    container: golang:1.16
+    commit:
+      message: Update go.mod
+  - run: gofmt -w .
+    container: golang:1.16
+changesetTemplate:
+  title: Update Go
+  branch: update-go
+  commit:
+    message: Run gofmt
+`
+
+		parsed, err := ParseBatchSpec([]byte(spec), featureFlags{allowMultipleCommits: true})
+		if err != nil {
+			t.Fatalf("parsing valid spec returned error: %s", err)
+		}
+		if diff := cmp.Diff(&StepCommit{Message: "Update go.mod"}, parsed.Steps[0].Commit); diff != "" {
+			t.Errorf("wrong commit (-want +have):\n%s", diff)
+		}
+
+		_, err = ParseBatchSpec([]byte(spec), featureFlags{})
+		if err == nil {
+			t.Fatal("no error returned")
+		}
+
+		wantErr := `1 error occurred:
+	* step 1 includes a commit, which is not supported in this Sourcegraph version
+
 `
 		haveErr := err.Error()
 		if haveErr != wantErr {
@@ -88,3 +303,103 @@ changesetTemplate:
 		}
 	})
 }
+
+func TestServerBatchSpec(t *testing.T) {
+	t.Run("client-only fields", func(t *testing.T) {
+		spec := `name: hello-world
+# The client-only fields are removed, everything else is kept.
+on:
+  - repositoriesMatchingQuery: file:README.md
+fetch: git
+network: none
+resources:
+  memory: 1g
+matrix:
+  - version: 1
+steps:
+  - run: echo Hello World | tee -a $(find -name README.md)
+    container: alpine:3
+    if: ${{ eq repository.name "github.com/sourcegraph/src-cli" }}
+    timeout: 1m
+    retries: 2
+    allowFailure: true
+    resources:
+      cpus: 1
+    network: bridge
+    secrets:
+      - GITHUB_TOKEN
+    commit:
+      message: Hello
+changesetTemplate:
+  title: Hello World
+  branch: hello-world-${{ matrix.version }}
+  commit:
+    message: Append Hello World to all README.md files
+  published: false
+`
+		have, err := serverBatchSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := `name: hello-world
+# The client-only fields are removed, everything else is kept.
+on:
+  - repositoriesMatchingQuery: file:README.md
+steps:
+  - run: echo Hello World | tee -a $(find -name README.md)
+    container: alpine:3
+changesetTemplate:
+  title: Hello World
+  branch: hello-world-${{ matrix.version }}
+  commit:
+    message: Append Hello World to all README.md files
+  published: false
+`
+		if diff := cmp.Diff(want, have); diff != "" {
+			t.Errorf("wrong server batch spec (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("step commit", func(t *testing.T) {
+		// Only the commit of the changeset template is part of the batch
+		// spec schema of Sourcegraph.
+		spec := `name: update-go
+steps:
+  - run: go mod edit -go=1.16
+    container: golang:1.16
+    commit:
+      message: Update go.mod
+changesetTemplate:
+  commit:
+    message: Run gofmt
+`
+		have, err := serverBatchSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := `name: update-go
+steps:
+  - run: go mod edit -go=1.16
+    container: golang:1.16
+changesetTemplate:
+  commit:
+    message: Run gofmt
+`
+		if diff := cmp.Diff(want, have); diff != "" {
+			t.Errorf("wrong server batch spec (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		spec := `{"name": "hello-world", "steps": [{"run": "echo", "container": "alpine:3"}]}`
+		have, err := serverBatchSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have != spec {
+			t.Errorf("batch spec without client-only fields was changed: %q", have)
+		}
+	})
+}
@@ -23,6 +23,16 @@ type dockerBindWorkspaceCreator struct {
 var _ WorkspaceCreator = &dockerBindWorkspaceCreator{}
 
 func (wc *dockerBindWorkspaceCreator) Create(ctx context.Context, repo *graphql.Repository, steps []Step, archive RepoZip) (Workspace, error) {
+	// Clones already are git repositories with the base commit checked out,
+	// so they can be used as they are.
+	if clone, ok := archive.(*repoClone); ok {
+		dir, err := clone.claim()
+		if err != nil {
+			return nil, err
+		}
+		return &dockerBindWorkspace{dir: dir}, nil
+	}
+
 	w, err := wc.unzipToWorkspace(ctx, repo, archive.Path())
 	if err != nil {
 		return nil, errors.Wrap(err, "unzipping the repository")
@@ -146,6 +156,48 @@ func (w *dockerBindWorkspace) Diff(ctx context.Context) ([]byte, error) {
 	return runGitCmd(ctx, w.dir, "diff", "--cached", "--no-prefix", "--binary")
 }
 
+func (w *dockerBindWorkspace) Snapshot(ctx context.Context) (string, error) {
+	if _, err := runGitCmd(ctx, w.dir, "add", "--all"); err != nil {
+		return "", errors.Wrap(err, "git add failed")
+	}
+
+	// The tree of the index is a snapshot of all files that doesn't need a
+	// commit, so HEAD stays at the base revision.
+	out, err := runGitCmd(ctx, w.dir, "write-tree")
+	if err != nil {
+		return "", errors.Wrap(err, "git write-tree failed")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (w *dockerBindWorkspace) DiffSnapshots(ctx context.Context, from, to string) ([]byte, error) {
+	if err := validateSnapshot(to); err != nil {
+		return nil, err
+	}
+	if from == "" {
+		from = "HEAD"
+	} else if err := validateSnapshot(from); err != nil {
+		return nil, err
+	}
+	return runGitCmd(ctx, w.dir, "diff", "--no-prefix", "--binary", from, to)
+}
+
+func (w *dockerBindWorkspace) Restore(ctx context.Context, snapshot string) error {
+	if err := validateSnapshot(snapshot); err != nil {
+		return err
+	}
+	if _, err := runGitCmd(ctx, w.dir, "read-tree", snapshot); err != nil {
+		return errors.Wrap(err, "git read-tree failed")
+	}
+	if _, err := runGitCmd(ctx, w.dir, "checkout-index", "--all", "--force"); err != nil {
+		return errors.Wrap(err, "git checkout-index failed")
+	}
+	if _, err := runGitCmd(ctx, w.dir, "clean", "-d", "--force"); err != nil {
+		return errors.Wrap(err, "git clean failed")
+	}
+	return nil
+}
+
 func fileExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err != nil {
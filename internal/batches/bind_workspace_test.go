@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/go-diff/diff"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
 )
 
@@ -149,6 +150,96 @@ func TestDockerBindWorkspaceCreator_Create(t *testing.T) {
 			t.Fatalf("wrong files in workspace:\n%s", cmp.Diff(wantFiles, haveUnzippedFiles))
 		}
 	})
+
+	t.Run("snapshots", func(t *testing.T) {
+		ctx := context.Background()
+		testTempDir := workspaceTmpDir(t)
+
+		archive := &fakeRepoArchive{mockPath: archivePath}
+		creator := &dockerBindWorkspaceCreator{dir: testTempDir}
+		workspace, err := creator.Create(ctx, repo, nil, archive)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		t.Cleanup(func() { workspace.Close(ctx) })
+
+		snapshotAfterWriting := func(name, content string) string {
+			if err := ioutil.WriteFile(filepath.Join(*workspace.WorkDir(), name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			snapshot, err := workspace.Snapshot(ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return snapshot
+		}
+		first := snapshotAfterWriting("README.md", "# Hello World\n")
+		second := snapshotAfterWriting("new-file", "new\n")
+
+		for _, tc := range []struct {
+			from, to  string
+			wantFiles []string
+		}{
+			{"", first, []string{"README.md"}},
+			{first, second, []string{"new-file"}},
+			{"", second, []string{"README.md", "new-file"}},
+		} {
+			out, err := workspace.DiffSnapshots(ctx, tc.from, tc.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if have := diffFileNames(t, out); !cmp.Equal(tc.wantFiles, have) {
+				t.Errorf("wrong files in diff from %q to %q:\n%s", tc.from, tc.to, cmp.Diff(tc.wantFiles, have))
+			}
+		}
+
+		// Snapshots don't change the total diff of the workspace.
+		out, err := workspace.Diff(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if have, want := diffFileNames(t, out), []string{"README.md", "new-file"}; !cmp.Equal(want, have) {
+			t.Errorf("wrong files in diff:\n%s", cmp.Diff(want, have))
+		}
+
+		// Restoring a snapshot discards everything that happened after it.
+		snapshotAfterWriting("README.md", "# Goodbye World\n")
+		snapshotAfterWriting("third-file", "third\n")
+		if err := os.Remove(filepath.Join(*workspace.WorkDir(), "new-file")); err != nil {
+			t.Fatal(err)
+		}
+		if err := workspace.Restore(ctx, second); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		out, err = workspace.DiffSnapshots(ctx, second, snapshotAfterWriting("untracked", "untracked\n"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if have, want := diffFileNames(t, out), []string{"untracked"}; !cmp.Equal(want, have) {
+			t.Errorf("wrong files in diff after restoring:\n%s", cmp.Diff(want, have))
+		}
+
+		if err := workspace.Restore(ctx, "HEAD; rm -rf /"); err == nil {
+			t.Error("unexpected nil error for invalid snapshot")
+		}
+		if _, err := workspace.DiffSnapshots(ctx, "", "HEAD; rm -rf /"); err == nil {
+			t.Error("unexpected nil error for invalid snapshot to diff")
+		}
+	})
+}
+
+func diffFileNames(t *testing.T, out []byte) []string {
+	t.Helper()
+
+	fileDiffs, err := diff.ParseMultiFileDiff(out)
+	if err != nil {
+		t.Fatalf("parsing diff: %s", err)
+	}
+	var names []string
+	for _, fd := range fileDiffs {
+		names = append(names, fd.NewName)
+	}
+	return names
 }
 
 func TestMkdirAll(t *testing.T) {
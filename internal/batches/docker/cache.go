@@ -4,13 +4,17 @@ import "sync"
 
 // ImageCache is a cache of metadata about Docker images, indexed by name.
 type ImageCache struct {
+	binary   string
 	images   map[string]Image
 	imagesMu sync.Mutex
 }
 
-// NewImageCache creates a new image cache.
-func NewImageCache() *ImageCache {
+// NewImageCache creates a new image cache. Images are managed with the given
+// binary, which may be docker or any command line tool compatible with it, such
+// as podman. If binary is empty, docker is used.
+func NewImageCache(binary string) *ImageCache {
 	return &ImageCache{
+		binary: binary,
 		images: make(map[string]Image),
 	}
 }
@@ -26,7 +30,7 @@ func (ic *ImageCache) Get(name string) Image {
 		return image
 	}
 
-	image := &image{name: name}
+	image := &image{name: name, binary: ic.binary}
 	ic.images[name] = image
 	return image
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	goexec "os/exec"
 	"strings"
 	"sync"
 
@@ -35,6 +36,10 @@ type Image interface {
 type image struct {
 	name string
 
+	// binary is the Docker compatible command line tool used to manage the
+	// image. If empty, docker is used.
+	binary string
+
 	// There are lots of once fields below: basically, we're going to try fairly
 	// hard to prevent performing the same operations on the same image over and
 	// over, since some of them are expensive.
@@ -69,7 +74,7 @@ func (image *image) Digest(ctx context.Context) (string, error) {
 			// the digest. but the digest is not calculated for all images
 			// (unless they are pulled/pushed from/to a registry), see
 			// https://github.com/moby/moby/issues/32016.
-			out, err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", "--", image.name).CombinedOutput()
+			out, err := image.command(ctx, "image", "inspect", "--format", "{{.Id}}", "--", image.name).CombinedOutput()
 			if err != nil {
 				return "", errors.Wrapf(err, "inspecting docker image: %s", string(bytes.TrimSpace(out)))
 			}
@@ -91,9 +96,9 @@ func (image *image) Ensure(ctx context.Context) error {
 		image.ensureErr = func() error {
 			// docker image inspect will return a non-zero exit code if the image and
 			// tag don't exist locally, regardless of the format.
-			if err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "1", image.name).Run(); err != nil {
+			if err := image.command(ctx, "image", "inspect", "--format", "1", image.name).Run(); err != nil {
 				// Let's try pulling the image.
-				if err := exec.CommandContext(ctx, "docker", "image", "pull", image.name).Run(); err != nil {
+				if err := image.command(ctx, "image", "pull", image.name).Run(); err != nil {
 					return errors.Wrap(err, "pulling image")
 				}
 			}
@@ -124,7 +129,7 @@ func (image *image) UIDGID(ctx context.Context) (UIDGID, error) {
 				digest,
 				"-c", "id -u; id -g",
 			}
-			cmd := exec.CommandContext(ctx, "docker", args...)
+			cmd := image.command(ctx, args...)
 			cmd.Stdout = stdout
 
 			if err := cmd.Run(); err != nil {
@@ -145,3 +150,11 @@ func (image *image) UIDGID(ctx context.Context) (UIDGID, error) {
 
 	return image.uidGid, image.uidGidErr
 }
+
+func (image *image) command(ctx context.Context, args ...string) *goexec.Cmd {
+	binary := image.binary
+	if binary == "" {
+		binary = "docker"
+	}
+	return exec.CommandContext(ctx, binary, args...)
+}
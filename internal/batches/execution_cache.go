@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -46,12 +47,32 @@ func (key ExecutionCacheKey) Key() (string, error) {
 		envs[i] = env
 	}
 
+	// The same goes for secrets, except that only their hashes are included,
+	// so that the key can't leak them. Steps without secrets don't affect the
+	// key at all, so that existing cache entries remain valid.
+	var secrets []map[string]string
+	for i, step := range key.Task.Steps {
+		if len(step.Secrets) == 0 {
+			continue
+		}
+		values, err := step.Secrets.resolve(global)
+		if err != nil {
+			return "", errors.Wrapf(err, "resolving secrets for step %d", i)
+		}
+		if secrets == nil {
+			secrets = make([]map[string]string, len(key.Task.Steps))
+		}
+		secrets[i] = hashSecrets(values)
+	}
+
 	raw, err := json.Marshal(struct {
 		*Task
 		Environments []map[string]string
+		Secrets      []map[string]string `json:",omitempty"`
 	}{
 		Task:         key.Task,
 		Environments: envs,
+		Secrets:      secrets,
 	})
 	if err != nil {
 		return "", err
@@ -73,6 +94,11 @@ type ExecutionDiskCache struct {
 
 const cacheFileExt = ".v3.json"
 
+// cacheMetadataExt is the extension of the files next to the cache files that
+// contain their ExecutionCacheMetadata. They are kept separate, so that the
+// entries can be listed without reading the results.
+const cacheMetadataExt = ".meta.json"
+
 func (c ExecutionDiskCache) cacheFilePath(key ExecutionCacheKey) (string, error) {
 	keyString, err := key.Key()
 	if err != nil {
@@ -122,6 +148,7 @@ func (c ExecutionDiskCache) readCacheFile(path string, result *executionResult)
 		if err := os.Remove(path); err != nil {
 			return errors.Wrap(err, "while deleting cache file with invalid JSON")
 		}
+		removeMetadataFile(path)
 		return errors.Wrapf(err, "reading cache file %s", path)
 	}
 	return nil
@@ -142,7 +169,19 @@ func (c ExecutionDiskCache) Set(ctx context.Context, key ExecutionCacheKey, resu
 		return err
 	}
 
-	return ioutil.WriteFile(path, raw, 0600)
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		return err
+	}
+
+	metadata := newExecutionCacheMetadata(key.Task)
+	if metadata == nil {
+		return nil
+	}
+	raw, err = json.Marshal(metadata)
+	if err != nil {
+		return errors.Wrap(err, "serializing cache metadata to JSON")
+	}
+	return ioutil.WriteFile(metadataFilePath(path), raw, 0600)
 }
 
 func (c ExecutionDiskCache) Clear(ctx context.Context, key ExecutionCacheKey) error {
@@ -155,7 +194,168 @@ func (c ExecutionDiskCache) Clear(ctx context.Context, key ExecutionCacheKey) er
 		return nil
 	}
 
-	return os.Remove(path)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	removeMetadataFile(path)
+	return nil
+}
+
+// metadataFilePath returns the path of the metadata file that belongs to the
+// cache file at path.
+func metadataFilePath(path string) string {
+	return strings.TrimSuffix(path, cacheFileExt) + cacheMetadataExt
+}
+
+// removeMetadataFile removes the metadata file of the cache file at path, if
+// there is one. The metadata only describes the entry, so failing to remove it
+// doesn't affect looking up results.
+func removeMetadataFile(path string) {
+	os.Remove(metadataFilePath(path))
+}
+
+// executionCacheFile is the content of a remote cache entry. The metadata isn't
+// used to look up results, but describes the entry to whoever manages the
+// store.
+type executionCacheFile struct {
+	executionResult
+	Metadata *ExecutionCacheMetadata `json:"metadata,omitempty"`
+}
+
+// ExecutionCacheMetadata describes the task whose result is stored in a cache
+// entry. Entries written by older versions of src don't have metadata.
+type ExecutionCacheMetadata struct {
+	Repository   string `json:"repository"`
+	RepositoryID string `json:"repositoryID"`
+	Path         string `json:"path"`
+	BatchChange  string `json:"batchChange,omitempty"`
+}
+
+func newExecutionCacheMetadata(task *Task) *ExecutionCacheMetadata {
+	if task == nil {
+		return nil
+	}
+
+	metadata := &ExecutionCacheMetadata{Path: task.Path}
+	if task.Repository != nil {
+		metadata.Repository = task.Repository.Name
+		metadata.RepositoryID = task.Repository.ID
+	}
+	if task.BatchChangeAttributes != nil {
+		metadata.BatchChange = task.BatchChangeAttributes.Name
+	}
+	return metadata
+}
+
+// ExecutionCacheEntry is a result stored in an ExecutionDiskCache.
+type ExecutionCacheEntry struct {
+	Key     string
+	File    string
+	Size    int64
+	ModTime time.Time
+
+	// Metadata is nil if the entry was written by an older version of src, or
+	// if its metadata file can't be read.
+	Metadata *ExecutionCacheMetadata
+}
+
+// ExecutionCacheDetails is an entry together with the result stored in it.
+type ExecutionCacheDetails struct {
+	ExecutionCacheEntry
+	executionResult
+}
+
+// Entries returns all entries in the cache, sorted from oldest to newest. A
+// cache directory that doesn't exist yet is empty. Only the metadata files are
+// read, so entries with invalid results are listed too and can be removed.
+func (c ExecutionDiskCache) Entries() ([]ExecutionCacheEntry, error) {
+	infos, err := ioutil.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []ExecutionCacheEntry
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), cacheFileExt) {
+			continue
+		}
+
+		entries = append(entries, c.newEntry(info))
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime.Before(entries[j].ModTime)
+	})
+	return entries, nil
+}
+
+// Inspect returns the entry with the given key, as shown by Entries, and the
+// result stored in it.
+func (c ExecutionDiskCache) Inspect(key string) (*ExecutionCacheDetails, error) {
+	info, err := os.Stat(c.entryPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("no cache entry with key %q", key)
+		}
+		return nil, err
+	}
+
+	entry := c.newEntry(info)
+	data, err := ioutil.ReadFile(entry.File)
+	if err != nil {
+		return nil, err
+	}
+	// Unlike when looking up results, invalid entries are reported, but not
+	// deleted: they can be removed with the cache commands.
+	var result executionResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errors.Wrapf(err, "reading cache file %s", entry.File)
+	}
+
+	return &ExecutionCacheDetails{
+		ExecutionCacheEntry: entry,
+		executionResult:     result,
+	}, nil
+}
+
+// Remove deletes the entry with the given key. Entries that don't exist are
+// ignored.
+func (c ExecutionDiskCache) Remove(key string) error {
+	path := c.entryPath(key)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(metadataFilePath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (c ExecutionDiskCache) entryPath(key string) string {
+	// Keys are base64 encoded and can't contain path separators, but make sure
+	// that a key given on the command line can't point outside the cache.
+	return filepath.Join(c.Dir, filepath.Base(key)+cacheFileExt)
+}
+
+func (c ExecutionDiskCache) newEntry(info os.FileInfo) ExecutionCacheEntry {
+	path := filepath.Join(c.Dir, info.Name())
+	entry := ExecutionCacheEntry{
+		Key:     strings.TrimSuffix(info.Name(), cacheFileExt),
+		File:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+
+	// Missing or invalid metadata only means that the entry can't be described.
+	if data, err := ioutil.ReadFile(metadataFilePath(path)); err == nil {
+		var metadata ExecutionCacheMetadata
+		if err := json.Unmarshal(data, &metadata); err == nil {
+			entry.Metadata = &metadata
+		}
+	}
+	return entry
 }
 
 // ExecutionNoOpCache is an implementation of actionExecutionCache that does not store or
@@ -15,6 +15,43 @@ import (
 
 const testExecutionCacheKeyEnv = "TEST_EXECUTION_CACHE_KEY_ENV"
 
+func TestExecutionCacheKey_Secrets(t *testing.T) {
+	const secretEnv = testExecutionCacheKeyEnv + "_SECRET"
+	os.Setenv(secretEnv, "hunter2")
+	t.Cleanup(func() { os.Unsetenv(secretEnv) })
+
+	key := ExecutionCacheKey{&Task{Steps: []Step{
+		{Run: "foo", Secrets: Secrets{"TOKEN": {Env: secretEnv}}},
+	}}}
+	initial, err := key.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the value of the secret must change the key.
+	os.Setenv(secretEnv, "hunter3")
+	have, err := key.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have == initial {
+		t.Errorf("unexpected lack of change in key: %q", have)
+	}
+
+	// An empty set of secrets must not affect the key.
+	plain, err := ExecutionCacheKey{&Task{Steps: []Step{{Run: "foo"}}}}.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := ExecutionCacheKey{&Task{Steps: []Step{{Run: "foo", Secrets: Secrets{}}}}}.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain != empty {
+		t.Errorf("empty secrets changed key: have=%q want=%q", empty, plain)
+	}
+}
+
 func TestExecutionCacheKey(t *testing.T) {
 	// Let's set up an array of steps that we can test with. One step will
 	// depend on an environment variable outside the spec.
@@ -163,6 +200,113 @@ func TestExecutionDiskCache(t *testing.T) {
 		}
 		assertCacheMiss(t, cache, cacheKey1)
 	})
+
+	t.Run("entries", func(t *testing.T) {
+		cache := ExecutionDiskCache{Dir: cacheTmpDir(t)}
+		t.Cleanup(func() { os.RemoveAll(cache.Dir) })
+
+		entries, err := cache.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("unexpected entries in empty cache: %+v", entries)
+		}
+
+		withAttributes := ExecutionCacheKey{Task: &Task{
+			Repository:            &graphql.Repository{ID: "repo-id", Name: "src-cli"},
+			Path:                  "sub",
+			Steps:                 cacheKey1.Steps,
+			BatchChangeAttributes: &BatchChangeAttributes{Name: "hello-world"},
+		}}
+		if err := cache.Set(ctx, withAttributes, value); err != nil {
+			t.Fatal(err)
+		}
+		// Entries written by older versions of src have no metadata.
+		key2, err := cacheKey2.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := json.Marshal(&value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(cache.Dir, key2+cacheFileExt), raw, 0600); err != nil {
+			t.Fatal(err)
+		}
+		// Invalid entries are listed without metadata, so that they can be
+		// removed.
+		if err := ioutil.WriteFile(filepath.Join(cache.Dir, "invalid"+cacheFileExt), []byte("{"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, err = cache.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 3 {
+			t.Fatalf("wrong number of entries: %+v", entries)
+		}
+		metadata := map[string]*ExecutionCacheMetadata{}
+		for _, entry := range entries {
+			if entry.Size == 0 || entry.File == "" {
+				t.Errorf("entry is missing file information: %+v", entry)
+			}
+			metadata[entry.Key] = entry.Metadata
+		}
+		key1, err := withAttributes.Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]*ExecutionCacheMetadata{
+			key1:      {Repository: "src-cli", RepositoryID: "repo-id", Path: "sub", BatchChange: "hello-world"},
+			key2:      nil,
+			"invalid": nil,
+		}
+		if diff := cmp.Diff(want, metadata); diff != "" {
+			t.Errorf("wrong metadata (-want +got):\n%s", diff)
+		}
+
+		details, err := cache.Inspect(key1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if details.Diff != value.Diff || details.Metadata == nil {
+			t.Errorf("wrong details: %+v", details)
+		}
+		if _, err := cache.Inspect("missing"); err == nil {
+			t.Error("unexpected nil error for missing entry")
+		}
+		if _, err := cache.Inspect("invalid"); err == nil {
+			t.Error("unexpected nil error for invalid entry")
+		}
+		if err := cache.Remove("invalid"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The metadata doesn't get in the way of looking up results.
+		assertCacheHit(t, cache, withAttributes, value)
+
+		if err := cache.Remove(key1); err != nil {
+			t.Fatal(err)
+		}
+		assertCacheMiss(t, cache, withAttributes)
+		if err := cache.Remove(key1); err != nil {
+			t.Errorf("unexpected error removing missing entry: %s", err)
+		}
+
+		entries, err = cache.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Key != key2 {
+			t.Errorf("wrong entries after removing: %+v", entries)
+		}
+		// The metadata files are removed together with their entries.
+		if _, err := os.Stat(filepath.Join(cache.Dir, key1+cacheMetadataExt)); !os.IsNotExist(err) {
+			t.Errorf("metadata file wasn't removed: %v", err)
+		}
+	})
 }
 
 func TestSortCacheFiles(t *testing.T) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -69,6 +70,10 @@ type Task struct {
 	Steps   []Step
 	Outputs map[string]interface{}
 
+	// Matrix is the entry of the batch spec's matrix that the steps are run
+	// with, if it has one.
+	Matrix map[string]interface{} `json:",omitempty"`
+
 	BatchChangeAttributes *BatchChangeAttributes `json:"-"`
 	Template              *ChangesetTemplate     `json:"-"`
 	TransformChanges      *TransformChanges      `json:"-"`
@@ -90,6 +95,7 @@ func (t *Task) cacheKey() ExecutionCacheKey {
 type TaskStatus struct {
 	RepoName string
 	Path     string
+	Matrix   map[string]interface{}
 
 	Cached bool
 
@@ -101,6 +107,16 @@ type TaskStatus struct {
 	// TODO: add current step and progress fields.
 	CurrentlyExecuting string
 
+	// SkippedSteps are the numbers, starting at 1, of the steps that were
+	// skipped because their "if" condition wasn't met.
+	SkippedSteps []int
+	// FailedSteps are the numbers, starting at 1, of the steps that failed
+	// but allowed failure.
+	FailedSteps []int
+
+	// Outputs are the outputs produced by the steps.
+	Outputs map[string]interface{}
+
 	// ChangesetSpecs are the specs produced by executing the Task in a
 	// repository. With the introduction of `transformChanges` to the batch
 	// spec, one Task can produce multiple ChangesetSpecs.
@@ -114,10 +130,30 @@ type TaskStatus struct {
 }
 
 func (ts *TaskStatus) DisplayName() string {
+	name := ts.RepoName
 	if ts.Path != "" {
-		return ts.RepoName + ":" + ts.Path
+		name += ":" + ts.Path
+	}
+	if len(ts.Matrix) > 0 {
+		name += " (" + describeMatrixEntry(ts.Matrix) + ")"
 	}
-	return ts.RepoName
+	return name
+}
+
+// describeMatrixEntry returns the parameters of a matrix entry as key=value
+// pairs, sorted by key.
+func describeMatrixEntry(entry map[string]interface{}) string {
+	keys := make([]string, 0, len(entry))
+	for k := range entry {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", k, entry[k])
+	}
+	return strings.Join(pairs, ", ")
 }
 
 func (ts *TaskStatus) IsRunning() bool {
@@ -145,13 +181,15 @@ func (ts *TaskStatus) FileDiffs() ([]*diff.FileDiff, bool, error) {
 		var all []*diff.FileDiff
 
 		for _, spec := range ts.ChangesetSpecs {
-			fd, err := diff.ParseMultiFileDiff([]byte(spec.Commits[0].Diff))
-			if err != nil {
-				ts.fileDiffsErr = err
-				return
-			}
+			for _, commit := range spec.Commits {
+				fd, err := diff.ParseMultiFileDiff([]byte(commit.Diff))
+				if err != nil {
+					ts.fileDiffsErr = err
+					return
+				}
 
-			all = append(all, fd...)
+				all = append(all, fd...)
+			}
 		}
 
 		ts.fileDiffs = all
@@ -166,9 +204,20 @@ type ExecutorOpts struct {
 	Parallelism int
 	Timeout     time.Duration
 
+	// Runtime runs the steps of each task. If nil, Docker is used.
+	Runtime Runtime
+
+	// Resources and Network are the defaults for steps that set neither in
+	// the step nor at the top level of the batch spec.
+	Resources StepResources
+	Network   string
+
 	ClearCache bool
 	KeepLogs   bool
 	TempDir    string
+
+	// Journal, if set, records the outcome of each task as it finishes.
+	Journal *RunJournal
 }
 
 type executor struct {
@@ -194,6 +243,10 @@ type executor struct {
 }
 
 func newExecutor(opts ExecutorOpts, client api.Client, features featureFlags) *executor {
+	if opts.Runtime == nil {
+		opts.Runtime = defaultRuntime
+	}
+
 	return &executor{
 		ExecutorOpts:  opts,
 		cache:         opts.Cache,
@@ -213,7 +266,7 @@ func (x *executor) AddTask(task *Task) {
 	x.tasks = append(x.tasks, task)
 
 	x.statusesMu.Lock()
-	x.statuses[task] = &TaskStatus{RepoName: task.Repository.Name, Path: task.Path, EnqueuedAt: time.Now()}
+	x.statuses[task] = &TaskStatus{RepoName: task.Repository.Name, Path: task.Path, Matrix: task.Matrix, EnqueuedAt: time.Now()}
 	x.statusesMu.Unlock()
 }
 
@@ -274,11 +327,19 @@ func (x *executor) Wait(ctx context.Context) ([]*ChangesetSpec, error) {
 func (x *executor) do(ctx context.Context, task *Task) (err error) {
 	// Ensure that the status is updated when we're done.
 	defer func() {
+		var specs []*ChangesetSpec
 		x.updateTaskStatus(task, func(status *TaskStatus) {
 			status.FinishedAt = time.Now()
 			status.CurrentlyExecuting = ""
 			status.Err = err
+			specs = status.ChangesetSpecs
 		})
+
+		if x.Journal != nil {
+			if journalErr := x.Journal.TaskFinished(task, specs, err); journalErr != nil && err == nil {
+				err = journalErr
+			}
+		}
 	}()
 
 	// We're away!
@@ -312,6 +373,9 @@ func (x *executor) do(ctx context.Context, task *Task) (err error) {
 			if result.Diff == "" {
 				x.updateTaskStatus(task, func(status *TaskStatus) {
 					status.Cached = true
+					status.SkippedSteps = result.SkippedSteps
+					status.FailedSteps = result.FailedSteps
+					status.Outputs = result.Outputs
 					status.FinishedAt = time.Now()
 
 				})
@@ -327,6 +391,9 @@ func (x *executor) do(ctx context.Context, task *Task) (err error) {
 			x.updateTaskStatus(task, func(status *TaskStatus) {
 				status.ChangesetSpecs = specs
 				status.Cached = true
+				status.SkippedSteps = result.SkippedSteps
+				status.FailedSteps = result.FailedSteps
+				status.Outputs = result.Outputs
 				status.FinishedAt = time.Now()
 			})
 
@@ -357,6 +424,9 @@ func (x *executor) do(ctx context.Context, task *Task) (err error) {
 		}
 		log.Close()
 	}()
+	x.updateTaskStatus(task, func(status *TaskStatus) {
+		status.LogFile = log.Path()
+	})
 
 	// Set up our timeout.
 	runCtx, cancel := context.WithTimeout(ctx, x.Timeout)
@@ -370,8 +440,12 @@ func (x *executor) do(ctx context.Context, task *Task) (err error) {
 		repo:                  task.Repository,
 		path:                  task.Path,
 		steps:                 task.Steps,
+		matrix:                task.Matrix,
 		logger:                log,
 		tempDir:               x.tempDir,
+		runtime:               x.Runtime,
+		resources:             x.Resources,
+		network:               x.Network,
 		reportProgress: func(currentlyExecuting string) {
 			x.updateTaskStatus(task, func(status *TaskStatus) {
 				status.CurrentlyExecuting = currentlyExecuting
@@ -386,6 +460,12 @@ func (x *executor) do(ctx context.Context, task *Task) (err error) {
 		return
 	}
 
+	x.updateTaskStatus(task, func(status *TaskStatus) {
+		status.SkippedSteps = result.SkippedSteps
+		status.FailedSteps = result.FailedSteps
+		status.Outputs = result.Outputs
+	})
+
 	// Build the changeset specs.
 	specs, err := createChangesetSpecs(task, result, x.features)
 	if err != nil {
@@ -472,6 +552,7 @@ func createChangesetSpecs(task *Task, result executionResult, features featureFl
 		},
 		Outputs:    result.Outputs,
 		Repository: *task.Repository,
+		Matrix:     task.Matrix,
 	}
 
 	var authorName string
@@ -518,7 +599,21 @@ func createChangesetSpecs(task *Task, result executionResult, features featureFl
 		return nil, err
 	}
 
-	newSpec := func(branch, diff string) *ChangesetSpec {
+	// newCommit returns a commit with the given diff. Commits without a
+	// message of their own use the message of the changeset template.
+	newCommit := func(commitMessage, diff string) GitCommitDescription {
+		if commitMessage == "" {
+			commitMessage = message
+		}
+		return GitCommitDescription{
+			Message:     commitMessage,
+			AuthorName:  authorName,
+			AuthorEmail: authorEmail,
+			Diff:        diff,
+		}
+	}
+
+	newSpec := func(branch string, commits []GitCommitDescription) *ChangesetSpec {
 		return &ChangesetSpec{
 			BaseRepository: task.Repository.ID,
 			CreatedChangeset: &CreatedChangeset{
@@ -528,15 +623,8 @@ func createChangesetSpecs(task *Task, result executionResult, features featureFl
 				HeadRef:        "refs/heads/" + branch,
 				Title:          title,
 				Body:           body,
-				Commits: []GitCommitDescription{
-					{
-						Message:     message,
-						AuthorName:  authorName,
-						AuthorEmail: authorEmail,
-						Diff:        diff,
-					},
-				},
-				Published: task.Template.Published.ValueWithSuffix(repo, branch),
+				Commits:        commits,
+				Published:      task.Template.Published.ValueWithSuffix(repo, branch),
 			},
 		}
 	}
@@ -556,11 +644,36 @@ func createChangesetSpecs(task *Task, result executionResult, features featureFl
 			return specs, errors.Wrap(err, "grouping diffs failed")
 		}
 
+		// The changes of each commit ended by a step are split up between
+		// the changesets in the same way.
+		commitsByBranch := make(map[string][]GitCommitDescription)
+		for _, c := range result.Commits {
+			commitDiffsByBranch, err := groupFileDiffs(c.Diff, defaultBranch, groups)
+			if err != nil {
+				return specs, errors.Wrap(err, "grouping diffs failed")
+			}
+			for branch, diff := range commitDiffsByBranch {
+				if diff != "" {
+					commitsByBranch[branch] = append(commitsByBranch[branch], newCommit(c.Message, diff))
+				}
+			}
+		}
+
 		for branch, diff := range diffsByBranch {
-			specs = append(specs, newSpec(branch, diff))
+			commits, ok := commitsByBranch[branch]
+			if !ok {
+				commits = []GitCommitDescription{newCommit("", diff)}
+			}
+			specs = append(specs, newSpec(branch, commits))
+		}
+	} else if len(result.Commits) > 0 {
+		commits := make([]GitCommitDescription, len(result.Commits))
+		for i, c := range result.Commits {
+			commits[i] = newCommit(c.Message, c.Diff)
 		}
+		specs = append(specs, newSpec(defaultBranch, commits))
 	} else {
-		specs = append(specs, newSpec(defaultBranch, result.Diff))
+		specs = append(specs, newSpec(defaultBranch, []GitCommitDescription{newCommit("", result.Diff)}))
 	}
 
 	return specs, nil
@@ -33,6 +33,14 @@ func TestExecutor_Integration(t *testing.T) {
 
 	addToPath(t, "testdata/dummydocker")
 
+	oldDelay := stepRetryBaseDelay
+	stepRetryBaseDelay = 0
+	t.Cleanup(func() { stepRetryBaseDelay = oldDelay })
+
+	const secretEnv = "TEST_EXECUTOR_INTEGRATION_SECRET"
+	os.Setenv(secretEnv, "hunter2")
+	t.Cleanup(func() { os.Unsetenv(secretEnv) })
+
 	srcCLIRepo := &graphql.Repository{
 		ID:            "src-cli",
 		Name:          "github.com/sourcegraph/src-cli",
@@ -48,6 +56,15 @@ func TestExecutor_Integration(t *testing.T) {
 		},
 	}
 
+	// The retried step marks its first attempt outside of the workspace, so
+	// that the workspace itself only contains what the last attempt did.
+	markerDir, err := ioutil.TempDir("", "executor-integration-marker-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(markerDir) })
+	attemptedMarker := filepath.Join(markerDir, "attempted")
+
 	changesetTemplateBranch := "my-branch"
 	defaultTemplate := &ChangesetTemplate{Branch: changesetTemplateBranch}
 	defaultBatchChangeAttributes := &BatchChangeAttributes{
@@ -73,12 +90,13 @@ func TestExecutor_Integration(t *testing.T) {
 
 		executorTimeout time.Duration
 
-		wantFilesChanged  filesByRepository
-		wantTitle         string
-		wantBody          string
-		wantCommitMessage string
-		wantAuthorName    string
-		wantAuthorEmail   string
+		wantFilesChanged   filesByRepository
+		wantTitle          string
+		wantBody           string
+		wantCommitMessage  string
+		wantCommitMessages []string
+		wantAuthorName     string
+		wantAuthorEmail    string
 
 		wantErrInclude string
 	}{
@@ -152,6 +170,116 @@ func TestExecutor_Integration(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "conditional steps",
+			archives: []mockRepoArchive{
+				{repo: srcCLIRepo, files: map[string]string{"README.md": "# Welcome to the README\n"}},
+				{repo: sourcegraphRepo, files: map[string]string{"README.md": "# Sourcegraph README\n"}},
+			},
+			steps: []Step{
+				{Run: `touch always.md`, Container: "alpine:13"},
+				{Run: `touch only-src-cli.md`, Container: "alpine:13", IfCondition: `${{ eq repository.name "github.com/sourcegraph/src-cli" }}`},
+				{Run: `touch never.md`, Container: "alpine:13", IfCondition: false},
+				{Run: `touch after-${{ join previous_step.added_files "-" }}`, Container: "alpine:13"},
+			},
+			tasks: []*Task{
+				{Repository: srcCLIRepo},
+				{Repository: sourcegraphRepo},
+			},
+			wantFilesChanged: filesByRepository{
+				srcCLIRepo.ID: filesByBranch{
+					changesetTemplateBranch: []string{"always.md", "only-src-cli.md", "after-always.md-only-src-cli.md"},
+				},
+				sourcegraphRepo.ID: filesByBranch{
+					changesetTemplateBranch: []string{"always.md", "after-always.md"},
+				},
+			},
+		},
+		{
+			name: "allowed failure",
+			archives: []mockRepoArchive{
+				{repo: srcCLIRepo, files: map[string]string{"README.md": "# Welcome to the README\n"}},
+			},
+			steps: []Step{
+				{Run: `touch before.md`, Container: "alpine:13"},
+				{Run: `touch failing.md && exit 1`, Container: "alpine:13", AllowFailure: true},
+				{Run: `touch after.md`, Container: "alpine:13"},
+			},
+			tasks: []*Task{
+				{Repository: srcCLIRepo},
+			},
+			wantFilesChanged: filesByRepository{
+				srcCLIRepo.ID: filesByBranch{
+					changesetTemplateBranch: []string{"before.md", "failing.md", "after.md"},
+				},
+			},
+		},
+		{
+			name: "retried step",
+			archives: []mockRepoArchive{
+				{repo: srcCLIRepo, files: map[string]string{"README.md": "# Welcome to the README\n"}},
+			},
+			steps: []Step{
+				{
+					Run: fmt.Sprintf(
+						`if [[ -f %[1]s ]]; then touch retried.md; else touch %[1]s partial.md && echo changed >> README.md && exit 1; fi`,
+						attemptedMarker,
+					),
+					Container: "alpine:13",
+					Retries:   2,
+				},
+			},
+			tasks: []*Task{
+				{Repository: srcCLIRepo},
+			},
+			// The changes of the failed attempt must not leak into the retry.
+			wantFilesChanged: filesByRepository{
+				srcCLIRepo.ID: filesByBranch{
+					changesetTemplateBranch: []string{"retried.md"},
+				},
+			},
+		},
+		{
+			name: "step timeout",
+			archives: []mockRepoArchive{
+				{repo: srcCLIRepo, files: map[string]string{"README.md": "line 1"}},
+			},
+			steps: []Step{
+				{Run: `while true; do echo "zZzzZ" && sleep 0.05; done`, Container: "alpine:13", Timeout: "100ms"},
+			},
+			tasks: []*Task{
+				{Repository: srcCLIRepo},
+			},
+			wantErrInclude: "Command failed: Timeout reached. Execution took longer than 100ms.",
+		},
+		{
+			name: "secrets",
+			archives: []mockRepoArchive{
+				{repo: srcCLIRepo, files: map[string]string{"README.md": "# Welcome to the README\n"}},
+			},
+			steps: []Step{
+				{
+					Run:       `echo -n "the token is $API_TOKEN" && touch token.md`,
+					Container: "alpine:13",
+					Secrets:   Secrets{"API_TOKEN": {Env: secretEnv}},
+					Outputs: Outputs{
+						"message": Output{Value: "${{ step.stdout }}"},
+					},
+				},
+			},
+			tasks: []*Task{
+				{
+					Repository: srcCLIRepo,
+					Template:   &ChangesetTemplate{Title: "${{ outputs.message }}", Branch: changesetTemplateBranch},
+				},
+			},
+			wantFilesChanged: filesByRepository{
+				srcCLIRepo.ID: filesByBranch{
+					changesetTemplateBranch: []string{"token.md"},
+				},
+			},
+			wantTitle: "the token is ***",
+		},
 		{
 			name: "empty",
 			archives: []mockRepoArchive{
@@ -387,6 +515,35 @@ output4=integration-test-batch-change`,
 				},
 			},
 		},
+		{
+			name: "step commits",
+			archives: []mockRepoArchive{
+				{repo: srcCLIRepo, files: map[string]string{
+					"README.md": "# Welcome to the README\n",
+					"main.go":   "package main\n",
+				}},
+			},
+			steps: []Step{
+				{Run: `echo "foobar" >> README.md`, Container: "alpine:13", Commit: &StepCommit{Message: "Update ${{ step.modified_files }}"}},
+				{Run: `echo "// nothing" >> README.md`, Container: "alpine:13", Commit: &StepCommit{Message: "Nothing to commit"}, IfCondition: false},
+				{Run: `echo "func main() {}" >> main.go`, Container: "alpine:13"},
+			},
+			tasks: []*Task{
+				{
+					Repository: srcCLIRepo,
+					Template: &ChangesetTemplate{
+						Branch: changesetTemplateBranch,
+						Commit: ExpandedGitCommitDescription{Message: "Add main function"},
+					},
+				},
+			},
+			wantFilesChanged: filesByRepository{
+				srcCLIRepo.ID: filesByBranch{
+					changesetTemplateBranch: []string{"README.md", "main.go"},
+				},
+			},
+			wantCommitMessages: []string{"Update [README.md]", "Add main function"},
+		},
 	}
 
 	for _, tc := range tests {
@@ -489,7 +646,15 @@ output4=integration-test-batch-change`,
 				}
 
 				for _, spec := range specs {
-					if have, want := len(spec.Commits), 1; have != want {
+					if tc.wantCommitMessages != nil {
+						var have []string
+						for _, c := range spec.Commits {
+							have = append(have, c.Message)
+						}
+						if diff := cmp.Diff(tc.wantCommitMessages, have); diff != "" {
+							t.Fatalf("wrong commits (-want +have):\n%s", diff)
+						}
+					} else if have, want := len(spec.Commits), 1; have != want {
 						t.Fatalf("wrong number of commits. want=%d, have=%d", want, have)
 					}
 
@@ -519,9 +684,13 @@ output4=integration-test-batch-change`,
 						t.Fatalf("spec for repo %q and branch %q but no files expected in that branch", spec.BaseRepository, branch)
 					}
 
-					fileDiffs, err := diff.ParseMultiFileDiff([]byte(spec.Commits[0].Diff))
-					if err != nil {
-						t.Fatalf("failed to parse diff: %s", err)
+					var fileDiffs []*diff.FileDiff
+					for _, c := range spec.Commits {
+						fds, err := diff.ParseMultiFileDiff([]byte(c.Diff))
+						if err != nil {
+							t.Fatalf("failed to parse diff: %s", err)
+						}
+						fileDiffs = append(fileDiffs, fds...)
 					}
 
 					if have, want := len(fileDiffs), len(wantFilesInBranch); have != want {
@@ -885,6 +1054,111 @@ func TestCreateChangesetSpecs(t *testing.T) {
 	}
 }
 
+func TestCreateChangesetSpecs_Commits(t *testing.T) {
+	features := featureFlags{allowtransformChanges: true, allowMultipleCommits: true}
+
+	repo := &graphql.Repository{
+		ID:            "src-cli",
+		Name:          "github.com/sourcegraph/src-cli",
+		DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: "d34db33f"}},
+	}
+
+	goModDiff := `diff --git go.mod go.mod
+index 06471f4..5f9d3fa 100644
+--- go.mod
++++ go.mod
+@@ -1,1 +1,1 @@
+-go 1.15
++go 1.16
+`
+	docsDiff := `diff --git docs/README.md docs/README.md
+index 1914491..cd2ccbf 100644
+--- docs/README.md
++++ docs/README.md
+@@ -1,1 +1,1 @@
+-Requires Go 1.15.
++Requires Go 1.16.
+`
+	mainDiff := `diff --git main.go main.go
+index 3e75765..f2ad6c7 100644
+--- main.go
++++ main.go
+@@ -1,1 +1,1 @@
+-package  main
++package main
+`
+
+	result := executionResult{
+		Diff: goModDiff + docsDiff + mainDiff,
+		Commits: []executionCommit{
+			{Message: "Update Go", Diff: goModDiff + docsDiff},
+			{Message: "Run gofmt", Diff: mainDiff},
+		},
+	}
+
+	newTask := func(transform *TransformChanges) *Task {
+		return &Task{
+			BatchChangeAttributes: &BatchChangeAttributes{Name: "the name"},
+			Template: &ChangesetTemplate{
+				Title:     "The title",
+				Branch:    "my-branch",
+				Commit:    ExpandedGitCommitDescription{Message: "git commit message"},
+				Published: parsePublishedFieldString(t, "false"),
+			},
+			Repository:       repo,
+			TransformChanges: transform,
+		}
+	}
+
+	t.Run("commits ended by steps", func(t *testing.T) {
+		result := result
+		result.Commits = append(result.Commits, executionCommit{Diff: docsDiff})
+
+		specs, err := createChangesetSpecs(newTask(nil), result, features)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(specs) != 1 {
+			t.Fatalf("wrong number of changeset specs: %d", len(specs))
+		}
+
+		want := []GitCommitDescription{
+			{Message: "Update Go", Diff: goModDiff + docsDiff},
+			{Message: "Run gofmt", Diff: mainDiff},
+			{Message: "git commit message", Diff: docsDiff},
+		}
+		if diff := cmp.Diff(want, specs[0].Commits); diff != "" {
+			t.Errorf("wrong commits (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("transformChanges", func(t *testing.T) {
+		transform := &TransformChanges{Group: []Group{{Directory: "docs", Branch: "my-branch-docs"}}}
+
+		specs, err := createChangesetSpecs(newTask(transform), result, features)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		have := map[string][]GitCommitDescription{}
+		for _, spec := range specs {
+			have[spec.HeadRef] = spec.Commits
+		}
+		want := map[string][]GitCommitDescription{
+			"refs/heads/my-branch": {
+				{Message: "Update Go", Diff: goModDiff},
+				{Message: "Run gofmt", Diff: mainDiff},
+			},
+			"refs/heads/my-branch-docs": {
+				{Message: "Update Go", Diff: docsDiff},
+			},
+		}
+		if diff := cmp.Diff(want, have); diff != "" {
+			t.Errorf("wrong commits (-want +got):\n%s", diff)
+		}
+	})
+}
+
 func parsePublishedFieldString(t *testing.T, input string) overridable.BoolOrString {
 	t.Helper()
 
@@ -9,6 +9,12 @@ import (
 )
 
 func runGitCmd(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	return runGitCmdWithEnv(ctx, dir, nil, args...)
+}
+
+// runGitCmdWithEnv runs git like runGitCmd, with additional environment
+// variables, such as those needed to access remotes.
+func runGitCmdWithEnv(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
 	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Env = []string{
 		// Don't use the system wide git config.
@@ -24,6 +30,7 @@ func runGitCmd(ctx context.Context, dir string, args ...string) ([]byte, error)
 		"GIT_COMMITTER_NAME=Sourcegraph",
 		"GIT_COMMITTER_EMAIL=batch-changes@sourcegraph.com",
 	}
+	cmd.Env = append(cmd.Env, env...)
 	cmd.Dir = dir
 	out, err := cmd.CombinedOutput()
 	if err != nil {
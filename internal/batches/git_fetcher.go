@@ -0,0 +1,256 @@
+package batches
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+// FetchMethods are the ways in which repositories can be fetched before the
+// steps of a batch spec are run in them.
+var FetchMethods = []string{"archive", "git"}
+
+// ValidateFetchMethod returns an error if method isn't one of FetchMethods.
+// An empty method selects the default, which is to download archives.
+func ValidateFetchMethod(method string) error {
+	if method == "" {
+		return nil
+	}
+	for _, m := range FetchMethods {
+		if method == m {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown fetch method %q: must be one of %s", method, strings.Join(FetchMethods, ", "))
+}
+
+// gitRepoFetcher is a RepoFetcher that clones repositories with git instead
+// of downloading archives. The clones are partial: they contain the history
+// of the repository, but only the files that are checked out, which are
+// limited to the workspace if only the workspace should be fetched.
+//
+// The history is blob-less: the contents of files in other commits would be
+// fetched on demand, which fails in the step containers, since they don't
+// have the credentials to do so. Steps can inspect the commits and the trees,
+// such as with git log, but not the old contents of files, such as with
+// git log -p or git blame.
+//
+// The clones are used as workspaces directly, so they can only be used with
+// workspaces on the host filesystem.
+type gitRepoFetcher struct {
+	client api.Client
+	dir    string
+
+	// baseURL is the URL that repository names are appended to to get their
+	// clone URL. If empty, the repositories are cloned from the Sourcegraph
+	// instance, with the same credentials as API requests.
+	baseURL string
+
+	// transport are the TLS and proxy settings of API requests, which git
+	// uses as well.
+	transport api.TransportSettings
+}
+
+var _ RepoFetcher = &gitRepoFetcher{}
+
+func (rf *gitRepoFetcher) Checkout(repo *graphql.Repository, path string) RepoZip {
+	return &repoClone{fetcher: rf, repo: repo, pathInRepo: path}
+}
+
+// cloneURL returns the URL to clone repo from, and the HTTP headers that have
+// to be sent with the requests.
+func (rf *gitRepoFetcher) cloneURL(ctx context.Context, repo *graphql.Repository) (string, http.Header, error) {
+	if rf.baseURL != "" {
+		return strings.TrimRight(rf.baseURL, "/") + "/" + repo.Name, nil, nil
+	}
+
+	// Creating the request gives us the URL and the headers that API requests
+	// to the instance use, including the access token.
+	req, err := rf.client.NewHTTPRequest(ctx, "GET", ".api/git/"+repo.Name, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return req.URL.String(), req.Header, nil
+}
+
+// repoClone is the RepoZip returned by gitRepoFetcher. Unlike archives, which
+// are shared between the tasks in the same repository, each task gets its own
+// clone.
+type repoClone struct {
+	fetcher    *gitRepoFetcher
+	repo       *graphql.Repository
+	pathInRepo string
+
+	mu  sync.Mutex
+	dir string
+	// claimed is set once the clone has been turned into a workspace, which is
+	// then responsible for removing it.
+	claimed bool
+}
+
+var _ RepoZip = &repoClone{}
+
+func (rc *repoClone) Fetch(ctx context.Context) (err error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.dir != "" {
+		return nil
+	}
+
+	dir, err := ioutil.TempDir(rc.fetcher.dir, "workspace-"+rc.repo.Slug())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+	// Like unzipped archives, the workspace has to be writable by the users
+	// that steps run as in their containers.
+	if err := os.Chmod(dir, 0777); err != nil {
+		return err
+	}
+
+	url, headers, err := rc.fetcher.cloneURL(ctx, rc.repo)
+	if err != nil {
+		return err
+	}
+	env := gitRemoteEnv(headers, rc.fetcher.transport)
+	git := func(args ...string) error {
+		_, err := runGitCmdWithEnv(ctx, dir, env, args...)
+		return err
+	}
+
+	branch := strings.TrimPrefix(rc.repo.BaseRef(), "refs/heads/")
+	if err := git("clone", "--quiet", "--filter=blob:none", "--no-checkout", "--no-tags", "--single-branch", "--branch", branch, "--", url, "."); err != nil {
+		return errors.Wrap(err, "cloning repository")
+	}
+
+	// The branch might have moved on since the repository was resolved, so
+	// the commit might have to be fetched separately.
+	rev := rc.repo.Rev()
+	if err := git("cat-file", "-e", rev+"^{commit}"); err != nil {
+		if err := git("fetch", "--quiet", "--filter=blob:none", "--no-tags", "origin", rev); err != nil {
+			return errors.Wrapf(err, "fetching commit %s", rev)
+		}
+	}
+
+	if rc.pathInRepo != "" {
+		// In cone mode, the files in the directories above the workspace,
+		// such as .gitignore, are checked out as well.
+		if err := git("sparse-checkout", "init", "--cone"); err != nil {
+			return errors.Wrap(err, "enabling sparse checkout")
+		}
+		if err := git("sparse-checkout", "set", "--", rc.pathInRepo); err != nil {
+			return errors.Wrap(err, "setting sparse checkout path")
+		}
+	}
+
+	// Checking out the commit fetches the files that are needed.
+	if err := git("checkout", "--quiet", "--detach", rev); err != nil {
+		return errors.Wrapf(err, "checking out commit %s", rev)
+	}
+
+	rc.dir = dir
+	return nil
+}
+
+func (rc *repoClone) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.dir == "" || rc.claimed {
+		return nil
+	}
+	return os.RemoveAll(rc.dir)
+}
+
+func (rc *repoClone) Path() string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.dir
+}
+
+// AdditionalFilePaths returns nothing, since the clone already contains all
+// the files that are needed.
+func (rc *repoClone) AdditionalFilePaths() map[string]string { return nil }
+
+// claim hands the clone over to a workspace, and returns its directory.
+func (rc *repoClone) claim() (string, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.dir == "" {
+		return "", errors.New("repository hasn't been cloned")
+	}
+	if rc.claimed {
+		return "", errors.New("clone is already used by another workspace")
+	}
+	rc.claimed = true
+	return rc.dir, nil
+}
+
+// gitRemoteEnv returns the environment that passes the given headers and TLS
+// and proxy settings to git for all HTTP requests. Configuration from the
+// environment doesn't end up in the arguments of the git processes or in the
+// configuration of the clone, which keeps access tokens from being exposed.
+//
+// Unlike for API requests, a CA bundle replaces the system roots for git
+// instead of being trusted in addition to them.
+func gitRemoteEnv(headers http.Header, transport api.TransportSettings) []string {
+	// Proxies are configured like for API requests.
+	var env []string
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"} {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var params []string
+	for _, name := range names {
+		for _, value := range headers[name] {
+			params = append(params, quoteGitConfigParameter(fmt.Sprintf("http.extraHeader=%s: %s", name, value)))
+		}
+	}
+	if transport.InsecureSkipVerify {
+		params = append(params, quoteGitConfigParameter("http.sslVerify=false"))
+	}
+	for _, setting := range []struct{ key, value string }{
+		{"http.sslCAInfo", transport.CABundlePath},
+		{"http.sslCert", transport.ClientCertPath},
+		{"http.sslKey", transport.ClientKeyPath},
+		{"http.proxy", transport.ProxyURL},
+	} {
+		if setting.value != "" {
+			params = append(params, quoteGitConfigParameter(setting.key+"="+setting.value))
+		}
+	}
+	if len(params) > 0 {
+		env = append(env, "GIT_CONFIG_PARAMETERS="+strings.Join(params, " "))
+	}
+	return env
+}
+
+// quoteGitConfigParameter quotes s for GIT_CONFIG_PARAMETERS, in which each
+// parameter is single quoted as in the shell.
+func quoteGitConfigParameter(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
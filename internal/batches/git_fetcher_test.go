@@ -0,0 +1,250 @@
+package batches
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/api"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func TestGitRepoFetcher(t *testing.T) {
+	ctx := context.Background()
+
+	root, err := ioutil.TempDir("", "git-repo-fetcher-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+
+	// Set up a repository with two commits, of which the first one is the
+	// base of the changes, to make sure that the right commit is checked out.
+	const name = "github.com/sourcegraph/src-cli"
+	upstream := filepath.Join(root, "upstream", filepath.FromSlash(name))
+	if err := os.MkdirAll(upstream, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) string {
+		t.Helper()
+		out, err := runGitCmd(ctx, upstream, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	write := func(files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			path := filepath.Join(upstream, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	git("init", "--quiet")
+	git("symbolic-ref", "HEAD", "refs/heads/main")
+	// Partial clones have to be allowed explicitly, as 'src serve-git' does.
+	git("config", "uploadpack.allowFilter", "true")
+	write(map[string]string{
+		".gitignore":    "*.log\n",
+		"README.md":     "# Welcome to the README\n",
+		"sub/a.txt":     "a\n",
+		"sub/deep/c.go": "package deep\n",
+		"other/b.txt":   "b\n",
+	})
+	git("add", "--all")
+	git("commit", "--quiet", "-m", "first")
+	base := git("rev-parse", "HEAD")
+	write(map[string]string{"README.md": "# Moved on\n"})
+	git("commit", "--quiet", "--all", "-m", "second")
+
+	repo := &graphql.Repository{
+		ID:            "src-cli",
+		Name:          name,
+		DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: base}},
+	}
+	fetcher := &gitRepoFetcher{
+		dir:     filepath.Join(root, "cache"),
+		baseURL: "file://" + filepath.ToSlash(filepath.Join(root, "upstream")),
+	}
+	if err := os.MkdirAll(fetcher.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFiles := func(t *testing.T, dir string, want map[string]string) {
+		t.Helper()
+		have := map[string]string{}
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, path)
+			have[filepath.ToSlash(rel)] = string(content)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, have); diff != "" {
+			t.Errorf("wrong files in clone (-want +have):\n%s", diff)
+		}
+	}
+
+	t.Run("full", func(t *testing.T) {
+		clone := fetcher.Checkout(repo, "")
+		if err := clone.Fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer clone.Close()
+
+		assertFiles(t, clone.Path(), map[string]string{
+			".gitignore":    "*.log\n",
+			"README.md":     "# Welcome to the README\n",
+			"sub/a.txt":     "a\n",
+			"sub/deep/c.go": "package deep\n",
+			"other/b.txt":   "b\n",
+		})
+
+		// The clone is turned into a workspace without any changes, and with
+		// the history of the repository.
+		wc := &dockerBindWorkspaceCreator{dir: fetcher.dir}
+		w, err := wc.Create(ctx, repo, nil, clone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := *w.WorkDir()
+		if dir != clone.Path() {
+			t.Errorf("workspace doesn't use clone: have=%q want=%q", dir, clone.Path())
+		}
+		out, err := runGitCmd(ctx, dir, "log", "--format=%s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := strings.TrimSpace(string(out)), "first"; have != want {
+			t.Errorf("wrong history: have=%q want=%q", have, want)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		changes, err := w.Changes(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(&StepChanges{Added: []string{"new.txt"}}, changes); diff != "" {
+			t.Errorf("wrong changes (-want +have):\n%s", diff)
+		}
+
+		// Closing the archive leaves the workspace alone.
+		if err := clone.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("workspace removed by closing clone: %s", err)
+		}
+		if err := w.Close(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("workspace not removed: %v", err)
+		}
+	})
+
+	t.Run("only workspace", func(t *testing.T) {
+		clone := fetcher.Checkout(repo, "sub")
+		if err := clone.Fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		// Files directly in the directories above the workspace are checked
+		// out, too.
+		assertFiles(t, clone.Path(), map[string]string{
+			".gitignore":    "*.log\n",
+			"README.md":     "# Welcome to the README\n",
+			"sub/a.txt":     "a\n",
+			"sub/deep/c.go": "package deep\n",
+		})
+
+		dir := clone.Path()
+		if err := clone.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("unused clone not removed: %v", err)
+		}
+	})
+
+	t.Run("volume workspace", func(t *testing.T) {
+		wc := &dockerVolumeWorkspaceCreator{}
+		if _, err := wc.Create(ctx, repo, nil, fetcher.Checkout(repo, "")); err == nil {
+			t.Error("unexpected nil error")
+		}
+	})
+
+	t.Run("missing repository", func(t *testing.T) {
+		missing := *repo
+		missing.Name = "github.com/sourcegraph/missing"
+		clone := fetcher.Checkout(&missing, "")
+		if err := clone.Fetch(ctx); err == nil {
+			t.Error("unexpected nil error")
+		}
+		if clone.Path() != "" {
+			t.Errorf("unexpected path for failed clone: %q", clone.Path())
+		}
+	})
+}
+
+func TestGitRemoteEnv(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"} {
+		name := name
+		if value, ok := os.LookupEnv(name); ok {
+			os.Unsetenv(name)
+			t.Cleanup(func() { os.Setenv(name, value) })
+		}
+	}
+
+	if env := gitRemoteEnv(nil, api.TransportSettings{}); len(env) != 0 {
+		t.Errorf("unexpected environment without headers: %v", env)
+	}
+
+	env := gitRemoteEnv(http.Header{
+		"Authorization": {"token it's-a-secret"},
+		"X-Foo":         {"bar"},
+	}, api.TransportSettings{})
+	want := []string{`GIT_CONFIG_PARAMETERS='http.extraHeader=Authorization: token it'\''s-a-secret' 'http.extraHeader=X-Foo: bar'`}
+	if diff := cmp.Diff(want, env); diff != "" {
+		t.Errorf("wrong environment (-want +have):\n%s", diff)
+	}
+
+	env = gitRemoteEnv(nil, api.TransportSettings{
+		InsecureSkipVerify: true,
+		CABundlePath:       "/etc/ca.pem",
+		ClientCertPath:     "/etc/client.pem",
+		ClientKeyPath:      "/etc/client.key",
+		ProxyURL:           "http://proxy:3128",
+	})
+	want = []string{`GIT_CONFIG_PARAMETERS='http.sslVerify=false' 'http.sslCAInfo=/etc/ca.pem' 'http.sslCert=/etc/client.pem' 'http.sslKey=/etc/client.key' 'http.proxy=http://proxy:3128'`}
+	if diff := cmp.Diff(want, env); diff != "" {
+		t.Errorf("wrong environment (-want +have):\n%s", diff)
+	}
+}
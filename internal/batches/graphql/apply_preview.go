@@ -0,0 +1,72 @@
+package graphql
+
+// ChangesetApplyPreview describes what applying a batch spec would do to one
+// changeset. Previews of changesets in repositories that the user can't see
+// only have their operations set.
+type ChangesetApplyPreview struct {
+	Typename   string `json:"__typename"`
+	Operations []string
+	Delta      ChangesetSpecDelta
+	Targets    ApplyPreviewTargets
+}
+
+// Hidden returns whether the changeset is in a repository that the user can't
+// see.
+func (p *ChangesetApplyPreview) Hidden() bool {
+	return p.Typename == "HiddenChangesetApplyPreview"
+}
+
+// ChangesetSpecDelta describes which properties of an existing changeset
+// would be changed by applying a batch spec.
+type ChangesetSpecDelta struct {
+	TitleChanged         bool
+	BodyChanged          bool
+	BaseRefChanged       bool
+	DiffChanged          bool
+	CommitMessageChanged bool
+	AuthorNameChanged    bool
+	AuthorEmailChanged   bool
+}
+
+// ApplyPreviewTargets are the changeset spec and the existing changeset that
+// a preview applies to. A changeset spec that would create a new changeset
+// has no changeset, and a changeset that isn't in the batch spec anymore has
+// no changeset spec.
+type ApplyPreviewTargets struct {
+	Typename      string `json:"__typename"`
+	ChangesetSpec *ApplyPreviewChangesetSpec
+	Changeset     *ApplyPreviewChangeset
+}
+
+type ApplyPreviewChangesetSpec struct {
+	ID          string
+	Description ChangesetDescription
+}
+
+// ChangesetDescription is the description of a changeset in a changeset spec:
+// either a branch to push, or an existing changeset to import, which only has
+// the repository and external ID set.
+type ChangesetDescription struct {
+	Typename       string `json:"__typename"`
+	BaseRepository ChangesetRepository
+	BaseRef        string
+	HeadRef        string
+	Title          string
+	ExternalID     string
+	DiffStat       *DiffStat
+}
+
+type ApplyPreviewChangeset struct {
+	ID          string
+	Title       string
+	State       string
+	ExternalURL *ExternalURL
+	Repository  *ChangesetRepository
+	DiffStat    *DiffStat
+}
+
+type DiffStat struct {
+	Added   int
+	Changed int
+	Deleted int
+}
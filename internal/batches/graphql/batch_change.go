@@ -1,9 +1,77 @@
 package graphql
 
+import "time"
+
 type BatchChange struct {
+	ID              string
+	Namespace       Namespace
+	Name            string
+	Description     string
+	URL             string
+	State           string
+	CreatedAt       time.Time
+	ClosedAt        *time.Time
+	ChangesetsStats ChangesetsStats
+}
+
+// ChangesetsStats counts the changesets of a batch change by state.
+type ChangesetsStats struct {
+	Total       int
+	Unpublished int
+	Draft       int
+	Open        int
+	Merged      int
+	Closed      int
+	Deleted     int
+	Retrying    int
+	Failed      int
+	Processing  int
+	Archived    int
+}
+
+// Changeset is a changeset of a batch change. Changesets in repositories that
+// the user can't see only have their ID and state set.
+type Changeset struct {
 	ID          string
-	Namespace   Namespace
-	Name        string
-	Description string
-	URL         string
+	Title       string
+	State       string
+	ReviewState string
+	CheckState  string
+	ExternalID  string
+	ExternalURL *ExternalURL
+	Repository  *ChangesetRepository
+	Error       *string
+}
+
+type ExternalURL struct {
+	URL string
+}
+
+type ChangesetRepository struct {
+	ID   string
+	Name string
+}
+
+// ListBatchChangesOpts selects the batch changes returned by
+// Operations.ListBatchChanges.
+type ListBatchChangesOpts struct {
+	// State is OPEN or CLOSED. If empty, batch changes in all states are
+	// returned.
+	State string
+
+	// Limit is the maximum number of batch changes to return, or -1 for all
+	// of them.
+	Limit int
+}
+
+// ListChangesetsOpts selects the changesets returned by
+// Operations.ListChangesets.
+type ListChangesetsOpts struct {
+	// State is a changeset state such as OPEN or FAILED. If empty, changesets
+	// in all states are returned.
+	State string
+
+	// OnlyArchived returns only the changesets that were archived because
+	// they aren't part of the current batch spec anymore.
+	OnlyArchived bool
 }
@@ -2,6 +2,9 @@ package graphql
 
 import (
 	"context"
+	"encoding/json"
+
+	"github.com/sourcegraph/src-cli/internal/api"
 )
 
 type batchesBackend struct {
@@ -16,7 +19,9 @@ mutation ApplyBatchChange($batchSpec: ID!) {
 		...batchChangeFields
 	}
 }
+` + batchChangeFieldsFragment
 
+const batchChangeFieldsFragment = `
 fragment batchChangeFields on BatchChange {
     id
     namespace {
@@ -28,6 +33,31 @@ fragment batchChangeFields on BatchChange {
 }
 ` + NamespaceFieldsFragment
 
+// batchChangeDetailsFieldsFragment adds the state of the batch change and its
+// changesets to batchChangeFields, for the commands that manage existing
+// batch changes.
+const batchChangeDetailsFieldsFragment = `
+fragment batchChangeDetailsFields on BatchChange {
+    ...batchChangeFields
+    state
+    createdAt
+    closedAt
+    changesetsStats {
+        total
+        unpublished
+        draft
+        open
+        merged
+        closed
+        deleted
+        retrying
+        failed
+        processing
+        archived
+    }
+}
+` + batchChangeFieldsFragment
+
 func (bb *batchesBackend) ApplyBatchChange(ctx context.Context, batchSpecID BatchSpecID) (*BatchChange, error) {
 	var result struct {
 		BatchChange *BatchChange `json:"applyBatchChange"`
@@ -70,3 +100,323 @@ func (bb *batchesBackend) CreateBatchSpec(ctx context.Context, namespace, spec s
 	}
 	return &result.CreateBatchSpec, nil
 }
+
+const listBatchChangesQuery = `
+query BatchChanges($first: Int, $after: String, $state: BatchChangeState) {
+    batchChanges(first: $first, after: $after, state: $state) {
+        nodes {
+            ...batchChangeDetailsFields
+        }
+        pageInfo {
+            endCursor
+            hasNextPage
+        }
+    }
+}
+` + batchChangeDetailsFieldsFragment
+
+func (bb *batchesBackend) ListBatchChanges(ctx context.Context, opts ListBatchChangesOpts, fn func(*BatchChange) error) error {
+	return api.Paginate(ctx, bb.client, api.PaginateOpts{
+		Query: listBatchChangesQuery,
+		Vars:  map[string]interface{}{"state": api.NullString(opts.State)},
+		Path:  []string{"batchChanges"},
+		Limit: opts.Limit,
+	}, func(node json.RawMessage) error {
+		var batchChange BatchChange
+		if err := json.Unmarshal(node, &batchChange); err != nil {
+			return err
+		}
+		return fn(&batchChange)
+	})
+}
+
+const batchChangeByNameQuery = `
+query BatchChange($namespace: ID!, $name: String!) {
+    batchChange(namespace: $namespace, name: $name) {
+        ...batchChangeDetailsFields
+    }
+}
+` + batchChangeDetailsFieldsFragment
+
+func (bb *batchesBackend) BatchChangeByName(ctx context.Context, namespaceID, name string) (*BatchChange, error) {
+	var result struct {
+		BatchChange *BatchChange
+	}
+	if ok, err := bb.newRequest(batchChangeByNameQuery, map[string]interface{}{
+		"namespace": namespaceID,
+		"name":      name,
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+	return result.BatchChange, nil
+}
+
+const changesetFieldsFragment = `
+fragment changesetFields on Changeset {
+    id
+    state
+    ... on ExternalChangeset {
+        title
+        reviewState
+        checkState
+        externalID
+        externalURL {
+            url
+        }
+        repository {
+            id
+            name
+        }
+        error
+    }
+}
+`
+
+const listChangesetsQuery = `
+query BatchChangeChangesets(
+    $batchChange: ID!,
+    $first: Int,
+    $after: String,
+    $state: ChangesetState,
+    $onlyArchived: Boolean
+) {
+    node(id: $batchChange) {
+        ... on BatchChange {
+            changesets(first: $first, after: $after, state: $state, onlyArchived: $onlyArchived) {
+                nodes {
+                    ...changesetFields
+                }
+                pageInfo {
+                    endCursor
+                    hasNextPage
+                }
+            }
+        }
+    }
+}
+` + changesetFieldsFragment
+
+func (bb *batchesBackend) ListChangesets(ctx context.Context, batchChangeID string, opts ListChangesetsOpts, fn func(*Changeset) error) error {
+	return api.Paginate(ctx, bb.client, api.PaginateOpts{
+		Query: listChangesetsQuery,
+		Vars: map[string]interface{}{
+			"batchChange":  batchChangeID,
+			"state":        api.NullString(opts.State),
+			"onlyArchived": opts.OnlyArchived,
+		},
+		Path:  []string{"node", "changesets"},
+		Limit: -1,
+	}, func(node json.RawMessage) error {
+		var changeset Changeset
+		if err := json.Unmarshal(node, &changeset); err != nil {
+			return err
+		}
+		return fn(&changeset)
+	})
+}
+
+const closeBatchChangeMutation = `
+mutation CloseBatchChange($batchChange: ID!, $closeChangesets: Boolean) {
+    closeBatchChange(batchChange: $batchChange, closeChangesets: $closeChangesets) {
+        ...batchChangeDetailsFields
+    }
+}
+` + batchChangeDetailsFieldsFragment
+
+func (bb *batchesBackend) CloseBatchChange(ctx context.Context, batchChangeID string, closeChangesets bool) (*BatchChange, error) {
+	var result struct {
+		CloseBatchChange *BatchChange
+	}
+	if ok, err := bb.newRequest(closeBatchChangeMutation, map[string]interface{}{
+		"batchChange":     batchChangeID,
+		"closeChangesets": closeChangesets,
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+	return result.CloseBatchChange, nil
+}
+
+const reenqueueChangesetMutation = `
+mutation ReenqueueChangeset($changeset: ID!) {
+    reenqueueChangeset(changeset: $changeset) {
+        ...changesetFields
+    }
+}
+` + changesetFieldsFragment
+
+func (bb *batchesBackend) ReenqueueChangeset(ctx context.Context, changesetID string) (*Changeset, error) {
+	var result struct {
+		ReenqueueChangeset *Changeset
+	}
+	if ok, err := bb.newRequest(reenqueueChangesetMutation, map[string]interface{}{
+		"changeset": changesetID,
+	}).Do(ctx, &result); err != nil || !ok {
+		return nil, err
+	}
+	return result.ReenqueueChangeset, nil
+}
+
+const detachChangesetsMutation = `
+mutation DetachChangesets($batchChange: ID!, $changesets: [ID!]!) {
+    detachChangesets(batchChange: $batchChange, changesets: $changesets) {
+        id
+    }
+}
+`
+
+func (bb *batchesBackend) DetachChangesets(ctx context.Context, batchChangeID string, changesetIDs []string) error {
+	if err := bb.requireMutation(ctx, "detachChangesets", "detaching changesets"); err != nil {
+		return err
+	}
+
+	var result struct{}
+	_, err := bb.newRequest(detachChangesetsMutation, map[string]interface{}{
+		"batchChange": batchChangeID,
+		"changesets":  changesetIDs,
+	}).Do(ctx, &result)
+	return err
+}
+
+const publishChangesetsMutation = `
+mutation PublishChangesets($batchChange: ID!, $changesets: [ID!]!, $draft: Boolean) {
+    publishChangesets(batchChange: $batchChange, changesets: $changesets, draft: $draft) {
+        id
+    }
+}
+`
+
+func (bb *batchesBackend) PublishChangesets(ctx context.Context, batchChangeID string, changesetIDs []string, draft bool) error {
+	if err := bb.requireMutation(ctx, "publishChangesets", "publishing changesets"); err != nil {
+		return err
+	}
+
+	var result struct{}
+	_, err := bb.newRequest(publishChangesetsMutation, map[string]interface{}{
+		"batchChange": batchChangeID,
+		"changesets":  changesetIDs,
+		"draft":       draft,
+	}).Do(ctx, &result)
+	return err
+}
+
+const applyPreviewChangesetSpecFieldsFragment = `
+fragment applyPreviewChangesetSpecFields on VisibleChangesetSpec {
+    id
+    description {
+        __typename
+        ... on GitBranchChangesetDescription {
+            baseRepository {
+                id
+                name
+            }
+            baseRef
+            headRef
+            title
+            diffStat {
+                added
+                changed
+                deleted
+            }
+        }
+        ... on ExistingChangesetReference {
+            baseRepository {
+                id
+                name
+            }
+            externalID
+        }
+    }
+}
+`
+
+const applyPreviewChangesetFieldsFragment = `
+fragment applyPreviewChangesetFields on ExternalChangeset {
+    id
+    title
+    state
+    externalURL {
+        url
+    }
+    repository {
+        id
+        name
+    }
+    diffStat {
+        added
+        changed
+        deleted
+    }
+}
+`
+
+const applyPreviewQuery = `
+query BatchSpecApplyPreview($batchSpec: ID!, $first: Int, $after: String) {
+    node(id: $batchSpec) {
+        ... on BatchSpec {
+            applyPreview(first: $first, after: $after) {
+                nodes {
+                    __typename
+                    ... on VisibleChangesetApplyPreview {
+                        operations
+                        delta {
+                            titleChanged
+                            bodyChanged
+                            baseRefChanged
+                            diffChanged
+                            commitMessageChanged
+                            authorNameChanged
+                            authorEmailChanged
+                        }
+                        targets {
+                            __typename
+                            ... on VisibleApplyPreviewTargetsAttach {
+                                changesetSpec {
+                                    ...applyPreviewChangesetSpecFields
+                                }
+                            }
+                            ... on VisibleApplyPreviewTargetsUpdate {
+                                changesetSpec {
+                                    ...applyPreviewChangesetSpecFields
+                                }
+                                changeset {
+                                    ...applyPreviewChangesetFields
+                                }
+                            }
+                            ... on VisibleApplyPreviewTargetsDetach {
+                                changeset {
+                                    ...applyPreviewChangesetFields
+                                }
+                            }
+                        }
+                    }
+                    ... on HiddenChangesetApplyPreview {
+                        operations
+                        targets {
+                            __typename
+                        }
+                    }
+                }
+                pageInfo {
+                    endCursor
+                    hasNextPage
+                }
+            }
+        }
+    }
+}
+` + applyPreviewChangesetSpecFieldsFragment + applyPreviewChangesetFieldsFragment
+
+func (bb *batchesBackend) ApplyPreview(ctx context.Context, batchSpecID BatchSpecID, fn func(*ChangesetApplyPreview) error) error {
+	return api.Paginate(ctx, bb.client, api.PaginateOpts{
+		Query: applyPreviewQuery,
+		Vars:  map[string]interface{}{"batchSpec": batchSpecID},
+		Path:  []string{"node", "applyPreview"},
+		Limit: -1,
+	}, func(node json.RawMessage) error {
+		var preview ChangesetApplyPreview
+		if err := json.Unmarshal(node, &preview); err != nil {
+			return err
+		}
+		return fn(&preview)
+	})
+}
@@ -0,0 +1,186 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/api"
+)
+
+type graphQLRequest struct {
+	Query     string
+	Variables map[string]interface{}
+}
+
+// newTestBackend returns a batchesBackend whose requests are answered with
+// the response to the operation whose name appears in the query.
+func newTestBackend(t *testing.T, responses map[string]string) (*batchesBackend, *[]graphQLRequest) {
+	t.Helper()
+
+	var requests []graphQLRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %s", err)
+		}
+		requests = append(requests, req)
+
+		for operation, response := range responses {
+			if strings.Contains(req.Query, operation) {
+				w.Write([]byte(response))
+				return
+			}
+		}
+		t.Errorf("unexpected query: %s", req.Query)
+		w.Write([]byte(`{"data": null}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	client := api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: &bytes.Buffer{}})
+	return &batchesBackend{commonBackend{client: client}}, &requests
+}
+
+func TestBatchesBackend_ApplyBatchChange(t *testing.T) {
+	bb, requests := newTestBackend(t, map[string]string{
+		"mutation ApplyBatchChange": `{"data": {"applyBatchChange": {"id": "batch-change-1", "name": "hello-world", "url": "/batch-changes/hello-world"}}}`,
+	})
+
+	batchChange, err := bb.ApplyBatchChange(context.Background(), "batch-spec-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batchChange.ID != "batch-change-1" || batchChange.URL != "/batch-changes/hello-world" {
+		t.Errorf("wrong batch change: %+v", batchChange)
+	}
+
+	// Applying only asks for the fields that every version of the Batch
+	// Changes API has.
+	query := (*requests)[0].Query
+	for _, field := range []string{"changesetsStats", "closedAt", "batchChangeDetailsFields"} {
+		if strings.Contains(query, field) {
+			t.Errorf("apply mutation requests %q:\n%s", field, query)
+		}
+	}
+}
+
+func TestBatchesBackend_ListBatchChanges(t *testing.T) {
+	bb, requests := newTestBackend(t, map[string]string{
+		"query BatchChanges": `{"data": {"batchChanges": {
+			"nodes": [{
+				"id": "batch-change-1",
+				"name": "hello-world",
+				"state": "OPEN",
+				"createdAt": "2021-05-04T10:00:00Z",
+				"closedAt": null,
+				"changesetsStats": {"total": 3, "open": 2, "merged": 1}
+			}],
+			"pageInfo": {"endCursor": null, "hasNextPage": false}
+		}}}`,
+	})
+
+	var have []*BatchChange
+	if err := bb.ListBatchChanges(context.Background(), ListBatchChangesOpts{State: "OPEN", Limit: -1}, func(bc *BatchChange) error {
+		have = append(have, bc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(have) != 1 || have[0].State != "OPEN" || have[0].ClosedAt != nil {
+		t.Fatalf("wrong batch changes: %+v", have)
+	}
+	if diff := cmp.Diff(ChangesetsStats{Total: 3, Open: 2, Merged: 1}, have[0].ChangesetsStats); diff != "" {
+		t.Errorf("wrong changeset stats (-want +have):\n%s", diff)
+	}
+	if state := (*requests)[0].Variables["state"]; state != "OPEN" {
+		t.Errorf("wrong state variable: %v", state)
+	}
+}
+
+func TestBatchesBackend_CloseBatchChange(t *testing.T) {
+	bb, requests := newTestBackend(t, map[string]string{
+		"mutation CloseBatchChange": `{"data": {"closeBatchChange": {"id": "batch-change-1", "state": "CLOSED", "closedAt": "2021-05-04T10:00:00Z"}}}`,
+	})
+
+	batchChange, err := bb.CloseBatchChange(context.Background(), "batch-change-1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batchChange.State != "CLOSED" || batchChange.ClosedAt == nil {
+		t.Errorf("wrong batch change: %+v", batchChange)
+	}
+	want := map[string]interface{}{"batchChange": "batch-change-1", "closeChangesets": true}
+	if diff := cmp.Diff(want, (*requests)[0].Variables); diff != "" {
+		t.Errorf("wrong variables (-want +have):\n%s", diff)
+	}
+}
+
+func TestBatchesBackend_BulkOperations(t *testing.T) {
+	const (
+		withMutations    = `{"data": {"__schema": {"mutationType": {"fields": [{"name": "publishChangesets"}, {"name": "detachChangesets"}]}}}}`
+		withoutMutations = `{"data": {"__schema": {"mutationType": {"fields": [{"name": "applyBatchChange"}]}}}}`
+	)
+
+	for _, tc := range []struct {
+		name      string
+		mutation  string
+		operation func(bb *batchesBackend) error
+	}{
+		{
+			name:     "publishChangesets",
+			mutation: "mutation PublishChangesets",
+			operation: func(bb *batchesBackend) error {
+				return bb.PublishChangesets(context.Background(), "batch-change-1", []string{"changeset-1"}, true)
+			},
+		},
+		{
+			name:     "detachChangesets",
+			mutation: "mutation DetachChangesets",
+			operation: func(bb *batchesBackend) error {
+				return bb.DetachChangesets(context.Background(), "batch-change-1", []string{"changeset-1"})
+			},
+		},
+	} {
+		tc := tc
+		name, operation := tc.name, tc.operation
+
+		t.Run(name+" supported", func(t *testing.T) {
+			bb, requests := newTestBackend(t, map[string]string{
+				"query Mutations": withMutations,
+				tc.mutation:       `{"data": {"` + name + `": {"id": "batch-change-1"}}}`,
+			})
+			if err := operation(bb); err != nil {
+				t.Fatal(err)
+			}
+			if len(*requests) != 2 {
+				t.Fatalf("wrong number of requests: %d", len(*requests))
+			}
+			vars := (*requests)[1].Variables
+			if vars["batchChange"] != "batch-change-1" || !cmp.Equal(vars["changesets"], []interface{}{"changeset-1"}) {
+				t.Errorf("wrong variables: %v", vars)
+			}
+			if name == "publishChangesets" && vars["draft"] != true {
+				t.Errorf("draft not requested: %v", vars)
+			}
+		})
+
+		t.Run(name+" unsupported", func(t *testing.T) {
+			bb, requests := newTestBackend(t, map[string]string{
+				"query Mutations": withoutMutations,
+			})
+			err := operation(bb)
+			if err == nil || !strings.Contains(err.Error(), "isn't supported by this Sourcegraph instance") {
+				t.Fatalf("wrong error: %v", err)
+			}
+			if len(*requests) != 1 {
+				t.Errorf("mutation was sent to an instance that doesn't support it")
+			}
+		})
+	}
+}
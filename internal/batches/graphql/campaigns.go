@@ -1,6 +1,10 @@
 package graphql
 
-import "context"
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
 
 type campaignsBackend struct {
 	commonBackend
@@ -68,3 +72,39 @@ func (cb *campaignsBackend) CreateBatchSpec(ctx context.Context, namespace, spec
 	}
 	return &result.CreateCampaignSpec, nil
 }
+
+// errCampaignsUnsupported is returned by the operations that manage existing
+// batch changes, which are only supported in the Batch Changes API.
+var errCampaignsUnsupported = errors.New("managing batch changes requires Sourcegraph 3.26 or later")
+
+func (cb *campaignsBackend) ListBatchChanges(ctx context.Context, opts ListBatchChangesOpts, fn func(*BatchChange) error) error {
+	return errCampaignsUnsupported
+}
+
+func (cb *campaignsBackend) BatchChangeByName(ctx context.Context, namespaceID, name string) (*BatchChange, error) {
+	return nil, errCampaignsUnsupported
+}
+
+func (cb *campaignsBackend) ListChangesets(ctx context.Context, batchChangeID string, opts ListChangesetsOpts, fn func(*Changeset) error) error {
+	return errCampaignsUnsupported
+}
+
+func (cb *campaignsBackend) CloseBatchChange(ctx context.Context, batchChangeID string, closeChangesets bool) (*BatchChange, error) {
+	return nil, errCampaignsUnsupported
+}
+
+func (cb *campaignsBackend) ReenqueueChangeset(ctx context.Context, changesetID string) (*Changeset, error) {
+	return nil, errCampaignsUnsupported
+}
+
+func (cb *campaignsBackend) DetachChangesets(ctx context.Context, batchChangeID string, changesetIDs []string) error {
+	return errCampaignsUnsupported
+}
+
+func (cb *campaignsBackend) PublishChangesets(ctx context.Context, batchChangeID string, changesetIDs []string, draft bool) error {
+	return errCampaignsUnsupported
+}
+
+func (cb *campaignsBackend) ApplyPreview(ctx context.Context, batchSpecID BatchSpecID, fn func(*ChangesetApplyPreview) error) error {
+	return errCampaignsUnsupported
+}
@@ -1,6 +1,9 @@
 package graphql
 
 import (
+	"context"
+
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/src-cli/internal/api"
 )
 
@@ -15,3 +18,41 @@ func (b *commonBackend) newRequest(query string, vars map[string]interface{}) ap
 	}
 	return b.client.NewRequest(query, vars)
 }
+
+const mutationsQuery = `
+query Mutations {
+    __schema {
+        mutationType {
+            fields {
+                name
+            }
+        }
+    }
+}
+`
+
+// requireMutation returns an error describing what can't be done if the
+// Sourcegraph instance doesn't have the given mutation. Mutations that were
+// added after the Batch Changes API are detected in the schema, since they
+// didn't appear in a version that could be checked instead.
+func (b *commonBackend) requireMutation(ctx context.Context, name, what string) error {
+	var result struct {
+		Schema struct {
+			MutationType struct {
+				Fields []struct {
+					Name string
+				}
+			}
+		} `json:"__schema"`
+	}
+	if ok, err := b.client.NewQuery(mutationsQuery).Do(ctx, &result); err != nil || !ok {
+		return errors.Wrap(err, "checking the mutations of the Sourcegraph instance")
+	}
+
+	for _, field := range result.Schema.MutationType.Fields {
+		if field.Name == name {
+			return nil
+		}
+	}
+	return errors.Errorf("%s isn't supported by this Sourcegraph instance; upgrade it to a newer version", what)
+}
@@ -14,6 +14,16 @@ import (
 type Operations interface {
 	ApplyBatchChange(ctx context.Context, batchSpecID BatchSpecID) (*BatchChange, error)
 	CreateBatchSpec(ctx context.Context, namespace, spec string, changesetSpecIDs []ChangesetSpecID) (*CreateBatchSpecResponse, error)
+
+	ListBatchChanges(ctx context.Context, opts ListBatchChangesOpts, fn func(*BatchChange) error) error
+	BatchChangeByName(ctx context.Context, namespaceID, name string) (*BatchChange, error)
+	ListChangesets(ctx context.Context, batchChangeID string, opts ListChangesetsOpts, fn func(*Changeset) error) error
+	CloseBatchChange(ctx context.Context, batchChangeID string, closeChangesets bool) (*BatchChange, error)
+	ReenqueueChangeset(ctx context.Context, changesetID string) (*Changeset, error)
+	DetachChangesets(ctx context.Context, batchChangeID string, changesetIDs []string) error
+	PublishChangesets(ctx context.Context, batchChangeID string, changesetIDs []string, draft bool) error
+
+	ApplyPreview(ctx context.Context, batchSpecID BatchSpecID, fn func(*ChangesetApplyPreview) error) error
 }
 
 type BatchSpecID string
@@ -0,0 +1,260 @@
+package batches
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExecutionRemoteCache stores execution results on an HTTP server, so that
+// they can be shared between machines.
+//
+// The protocol is deliberately simple, so that WebDAV servers and plain file
+// servers can be used: each result is stored as a JSON document named after
+// its cache key, which is derived from everything that affects the result.
+// Results are read with GET, written with PUT and removed with DELETE at
+// URL/KEY.v3.json, and a 404 response to GET is a cache miss. Requests are
+// only authenticated with basic authentication or a bearer token, so object
+// stores that require signed requests can't be used directly.
+type ExecutionRemoteCache struct {
+	base     *url.URL
+	client   *http.Client
+	token    string
+	readOnly bool
+}
+
+type ExecutionRemoteCacheOpts struct {
+	// URL is the base URL of the cache. Credentials for basic authentication
+	// can be included in it.
+	URL string
+
+	// Client is used to send requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Token, if set, is sent as a bearer token with every request.
+	Token string
+
+	// ReadOnly prevents results from being written to or removed from the
+	// cache, for machines that should only use results computed elsewhere.
+	ReadOnly bool
+}
+
+var _ ExecutionCache = &ExecutionRemoteCache{}
+
+func NewExecutionRemoteCache(opts ExecutionRemoteCacheOpts) (*ExecutionRemoteCache, error) {
+	base, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing remote cache URL %q", opts.URL)
+	}
+	if (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, errors.Errorf("invalid remote cache URL %q: must be an http or https URL", opts.URL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &ExecutionRemoteCache{
+		base:     base,
+		client:   client,
+		token:    opts.Token,
+		readOnly: opts.ReadOnly,
+	}, nil
+}
+
+func (c *ExecutionRemoteCache) Get(ctx context.Context, key ExecutionCacheKey) (executionResult, bool, error) {
+	var result executionResult
+
+	resp, err := c.do(ctx, "GET", key, nil)
+	if err != nil {
+		return result, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return result, false, nil
+	}
+	if err := checkRemoteCacheResponse(resp); err != nil {
+		return result, false, err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		// Unlike invalid files in the disk cache, which are removed, invalid
+		// results might be written by a newer version of src, so they are
+		// treated as a miss and overwritten once the steps have been run.
+		return executionResult{}, false, nil
+	}
+	return result, true, nil
+}
+
+func (c *ExecutionRemoteCache) Set(ctx context.Context, key ExecutionCacheKey, result executionResult) error {
+	if c.readOnly {
+		return nil
+	}
+
+	raw, err := json.Marshal(&executionCacheFile{
+		executionResult: result,
+		Metadata:        newExecutionCacheMetadata(key.Task),
+	})
+	if err != nil {
+		return errors.Wrap(err, "serializing execution result to JSON")
+	}
+
+	resp, err := c.do(ctx, "PUT", key, raw)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return checkRemoteCacheResponse(resp)
+}
+
+func (c *ExecutionRemoteCache) Clear(ctx context.Context, key ExecutionCacheKey) error {
+	if c.readOnly {
+		return nil
+	}
+
+	resp, err := c.do(ctx, "DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkRemoteCacheResponse(resp)
+}
+
+func (c *ExecutionRemoteCache) do(ctx context.Context, method string, key ExecutionCacheKey, body []byte) (*http.Response, error) {
+	keyString, err := key.Key()
+	if err != nil {
+		return nil, errors.Wrap(err, "calculating execution cache key")
+	}
+	u := c.base.ResolveReference(&url.URL{Path: keyString + cacheFileExt})
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "remote cache: %s %s", method, redactedURL(u))
+	}
+	return resp, nil
+}
+
+func checkRemoteCacheResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// Include the start of the body, since object stores explain errors in it.
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return errors.Errorf(
+		"remote cache: %s %s: unexpected status %s: %s",
+		resp.Request.Method,
+		redactedURL(resp.Request.URL),
+		resp.Status,
+		strings.TrimSpace(string(body)),
+	)
+}
+
+// redactedURL returns u without its password, so that it can be included in
+// errors.
+func redactedURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	redacted := *u
+	redacted.User = url.User(u.User.Username())
+	return redacted.String()
+}
+
+// ExecutionLayeredCache combines a local cache, such as an ExecutionDiskCache,
+// with a remote one. Results are looked up locally first, and results found
+// in the remote cache are added to the local one. New results are added to
+// both.
+//
+// The remote cache is best-effort: if it can't be reached, a result that
+// can't be read from it is a miss, and one that can't be written to it is
+// only stored locally, so that an unavailable cache doesn't fail the tasks.
+type ExecutionLayeredCache struct {
+	Local  ExecutionCache
+	Remote ExecutionCache
+
+	// Warn, if set, is called with the errors of the remote cache that were
+	// ignored.
+	Warn func(err error)
+}
+
+var _ ExecutionCache = ExecutionLayeredCache{}
+
+func (c ExecutionLayeredCache) Get(ctx context.Context, key ExecutionCacheKey) (executionResult, bool, error) {
+	result, found, err := c.Local.Get(ctx, key)
+	if err != nil || found {
+		return result, found, err
+	}
+
+	result, found, err = c.Remote.Get(ctx, key)
+	if err != nil {
+		c.warn(err)
+		return executionResult{}, false, nil
+	}
+	if !found {
+		return result, false, nil
+	}
+
+	if err := c.Local.Set(ctx, key, result); err != nil {
+		return executionResult{}, false, err
+	}
+	return result, true, nil
+}
+
+func (c ExecutionLayeredCache) Set(ctx context.Context, key ExecutionCacheKey, result executionResult) error {
+	if err := c.Local.Set(ctx, key, result); err != nil {
+		return err
+	}
+	if err := c.Remote.Set(ctx, key, result); err != nil {
+		c.warn(err)
+	}
+	return nil
+}
+
+func (c ExecutionLayeredCache) Clear(ctx context.Context, key ExecutionCacheKey) error {
+	if err := c.Local.Clear(ctx, key); err != nil {
+		return err
+	}
+	if err := c.Remote.Clear(ctx, key); err != nil {
+		c.warn(err)
+	}
+	return nil
+}
+
+func (c ExecutionLayeredCache) warn(err error) {
+	if c.Warn != nil {
+		c.Warn(err)
+	}
+}
@@ -0,0 +1,284 @@
+package batches
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+// testRemoteCacheServer is a minimal implementation of the remote cache
+// protocol, as provided by object stores and file servers.
+type testRemoteCacheServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	auth    []string
+}
+
+func (s *testRemoteCacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	switch r.Method {
+	case "GET":
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case "PUT":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.objects[r.URL.Path] = data
+	case "DELETE":
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestExecutionRemoteCache(t *testing.T) {
+	ctx := context.Background()
+
+	key := ExecutionCacheKey{Task: &Task{
+		Repository: &graphql.Repository{Name: "src-cli"},
+		Steps:      []Step{{Run: "echo 'Hello World'", Container: "alpine:3"}},
+	}}
+	keyString, err := key.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := executionResult{
+		Diff:         testDiff,
+		ChangedFiles: &StepChanges{Added: []string{"README.md"}},
+		Outputs:      map[string]interface{}{},
+	}
+
+	newServer := func(t *testing.T) (*testRemoteCacheServer, string) {
+		s := &testRemoteCacheServer{objects: map[string][]byte{}}
+		ts := httptest.NewServer(s)
+		t.Cleanup(ts.Close)
+		return s, ts.URL + "/bucket/prefix"
+	}
+
+	t.Run("read and write", func(t *testing.T) {
+		s, url := newServer(t)
+		cache, err := NewExecutionRemoteCache(ExecutionRemoteCacheOpts{URL: url, Token: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, found, err := cache.Get(ctx, key); err != nil || found {
+			t.Fatalf("unexpected result for empty cache: found=%v err=%v", found, err)
+		}
+		if err := cache.Set(ctx, key, value); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := s.objects["/bucket/prefix/"+keyString+cacheFileExt]; !ok {
+			t.Fatalf("result not stored under its key: %v", s.objects)
+		}
+
+		have, found, err := cache.Get(ctx, key)
+		if err != nil || !found {
+			t.Fatalf("unexpected cache miss: err=%v", err)
+		}
+		if diff := cmp.Diff(value, have); diff != "" {
+			t.Errorf("wrong cached result (-want +have):\n%s", diff)
+		}
+
+		if err := cache.Clear(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		if err := cache.Clear(ctx, key); err != nil {
+			t.Errorf("unexpected error clearing missing result: %s", err)
+		}
+		if _, found, _ := cache.Get(ctx, key); found {
+			t.Error("unexpected cache hit after clearing")
+		}
+
+		for _, auth := range s.auth {
+			if auth != "Bearer secret" {
+				t.Errorf("wrong authorization header: %q", auth)
+			}
+		}
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		s, url := newServer(t)
+		cache, err := NewExecutionRemoteCache(ExecutionRemoteCacheOpts{URL: url, ReadOnly: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := cache.Set(ctx, key, value); err != nil {
+			t.Fatal(err)
+		}
+		if len(s.objects) != 0 {
+			t.Errorf("read only cache was written to: %v", s.objects)
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+		}))
+		t.Cleanup(ts.Close)
+
+		cache, err := NewExecutionRemoteCache(ExecutionRemoteCacheOpts{URL: strings.Replace(ts.URL, "://", "://user:password@", 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = cache.Get(ctx, key)
+		if err == nil {
+			t.Fatal("unexpected nil error")
+		}
+		if !strings.Contains(err.Error(), "AccessDenied") {
+			t.Errorf("error doesn't include response body: %s", err)
+		}
+		if strings.Contains(err.Error(), "password") {
+			t.Errorf("error includes password: %s", err)
+		}
+	})
+
+	t.Run("invalid URL", func(t *testing.T) {
+		for _, url := range []string{"", "cache.example.com", "s3://bucket", "http://"} {
+			if _, err := NewExecutionRemoteCache(ExecutionRemoteCacheOpts{URL: url}); err == nil {
+				t.Errorf("unexpected nil error for URL %q", url)
+			}
+		}
+	})
+}
+
+func TestExecutionLayeredCache(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "execution-layered-cache-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	s := &testRemoteCacheServer{objects: map[string][]byte{}}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	remote, err := NewExecutionRemoteCache(ExecutionRemoteCacheOpts{URL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := ExecutionDiskCache{Dir: dir}
+	cache := ExecutionLayeredCache{Local: local, Remote: remote}
+
+	key := ExecutionCacheKey{Task: &Task{
+		Repository: &graphql.Repository{Name: "src-cli"},
+		Steps:      []Step{{Run: "echo 'Hello World'", Container: "alpine:3"}},
+	}}
+	value := executionResult{Diff: testDiff, Outputs: map[string]interface{}{}}
+
+	// Results computed on another machine are found in the remote cache, and
+	// then stored locally.
+	if err := remote.Set(ctx, key, value); err != nil {
+		t.Fatal(err)
+	}
+	assertCacheMiss(t, local, key)
+	have, found, err := cache.Get(ctx, key)
+	if err != nil || !found {
+		t.Fatalf("unexpected cache miss: err=%v", err)
+	}
+	if diff := cmp.Diff(value, have); diff != "" {
+		t.Errorf("wrong cached result (-want +have):\n%s", diff)
+	}
+	assertCacheHit(t, local, key, value)
+
+	// Clearing removes the result from both caches.
+	if err := cache.Clear(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	assertCacheMiss(t, local, key)
+	if len(s.objects) != 0 {
+		t.Errorf("result not removed from remote cache: %v", s.objects)
+	}
+
+	// New results are stored in both caches.
+	if err := cache.Set(ctx, key, value); err != nil {
+		t.Fatal(err)
+	}
+	assertCacheHit(t, local, key, value)
+	if len(s.objects) != 1 {
+		t.Errorf("result not stored in remote cache: %v", s.objects)
+	}
+}
+
+func TestExecutionLayeredCache_RemoteErrors(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "execution-layered-cache-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(ts.Close)
+
+	remote, err := NewExecutionRemoteCache(ExecutionRemoteCacheOpts{URL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []error
+	local := ExecutionDiskCache{Dir: dir}
+	cache := ExecutionLayeredCache{
+		Local:  local,
+		Remote: remote,
+		Warn:   func(err error) { warnings = append(warnings, err) },
+	}
+
+	key := ExecutionCacheKey{Task: &Task{
+		Repository: &graphql.Repository{Name: "src-cli"},
+		Steps:      []Step{{Run: "echo 'Hello World'", Container: "alpine:3"}},
+	}}
+	value := executionResult{Diff: testDiff, Outputs: map[string]interface{}{}}
+
+	// An unavailable remote cache is a miss, and results are still stored
+	// locally.
+	if _, found, err := cache.Get(ctx, key); err != nil || found {
+		t.Fatalf("unexpected result: found=%t err=%v", found, err)
+	}
+	if err := cache.Set(ctx, key, value); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertCacheHit(t, local, key, value)
+	if err := cache.Clear(ctx, key); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertCacheMiss(t, local, key)
+
+	if len(warnings) != 3 {
+		t.Fatalf("wrong number of warnings: %v", warnings)
+	}
+	for _, err := range warnings {
+		if !strings.Contains(err.Error(), "503") {
+			t.Errorf("warning doesn't contain status: %s", err)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package batches
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+// RunJournal records the progress of executing a batch spec: the resolved
+// namespace and repositories, the tasks to execute and their outcome, and the
+// changeset specs that have been created on the Sourcegraph instance.
+//
+// The journal is written to disk after every change, so that an interrupted run
+// can be resumed where it stopped, without resolving repositories, executing
+// tasks or uploading changeset specs again. The resolved repositories and tasks
+// are written once when the run starts; finished tasks and created changeset
+// specs are then appended to a separate log, so that recording each of them
+// doesn't rewrite everything recorded before.
+type RunJournal struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// Spec is the raw batch spec of the run.
+	Spec string `json:"spec"`
+	// Namespace is the ID of the namespace the batch spec is created in.
+	Namespace string `json:"namespace"`
+
+	Repositories []*graphql.Repository `json:"repositories"`
+	Tasks        []*JournalTask        `json:"tasks"`
+
+	// ChangesetSpecIDs maps the hash of each changeset spec that has been
+	// created on the Sourcegraph instance to its ID.
+	ChangesetSpecIDs map[string]graphql.ChangesetSpecID `json:"changesetSpecIDs"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// journalEntry is a line in the log of a RunJournal: either the outcome of a
+// task, or a changeset spec that has been created.
+type journalEntry struct {
+	// Task is the index of the finished task in RunJournal.Tasks.
+	Task           *int             `json:"task,omitempty"`
+	State          JournalTaskState `json:"state,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	ChangesetSpecs []*ChangesetSpec `json:"changesetSpecs,omitempty"`
+
+	// ChangesetSpec is the hash of the created changeset spec.
+	ChangesetSpec   string                  `json:"changesetSpec,omitempty"`
+	ChangesetSpecID graphql.ChangesetSpecID `json:"changesetSpecID,omitempty"`
+}
+
+// JournalTaskState is the state of a task in a RunJournal.
+type JournalTaskState string
+
+const (
+	JournalTaskPending   JournalTaskState = "pending"
+	JournalTaskCompleted JournalTaskState = "completed"
+	JournalTaskFailed    JournalTaskState = "failed"
+)
+
+// JournalTask is a task recorded in a RunJournal.
+type JournalTask struct {
+	RepositoryID       string                 `json:"repositoryID"`
+	Path               string                 `json:"path"`
+	OnlyFetchWorkspace bool                   `json:"onlyFetchWorkspace,omitempty"`
+	Matrix             map[string]interface{} `json:"matrix,omitempty"`
+	State              JournalTaskState       `json:"state"`
+	Error              string                 `json:"error,omitempty"`
+
+	// ChangesetSpecs are the changeset specs produced by the task, once it
+	// has completed.
+	ChangesetSpecs []*ChangesetSpec `json:"changesetSpecs,omitempty"`
+}
+
+const (
+	runJournalExt    = ".json"
+	runJournalLogExt = ".log"
+)
+
+// NewRunJournal creates a journal for a new run of the given raw batch spec in
+// dir. The journal is only written once repositories have been resolved.
+func NewRunJournal(dir, spec, namespace string) (*RunJournal, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, errors.Wrap(err, "generating run ID")
+	}
+	now := time.Now().UTC()
+	id := now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+
+	return &RunJournal{
+		ID:               id,
+		StartedAt:        now,
+		Spec:             spec,
+		Namespace:        namespace,
+		ChangesetSpecIDs: map[string]graphql.ChangesetSpecID{},
+		path:             filepath.Join(dir, id+runJournalExt),
+	}, nil
+}
+
+// OpenRunJournal reads the journal of the run with the given ID from dir.
+func OpenRunJournal(dir, id string) (*RunJournal, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, errors.Errorf("invalid run ID %q", id)
+	}
+	path := filepath.Join(dir, id+runJournalExt)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("no run with ID %q found in %s", id, dir)
+		}
+		return nil, errors.Wrap(err, "reading run journal")
+	}
+
+	j := &RunJournal{path: path}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, errors.Wrapf(err, "parsing run journal %s", path)
+	}
+	if j.ChangesetSpecIDs == nil {
+		j.ChangesetSpecIDs = map[string]graphql.ChangesetSpecID{}
+	}
+	if err := j.replayLog(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Path returns the path of the journal file.
+func (j *RunJournal) Path() string { return j.path }
+
+func (j *RunJournal) logPath() string {
+	return strings.TrimSuffix(j.path, runJournalExt) + runJournalLogExt
+}
+
+// replayLog applies the entries of the log to the journal. A last entry that
+// was only partially written, because the run was interrupted while writing
+// it, is dropped from the log.
+func (j *RunJournal) replayLog() error {
+	f, err := os.OpenFile(j.logPath(), os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "reading run journal log")
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) > 0 {
+				return errors.Wrap(f.Truncate(offset), "truncating run journal log")
+			}
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "reading run journal log")
+		}
+		offset += int64(len(data))
+
+		var entry journalEntry
+		if err := json.Unmarshal(bytes.TrimSpace(data), &entry); err != nil {
+			return errors.Wrapf(err, "parsing line %d of run journal log %s", line, j.logPath())
+		}
+		if err := j.apply(&entry); err != nil {
+			return errors.Wrapf(err, "run journal log %s is corrupt: line %d", j.logPath(), line)
+		}
+	}
+}
+
+// apply updates the journal with the given log entry.
+func (j *RunJournal) apply(entry *journalEntry) error {
+	if entry.Task != nil {
+		if *entry.Task < 0 || *entry.Task >= len(j.Tasks) {
+			return errors.Errorf("unknown task %d", *entry.Task)
+		}
+		jt := j.Tasks[*entry.Task]
+		jt.State, jt.Error, jt.ChangesetSpecs = entry.State, entry.Error, entry.ChangesetSpecs
+	}
+	if entry.ChangesetSpec != "" {
+		j.ChangesetSpecIDs[entry.ChangesetSpec] = entry.ChangesetSpecID
+	}
+	return nil
+}
+
+// appendLog applies the entry to the journal and appends it to the log.
+func (j *RunJournal) appendLog(entry *journalEntry) error {
+	if err := j.apply(entry); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "serializing run journal entry")
+	}
+	f, err := os.OpenFile(j.logPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "writing run journal log")
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing run journal log")
+	}
+	return errors.Wrap(f.Close(), "writing run journal log")
+}
+
+// Started records the repositories and tasks of the run, and writes the
+// journal for the first time.
+func (j *RunJournal) Started(repos []*graphql.Repository, tasks []*Task) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Repositories = repos
+	j.Tasks = make([]*JournalTask, len(tasks))
+	for i, task := range tasks {
+		j.Tasks[i] = &JournalTask{
+			RepositoryID:       task.Repository.ID,
+			Path:               task.Path,
+			OnlyFetchWorkspace: task.OnlyFetchWorkspace,
+			Matrix:             task.Matrix,
+			State:              JournalTaskPending,
+		}
+	}
+	return j.save()
+}
+
+// RestoreTasks rebuilds the tasks of the run for the given batch spec. Tasks
+// that already completed aren't returned; their changeset specs are returned
+// instead.
+func (j *RunJournal) RestoreTasks(spec *BatchSpec) (pending []*Task, completed []*ChangesetSpec, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	repos := make(map[string]*graphql.Repository, len(j.Repositories))
+	for _, repo := range j.Repositories {
+		repos[repo.ID] = repo
+	}
+
+	attr := &BatchChangeAttributes{Name: spec.Name, Description: spec.Description}
+	for _, jt := range j.Tasks {
+		if jt.State == JournalTaskCompleted {
+			completed = append(completed, jt.ChangesetSpecs...)
+			continue
+		}
+
+		repo, ok := repos[jt.RepositoryID]
+		if !ok {
+			return nil, nil, errors.Errorf("run journal %s is corrupt: unknown repository %q", j.path, jt.RepositoryID)
+		}
+		pending = append(pending, &Task{
+			Repository:            repo,
+			Path:                  jt.Path,
+			OnlyFetchWorkspace:    jt.OnlyFetchWorkspace,
+			Steps:                 spec.Steps,
+			Matrix:                jt.Matrix,
+			TransformChanges:      spec.TransformChanges,
+			Template:              spec.ChangesetTemplate,
+			BatchChangeAttributes: attr,
+		})
+	}
+	return pending, completed, nil
+}
+
+// TaskFinished records the outcome of executing the given task.
+func (j *RunJournal) TaskFinished(task *Task, specs []*ChangesetSpec, taskErr error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i, jt := range j.Tasks {
+		if jt.RepositoryID != task.Repository.ID || jt.Path != task.Path || !reflect.DeepEqual(jt.Matrix, task.Matrix) {
+			continue
+		}
+
+		index := i
+		entry := &journalEntry{Task: &index}
+		if taskErr != nil {
+			entry.State = JournalTaskFailed
+			entry.Error = taskErr.Error()
+		} else {
+			entry.State = JournalTaskCompleted
+			entry.ChangesetSpecs = specs
+		}
+		return j.appendLog(entry)
+	}
+	return nil
+}
+
+// ChangesetSpecID returns the ID of the given changeset spec, if it has already
+// been created in this run.
+func (j *RunJournal) ChangesetSpecID(spec *ChangesetSpec) (graphql.ChangesetSpecID, bool, error) {
+	key, err := changesetSpecKey(spec)
+	if err != nil {
+		return "", false, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	id, ok := j.ChangesetSpecIDs[key]
+	return id, ok, nil
+}
+
+// ChangesetSpecCreated records that the given changeset spec has been created
+// with the given ID.
+func (j *RunJournal) ChangesetSpecCreated(spec *ChangesetSpec, id graphql.ChangesetSpecID) error {
+	key, err := changesetSpecKey(spec)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.appendLog(&journalEntry{ChangesetSpec: key, ChangesetSpecID: id})
+}
+
+// CreatedChangesetSpecIDs returns the IDs of the changeset specs that have
+// been created in this run.
+func (j *RunJournal) CreatedChangesetSpecIDs() []graphql.ChangesetSpecID {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ids := make([]graphql.ChangesetSpecID, 0, len(j.ChangesetSpecIDs))
+	for _, id := range j.ChangesetSpecIDs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ForgetChangesetSpecIDs forgets that the changeset specs with the given IDs
+// have been created, so that they are created again: the server discards
+// changeset specs that aren't used by a batch spec after a while, so those of
+// a run that is resumed much later may be gone.
+func (j *RunJournal) ForgetChangesetSpecIDs(ids []graphql.ChangesetSpecID) {
+	forget := make(map[graphql.ChangesetSpecID]bool, len(ids))
+	for _, id := range ids {
+		forget[id] = true
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for key, id := range j.ChangesetSpecIDs {
+		if forget[id] {
+			delete(j.ChangesetSpecIDs, key)
+		}
+	}
+}
+
+// Remove deletes the journal once the run has finished.
+func (j *RunJournal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, path := range []string{j.logPath(), j.path} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes the journal when the run starts. It is written to a temporary
+// file first, so that a crash while writing doesn't leave a truncated journal
+// behind.
+func (j *RunJournal) save() error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return errors.Wrap(err, "serializing run journal")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrap(err, "writing run journal")
+	}
+	return errors.Wrap(os.Rename(tmp, j.path), "writing run journal")
+}
+
+func changesetSpecKey(spec *ChangesetSpec) (string, error) {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling changeset spec JSON")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(raw)), nil
+}
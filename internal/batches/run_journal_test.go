@@ -0,0 +1,196 @@
+package batches
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+)
+
+func TestRunJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run-journal-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	repo1 := &graphql.Repository{ID: "repo-1", Name: "github.com/sourcegraph/src-cli"}
+	repo2 := &graphql.Repository{ID: "repo-2", Name: "github.com/sourcegraph/sourcegraph"}
+	spec := &BatchSpec{
+		Name:              "my-batch-change",
+		Steps:             []Step{{Run: "echo hello", Container: "alpine:3"}},
+		ChangesetTemplate: &ChangesetTemplate{Title: "Hello"},
+	}
+	tasks := []*Task{
+		{Repository: repo1, Path: ""},
+		{Repository: repo2, Path: "a", OnlyFetchWorkspace: true},
+		{Repository: repo2, Path: "b", Matrix: map[string]interface{}{"version": "1"}},
+		{Repository: repo2, Path: "b", Matrix: map[string]interface{}{"version": "2"}},
+	}
+	changesetSpec := &ChangesetSpec{
+		BaseRepository: "repo-1",
+		CreatedChangeset: &CreatedChangeset{
+			HeadRef: "refs/heads/hello",
+			Title:   "Hello",
+			Commits: []GitCommitDescription{{Message: "Hello", Diff: testDiff}},
+		},
+	}
+
+	journal, err := NewRunJournal(dir, "name: my-batch-change", "namespace-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Started([]*graphql.Repository{repo1, repo2}, tasks); err != nil {
+		t.Fatal(err)
+	}
+	started, err := ioutil.ReadFile(journal.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.TaskFinished(tasks[0], []*ChangesetSpec{changesetSpec}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.TaskFinished(tasks[2], nil, errors.New("interrupted")); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.TaskFinished(tasks[3], nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.ChangesetSpecCreated(changesetSpec, "changeset-spec-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Finished tasks and created changeset specs are appended to the log,
+	// without rewriting the journal.
+	if have, err := ioutil.ReadFile(journal.Path()); err != nil {
+		t.Fatal(err)
+	} else if string(have) != string(started) {
+		t.Error("journal was rewritten after it was started")
+	}
+
+	// Reading the journal back from disk, as a resumed run would.
+	resumed, err := OpenRunJournal(dir, journal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Spec != journal.Spec || resumed.Namespace != journal.Namespace {
+		t.Errorf("wrong spec or namespace: have=(%q, %q)", resumed.Spec, resumed.Namespace)
+	}
+	if have, want := resumed.Tasks[2].State, JournalTaskFailed; have != want {
+		t.Errorf("wrong state of failed task: have=%q want=%q", have, want)
+	}
+
+	pending, completed, err := resumed.RestoreTasks(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type taskKey struct {
+		Repository         string
+		Path               string
+		OnlyFetchWorkspace bool
+		Matrix             string
+	}
+	var havePending []taskKey
+	for _, task := range pending {
+		havePending = append(havePending, taskKey{task.Repository.ID, task.Path, task.OnlyFetchWorkspace, describeMatrixEntry(task.Matrix)})
+		if task.BatchChangeAttributes.Name != spec.Name || len(task.Steps) != 1 || task.Template != spec.ChangesetTemplate {
+			t.Errorf("task not restored from batch spec: %+v", task)
+		}
+	}
+	wantPending := []taskKey{{"repo-2", "a", true, ""}, {"repo-2", "b", false, "version=1"}}
+	if diff := cmp.Diff(wantPending, havePending); diff != "" {
+		t.Errorf("wrong pending tasks (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]*ChangesetSpec{changesetSpec}, completed); diff != "" {
+		t.Errorf("wrong completed changeset specs (-want +got):\n%s", diff)
+	}
+
+	id, ok, err := resumed.ChangesetSpecID(completed[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || id != "changeset-spec-1" {
+		t.Errorf("wrong changeset spec ID: have=(%q, %v)", id, ok)
+	}
+
+	if diff := cmp.Diff([]graphql.ChangesetSpecID{"changeset-spec-1"}, resumed.CreatedChangesetSpecIDs()); diff != "" {
+		t.Errorf("wrong created changeset specs (-want +got):\n%s", diff)
+	}
+	resumed.ForgetChangesetSpecIDs([]graphql.ChangesetSpecID{"changeset-spec-1"})
+	if _, ok, _ := resumed.ChangesetSpecID(completed[0]); ok {
+		t.Error("forgotten changeset spec ID is still returned")
+	}
+
+	if err := resumed.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenRunJournal(dir, journal.ID); err == nil {
+		t.Error("unexpected nil error opening removed journal")
+	}
+	if _, err := os.Stat(resumed.logPath()); !os.IsNotExist(err) {
+		t.Errorf("log not removed: %v", err)
+	}
+}
+
+func TestRunJournal_TruncatedLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "run-journal-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	repo := &graphql.Repository{ID: "repo-1", Name: "github.com/sourcegraph/src-cli"}
+	tasks := []*Task{{Repository: repo, Path: "a"}, {Repository: repo, Path: "b"}}
+
+	journal, err := NewRunJournal(dir, "name: my-batch-change", "namespace-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Started([]*graphql.Repository{repo}, tasks); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.TaskFinished(tasks[0], nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The run is interrupted while writing the next entry.
+	f, err := os.OpenFile(journal.logPath(), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"task":1,"sta`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	resumed, err := OpenRunJournal(dir, journal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := []JournalTaskState{resumed.Tasks[0].State, resumed.Tasks[1].State}; have[0] != JournalTaskCompleted || have[1] != JournalTaskPending {
+		t.Errorf("wrong task states: %v", have)
+	}
+
+	// Entries appended after resuming must still be read.
+	if err := resumed.TaskFinished(tasks[1], nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	again, err := OpenRunJournal(dir, journal.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := again.Tasks[1].State; have != JournalTaskCompleted {
+		t.Errorf("wrong state of task finished after resuming: %q", have)
+	}
+}
+
+func TestOpenRunJournal_InvalidID(t *testing.T) {
+	for _, id := range []string{"", "../runs", "a/b"} {
+		if _, err := OpenRunJournal(os.TempDir(), id); err == nil {
+			t.Errorf("unexpected nil error for ID %q", id)
+		}
+	}
+}
@@ -33,6 +33,56 @@ type executionResult struct {
 	// have been executed.
 	// No leading slashes. Root directory is blank string.
 	Path string
+
+	// SkippedSteps are the numbers, starting at 1, of the steps that were
+	// skipped because their "if" condition wasn't met.
+	SkippedSteps []int `json:"skippedSteps,omitempty"`
+
+	// FailedSteps are the numbers, starting at 1, of the steps that failed
+	// but allowed failure.
+	FailedSteps []int `json:"failedSteps,omitempty"`
+
+	// Commits are the commits ended by steps with a commit, in order. If no
+	// step ended a commit, there are none and Diff is the only commit.
+	Commits []executionCommit `json:"commits,omitempty"`
+}
+
+// executionCommit is a commit ended by a step.
+type executionCommit struct {
+	// Message is the rendered commit message. It's empty for the commit of
+	// the changes made after the last step with a commit, which uses the
+	// message of the changeset template.
+	Message string `json:"message,omitempty"`
+	// Diff are the changes made since the previous commit.
+	Diff string `json:"diff"`
+}
+
+// stepNetwork returns the network of a step, or the default network if the
+// step doesn't set one.
+func stepNetwork(network, defaultNetwork string) string {
+	if network == "" {
+		return defaultNetwork
+	}
+	return network
+}
+
+// stepRetryBaseDelay is how long to wait before retrying a failed step for the
+// first time. The delay doubles with each further attempt, up to
+// stepRetryMaxDelay.
+var (
+	stepRetryBaseDelay = 2 * time.Second
+	stepRetryMaxDelay  = time.Minute
+)
+
+func stepRetryDelay(attempt int) time.Duration {
+	delay := stepRetryBaseDelay
+	for i := 1; i < attempt && delay < stepRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > stepRetryMaxDelay {
+		delay = stepRetryMaxDelay
+	}
+	return delay
 }
 
 type executionOpts struct {
@@ -44,8 +94,15 @@ type executionOpts struct {
 	batchChangeAttributes *BatchChangeAttributes
 	repo                  *graphql.Repository
 	steps                 []Step
+	matrix                map[string]interface{}
 
 	tempDir string
+	runtime Runtime
+
+	// resources and network are the defaults for steps that don't set their
+	// own.
+	resources StepResources
+	network   string
 
 	logger         *TaskLogger
 	reportProgress func(string)
@@ -72,52 +129,36 @@ func runSteps(ctx context.Context, opts *executionOpts) (result executionResult,
 	}
 	results := make([]StepResult, len(opts.steps))
 
+	// snapshot is the state of the workspace at the last commit.
+	var snapshot string
+
 	for i, step := range opts.steps {
 		opts.reportProgress(fmt.Sprintf("Preparing step %d", i+1))
 
-		stepContext := StepContext{BatchChange: *opts.batchChangeAttributes, Repository: *opts.repo, Outputs: execResult.Outputs}
+		stepContext := StepContext{BatchChange: *opts.batchChangeAttributes, Repository: *opts.repo, Outputs: execResult.Outputs, Matrix: opts.matrix}
 		if i > 0 {
 			stepContext.PreviousStep = results[i-1]
 		}
 
-		// Find a location that we can use for a cidfile, which will contain the
-		// container ID that is used below. We can then use this to remove the
-		// container on a successful run, rather than leaving it dangling.
-		cidFile, err := ioutil.TempFile(opts.tempDir, opts.repo.Slug()+"-container-id")
+		run, err := evalStepCondition(step.condition(), &stepContext)
 		if err != nil {
-			return execResult, errors.Wrap(err, "Creating a CID file failed")
+			return execResult, errors.Wrap(err, "evaluating step condition")
 		}
-
-		// However, Docker will fail if the cidfile actually exists, so we need
-		// to remove it. Because Windows can't remove open files, we'll first
-		// close it, even though that's unnecessary elsewhere.
-		cidFile.Close()
-		if err = os.Remove(cidFile.Name()); err != nil {
-			return execResult, errors.Wrap(err, "removing cidfile")
-		}
-
-		// Since we went to all that effort, we can now defer a function that
-		// uses the cidfile to clean up after this function is done.
-		defer func() {
-			cid, err := ioutil.ReadFile(cidFile.Name())
-			_ = os.Remove(cidFile.Name())
-			if err == nil {
-				ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-				defer cancel()
-				_ = exec.CommandContext(ctx, "docker", "rm", "-f", "--", string(cid)).Run()
+		if !run {
+			opts.logger.Logf("[Step %d] skipped: condition %q is not true", i+1, step.condition())
+			execResult.SkippedSteps = append(execResult.SkippedSteps, i+1)
+
+			// A skipped step doesn't change anything, so the next step sees
+			// the result of the last step that was executed.
+			if i > 0 {
+				results[i] = results[i-1]
 			}
-		}()
-
-		// We need to grab the digest for the exact image we're using.
-		digest, err := step.image.Digest(ctx)
-		if err != nil {
-			return execResult, errors.Wrapf(err, "getting digest for %v", step.image)
+			continue
 		}
 
-		// For now, we only support shell scripts provided via the Run field.
-		shell, containerTemp, err := probeImageForShell(ctx, digest)
+		timeout, err := step.timeout()
 		if err != nil {
-			return execResult, errors.Wrapf(err, "probing image %q for shell", step.image)
+			return execResult, errors.Wrap(err, "parsing step timeout")
 		}
 
 		// Set up a temporary file on the host filesystem to contain the
@@ -161,7 +202,7 @@ func runSteps(ctx context.Context, opts *executionOpts) (result executionResult,
 
 		// Create temp files with the rendered content of step.Files so that we
 		// can mount them into the container.
-		filesToMount := make(map[string]*os.File, len(files))
+		filesToMount := make(map[string]string, len(files))
 		for name, content := range files {
 			fp, err := ioutil.TempFile(opts.tempDir, "")
 			if err != nil {
@@ -177,7 +218,7 @@ func runSteps(ctx context.Context, opts *executionOpts) (result executionResult,
 				return execResult, errors.Wrap(err, "closing temporary file")
 			}
 
-			filesToMount[name] = fp
+			filesToMount[name] = fp.Name()
 		}
 
 		// Resolve step.Env given the current environment.
@@ -192,68 +233,129 @@ func runSteps(ctx context.Context, opts *executionOpts) (result executionResult,
 			return execResult, errors.Wrap(err, "parsing step environment")
 		}
 
-		opts.reportProgress(runScript.String())
-		const workDir = "/work"
-		workspaceOpts, err := workspace.DockerRunOpts(ctx, workDir)
+		secrets, err := step.Secrets.resolve(os.Environ())
 		if err != nil {
-			return execResult, errors.Wrap(err, "getting Docker options for workspace")
+			return execResult, errors.Wrap(err, "resolving step secrets")
 		}
-
-		// Where should we execute the steps.run script?
-		scriptWorkDir := workDir
-		if opts.path != "" {
-			scriptWorkDir = workDir + "/" + opts.path
+		for name := range secrets {
+			if _, ok := env[name]; ok {
+				return execResult, errors.Errorf("%s is both an environment variable and a secret of the step", name)
+			}
 		}
 
-		args := append([]string{
-			"run",
-			"--rm",
-			"--init",
-			"--cidfile", cidFile.Name(),
-			"--workdir", scriptWorkDir,
-			"--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", runScriptFile.Name(), containerTemp),
-		}, workspaceOpts...)
-		for target, source := range filesToMount {
-			args = append(args, "--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", source.Name(), target))
+		prepared, err := opts.runtime.prepareStep(ctx, &stepRunOpts{
+			step:       &opts.steps[i],
+			workspace:  workspace,
+			path:       opts.path,
+			tempDir:    opts.tempDir,
+			repo:       opts.repo.Slug(),
+			scriptFile: runScriptFile.Name(),
+			files:      filesToMount,
+			env:        env,
+			secrets:    secrets,
+			resources:  step.Resources.withDefaults(opts.resources),
+			network:    stepNetwork(step.Network, opts.network),
+		})
+		if err != nil {
+			return execResult, errors.Wrapf(err, "preparing step to run with %s", opts.runtime.Name())
 		}
+		// Clean up after the step once this function is done.
+		defer prepared.cleanup(ctx)
+
+		opts.reportProgress(runScript.String())
+		opts.logger.Logf("[Step %d] run: %q, container: %q", i+1, step.Run, step.Container)
 
-		for k, v := range env {
-			args = append(args, "-e", k+"="+v)
+		// Every attempt starts out with the workspace as it was before the
+		// step, rather than with what a failed attempt left behind.
+		var beforeStep string
+		if step.Retries > 0 {
+			if beforeStep, err = workspace.Snapshot(ctx); err != nil {
+				return execResult, errors.Wrap(err, "taking snapshot of workspace before step")
+			}
 		}
 
-		args = append(args, "--entrypoint", shell)
+		var (
+			cmd                        *exec.Cmd
+			stdoutBuffer, stderrBuffer bytes.Buffer
+		)
+		for attempt := 1; ; attempt++ {
+			attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+			if timeout > 0 {
+				attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+			}
 
-		cmd := exec.CommandContext(ctx, "docker", args...)
-		cmd.Args = append(cmd.Args, "--", digest, containerTemp)
-		if dir := workspace.WorkDir(); dir != nil {
-			cmd.Dir = *dir
-		}
+			cmd = prepared.command(attemptCtx)
+
+			// Secrets are redacted from the output before it is captured or
+			// logged.
+			stdoutBuffer.Reset()
+			stderrBuffer.Reset()
+			stdout := newRedactingWriter(io.MultiWriter(&stdoutBuffer, opts.logger.PrefixWriter("stdout")), secrets)
+			stderr := newRedactingWriter(io.MultiWriter(&stderrBuffer, opts.logger.PrefixWriter("stderr")), secrets)
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
+
+			opts.logger.Logf("[Step %d] full command: %q", i+1, strings.Join(cmd.Args, " "))
+
+			t0 := time.Now()
+			err = cmd.Run()
+			elapsed := time.Since(t0).Round(time.Millisecond)
+			stdout.Flush()
+			stderr.Flush()
+			timedOut := attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+			cancel()
+			if err == nil {
+				opts.logger.Logf("[Step %d] complete in %s", i+1, elapsed)
+				break
+			}
+			if timedOut {
+				err = &errTimeoutReached{timeout: timeout}
+			}
+			opts.logger.Logf("[Step %d] took %s; error running step: %+v", i+1, elapsed, err)
 
-		var stdoutBuffer, stderrBuffer bytes.Buffer
-		cmd.Stdout = io.MultiWriter(&stdoutBuffer, opts.logger.PrefixWriter("stdout"))
-		cmd.Stderr = io.MultiWriter(&stderrBuffer, opts.logger.PrefixWriter("stderr"))
+			if attempt > step.Retries || ctx.Err() != nil {
+				break
+			}
 
-		opts.logger.Logf("[Step %d] run: %q, container: %q", i+1, step.Run, step.Container)
-		opts.logger.Logf("[Step %d] full command: %q", i+1, strings.Join(cmd.Args, " "))
+			// The failed container may still be around if it was killed, and
+			// Docker refuses to reuse an existing cidfile.
+			prepared.cleanup(ctx)
 
-		t0 := time.Now()
-		err = cmd.Run()
-		elapsed := time.Since(t0).Round(time.Millisecond)
-		if err != nil {
-			opts.logger.Logf("[Step %d] took %s; error running Docker container: %+v", i+1, elapsed, err)
+			delay := stepRetryDelay(attempt)
+			opts.logger.Logf("[Step %d] retrying in %s (attempt %d of %d)", i+1, delay, attempt+1, step.Retries+1)
+			opts.reportProgress(fmt.Sprintf("Retrying step %d in %s (attempt %d of %d)", i+1, delay, attempt+1, step.Retries+1))
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			if restoreErr := workspace.Restore(ctx, beforeStep); restoreErr != nil {
+				return execResult, errors.Wrap(restoreErr, "restoring workspace before retrying step")
+			}
+			opts.reportProgress(runScript.String())
+		}
 
-			return execResult, stepFailedErr{
+		if err != nil {
+			failedErr := stepFailedErr{
 				Err:         err,
 				Args:        cmd.Args,
 				Run:         runScript.String(),
 				Container:   step.Container,
-				TmpFilename: containerTemp,
+				TmpFilename: prepared.scriptPath,
 				Stdout:      strings.TrimSpace(stdoutBuffer.String()),
 				Stderr:      strings.TrimSpace(stderrBuffer.String()),
 			}
-		}
+			// An interrupted or timed out task is never a failure that the
+			// step allows.
+			if !step.AllowFailure || ctx.Err() != nil {
+				return execResult, failedErr
+			}
 
-		opts.logger.Logf("[Step %d] complete in %s", i+1, elapsed)
+			opts.logger.Logf("[Step %d] failed, continuing because allowFailure is set: %s", i+1, failedErr.SingleLineError())
+			execResult.FailedSteps = append(execResult.FailedSteps, i+1)
+		}
 
 		changes, err := workspace.Changes(ctx)
 		if err != nil {
@@ -268,6 +370,36 @@ func runSteps(ctx context.Context, opts *executionOpts) (result executionResult,
 			return execResult, errors.Wrap(err, "setting step outputs")
 		}
 
+		if step.Commit != nil {
+			var message bytes.Buffer
+			if err := renderStepTemplate("step-commit", step.Commit.Message, &message, &stepContext); err != nil {
+				return execResult, errors.Wrap(err, "parsing step commit message")
+			}
+
+			opts.reportProgress(fmt.Sprintf("Committing changes of step %d", i+1))
+			diff, err := diffSinceSnapshot(ctx, workspace, &snapshot)
+			if err != nil {
+				return execResult, errors.Wrap(err, "committing changes")
+			}
+			if diff == "" {
+				opts.logger.Logf("[Step %d] nothing to commit", i+1)
+			} else {
+				opts.logger.Logf("[Step %d] committed changes: %q", i+1, message.String())
+				execResult.Commits = append(execResult.Commits, executionCommit{Message: message.String(), Diff: diff})
+			}
+		}
+	}
+
+	if len(execResult.Commits) > 0 {
+		// The changes made after the last commit make up a final commit.
+		opts.reportProgress("Committing remaining changes")
+		diff, err := diffSinceSnapshot(ctx, workspace, &snapshot)
+		if err != nil {
+			return execResult, errors.Wrap(err, "committing changes")
+		}
+		if diff != "" {
+			execResult.Commits = append(execResult.Commits, executionCommit{Diff: diff})
+		}
 	}
 
 	opts.reportProgress("Calculating diff")
@@ -284,6 +416,23 @@ func runSteps(ctx context.Context, opts *executionOpts) (result executionResult,
 	return execResult, err
 }
 
+// diffSinceSnapshot takes a snapshot of the workspace and returns the changes
+// made since the previous snapshot, which it replaces.
+func diffSinceSnapshot(ctx context.Context, workspace Workspace, previous *string) (string, error) {
+	snapshot, err := workspace.Snapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	diff, err := workspace.DiffSnapshots(ctx, *previous, snapshot)
+	if err != nil {
+		return "", err
+	}
+
+	*previous = snapshot
+	return string(diff), nil
+}
+
 func setOutputs(stepOutputs Outputs, global map[string]interface{}, stepCtx *StepContext) error {
 	for name, output := range stepOutputs {
 		var value bytes.Buffer
@@ -317,7 +466,7 @@ func setOutputs(stepOutputs Outputs, global map[string]interface{}, stepCtx *Ste
 	return nil
 }
 
-func probeImageForShell(ctx context.Context, image string) (shell, tempfile string, err error) {
+func probeImageForShell(ctx context.Context, binary, image string) (shell, tempfile string, err error) {
 	// We need to know two things to be able to run a shell script:
 	//
 	// 1. Which shell is available. We're going to look for /bin/bash and then
@@ -343,7 +492,7 @@ func probeImageForShell(ctx context.Context, image string) (shell, tempfile stri
 
 		args := []string{"run", "--rm", "--entrypoint", shell, image, "-c", "mktemp"}
 
-		cmd := exec.CommandContext(ctx, "docker", args...)
+		cmd := containerCommand(ctx, binary, args...)
 		cmd.Stdout = stdout
 		cmd.Stderr = stderr
 
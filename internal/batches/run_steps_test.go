@@ -0,0 +1,42 @@
+package batches
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStepRetryDelay(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{
+		1:  2 * time.Second,
+		2:  4 * time.Second,
+		3:  8 * time.Second,
+		5:  32 * time.Second,
+		6:  time.Minute,
+		50: time.Minute,
+	} {
+		if have := stepRetryDelay(attempt); have != want {
+			t.Errorf("attempt %d: have=%s want=%s", attempt, have, want)
+		}
+	}
+}
+
+func TestStepTimeout(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"":      0,
+		"30s":   30 * time.Second,
+		"1h30m": 90 * time.Minute,
+	} {
+		have, err := (&Step{Timeout: in}).timeout()
+		if err != nil {
+			t.Errorf("timeout %q: unexpected error: %s", in, err)
+		} else if have != want {
+			t.Errorf("timeout %q: have=%s want=%s", in, have, want)
+		}
+	}
+
+	for _, in := range []string{"soon", "10", "-5m", "0s"} {
+		if _, err := (&Step{Timeout: in}).timeout(); err == nil {
+			t.Errorf("timeout %q: unexpected nil error", in)
+		}
+	}
+}
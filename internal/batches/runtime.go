@@ -0,0 +1,336 @@
+package batches
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	goexec "os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/sourcegraph/src-cli/internal/exec"
+)
+
+// Runtime runs the steps of a batch spec. Steps either run in containers,
+// managed by Docker or a command line compatible tool such as Podman, or
+// natively on the host.
+type Runtime interface {
+	// Name returns the name of the runtime, as accepted by NewRuntime.
+	Name() string
+
+	// Check returns an error if the runtime can't be used on this machine.
+	Check(ctx context.Context) error
+
+	// ContainerBinary returns the command line tool used to manage images and
+	// containers, or an empty string if the runtime doesn't use containers.
+	ContainerBinary() string
+
+	// prepareStep prepares a single step to be run in a workspace.
+	prepareStep(ctx context.Context, opts *stepRunOpts) (*preparedStep, error)
+}
+
+// RuntimeNames are the names of the available runtimes.
+var RuntimeNames = []string{"docker", "podman", "native"}
+
+// NewRuntime returns the runtime with the given name. If name is empty, Docker
+// is used.
+func NewRuntime(name string) (Runtime, error) {
+	switch name {
+	case "", "docker":
+		return defaultRuntime, nil
+	case "podman":
+		return &containerRuntime{binary: "podman"}, nil
+	case "native":
+		return &nativeRuntime{}, nil
+	default:
+		return nil, errors.Errorf("unknown runtime %q: must be one of %s", name, strings.Join(RuntimeNames, ", "))
+	}
+}
+
+var defaultRuntime Runtime = &containerRuntime{binary: "docker"}
+
+// stepRunOpts are the inputs that a runtime needs to run a step.
+type stepRunOpts struct {
+	step      *Step
+	workspace Workspace
+
+	// path is the directory, relative to the root of the workspace, in which
+	// the step is run.
+	path string
+
+	tempDir string
+	repo    string
+
+	// scriptFile is the rendered step script on the host.
+	scriptFile string
+	// files maps the target path of each of the step's files to a file on the
+	// host with its rendered content.
+	files map[string]string
+	// env is the rendered environment of the step.
+	env map[string]string
+	// secrets are the values of the step's secrets. They are passed in the
+	// environment, but must never appear in the arguments of a command.
+	secrets map[string]string
+
+	// resources and network are the effective limits and network of the step.
+	resources StepResources
+	network   string
+}
+
+// preparedStep is a step that is ready to be run.
+type preparedStep struct {
+	// command returns a new command that runs the step once.
+	command func(ctx context.Context) *goexec.Cmd
+
+	// cleanup removes everything left behind by running the step. It is
+	// called before the step is retried and once the step has finished.
+	cleanup func(ctx context.Context)
+
+	// scriptPath is the path of the step script, as seen by the step.
+	scriptPath string
+}
+
+// containerRuntime runs steps in containers using the docker command line
+// tool, or another tool that is compatible with it, such as podman.
+type containerRuntime struct {
+	binary string
+}
+
+var _ Runtime = &containerRuntime{}
+
+func (r *containerRuntime) Name() string            { return r.binary }
+func (r *containerRuntime) ContainerBinary() string { return r.binary }
+
+func (r *containerRuntime) Check(ctx context.Context) error {
+	if err := containerCommand(ctx, r.binary, "version").Run(); err != nil {
+		return fmt.Errorf(
+			"failed to execute \"%s version\":\n\t%s\n\n'src batch' requires %q to be available, unless a different runtime is selected with -runtime.",
+			r.binary,
+			err,
+			r.binary,
+		)
+	}
+	return nil
+}
+
+func (r *containerRuntime) prepareStep(ctx context.Context, opts *stepRunOpts) (*preparedStep, error) {
+	// Find a location that we can use for a cidfile, which will contain the
+	// container ID that is used below. We can then use this to remove the
+	// container on a successful run, rather than leaving it dangling.
+	cidFile, err := ioutil.TempFile(opts.tempDir, opts.repo+"-container-id")
+	if err != nil {
+		return nil, errors.Wrap(err, "Creating a CID file failed")
+	}
+
+	// However, Docker will fail if the cidfile actually exists, so we need
+	// to remove it. Because Windows can't remove open files, we'll first
+	// close it, even though that's unnecessary elsewhere.
+	cidFile.Close()
+	if err = os.Remove(cidFile.Name()); err != nil {
+		return nil, errors.Wrap(err, "removing cidfile")
+	}
+
+	// We need to grab the digest for the exact image we're using.
+	digest, err := opts.step.image.Digest(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting digest for %v", opts.step.image)
+	}
+
+	// For now, we only support shell scripts provided via the Run field.
+	shell, containerTemp, err := probeImageForShell(ctx, r.binary, digest)
+	if err != nil {
+		return nil, errors.Wrapf(err, "probing image %q for shell", opts.step.image)
+	}
+
+	const workDir = "/work"
+	workspaceOpts, err := opts.workspace.DockerRunOpts(ctx, workDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting Docker options for workspace")
+	}
+
+	// Where should we execute the steps.run script?
+	scriptWorkDir := workDir
+	if opts.path != "" {
+		scriptWorkDir = workDir + "/" + opts.path
+	}
+
+	args := append([]string{
+		"run",
+		"--rm",
+		"--init",
+		"--cidfile", cidFile.Name(),
+		"--workdir", scriptWorkDir,
+		"--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", opts.scriptFile, containerTemp),
+	}, workspaceOpts...)
+	for target, source := range opts.files {
+		args = append(args, "--mount", fmt.Sprintf("type=bind,source=%s,target=%s,ro", source, target))
+	}
+
+	args = append(args, containerLimitArgs(opts.resources, opts.network)...)
+
+	for k, v := range opts.env {
+		args = append(args, "-e", k+"="+v)
+	}
+
+	// Without a value, the container gets the value of the variable in the
+	// environment of the container command line tool, which keeps secrets out
+	// of the arguments.
+	secretNames := sortedKeys(opts.secrets)
+	for _, name := range secretNames {
+		args = append(args, "-e", name)
+	}
+
+	args = append(args, "--entrypoint", shell, "--", digest, containerTemp)
+
+	return &preparedStep{
+		command: func(ctx context.Context) *goexec.Cmd {
+			cmd := containerCommand(ctx, r.binary, args...)
+			if dir := opts.workspace.WorkDir(); dir != nil {
+				cmd.Dir = *dir
+			}
+			if len(secretNames) > 0 {
+				if cmd.Env == nil {
+					cmd.Env = os.Environ()
+				}
+				for _, name := range secretNames {
+					cmd.Env = append(cmd.Env, name+"="+opts.secrets[name])
+				}
+			}
+			return cmd
+		},
+		cleanup: func(ctx context.Context) {
+			removeContainer(ctx, r.binary, cidFile.Name())
+		},
+		scriptPath: containerTemp,
+	}, nil
+}
+
+// containerLimitArgs returns the run options that apply the given resource
+// limits and network to a container.
+func containerLimitArgs(resources StepResources, network string) []string {
+	var args []string
+	if resources.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(resources.CPUs, 'f', -1, 64))
+	}
+	if resources.Memory != "" {
+		args = append(args, "--memory", resources.Memory)
+	}
+	if resources.PidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(resources.PidsLimit))
+	}
+	if network != "" {
+		args = append(args, "--network", network)
+	}
+	return args
+}
+
+// nativeRuntime runs step scripts directly on the host, in the directory of
+// the workspace. Steps aren't isolated from the host in any way, so this
+// should only be used for batch specs that are trusted.
+type nativeRuntime struct{}
+
+var _ Runtime = &nativeRuntime{}
+
+func (*nativeRuntime) Name() string            { return "native" }
+func (*nativeRuntime) ContainerBinary() string { return "" }
+
+func (*nativeRuntime) Check(ctx context.Context) error {
+	_, err := nativeShell()
+	return err
+}
+
+func (*nativeRuntime) prepareStep(ctx context.Context, opts *stepRunOpts) (*preparedStep, error) {
+	if len(opts.files) > 0 {
+		return nil, errors.New("step files aren't supported by the native runtime")
+	}
+	// Steps run with the resources and network of the host, so refuse to run
+	// steps that expect to be restricted.
+	if !opts.resources.IsZero() {
+		return nil, errors.New("resource limits aren't supported by the native runtime")
+	}
+	if opts.network != "" && opts.network != "host" {
+		return nil, errors.Errorf("network %q isn't supported by the native runtime", opts.network)
+	}
+
+	// Only workspaces on the host filesystem have a working directory.
+	root := opts.workspace.WorkDir()
+	if root == nil {
+		return nil, errors.New("the native runtime requires a workspace on the host filesystem")
+	}
+
+	shell, err := nativeShell()
+	if err != nil {
+		return nil, err
+	}
+
+	// Steps see the environment of src, just as if they had been run from the
+	// shell, with the step environment and secrets on top.
+	var env []string
+	for _, name := range sortedKeys(opts.env) {
+		env = append(env, name+"="+opts.env[name])
+	}
+	for _, name := range sortedKeys(opts.secrets) {
+		env = append(env, name+"="+opts.secrets[name])
+	}
+
+	return &preparedStep{
+		command: func(ctx context.Context) *goexec.Cmd {
+			cmd := exec.CommandContext(ctx, shell, opts.scriptFile)
+			cmd.Dir = filepath.Join(*root, filepath.FromSlash(opts.path))
+			if cmd.Env == nil {
+				cmd.Env = os.Environ()
+			}
+			cmd.Env = append(cmd.Env, env...)
+			return cmd
+		},
+		cleanup:    func(context.Context) {},
+		scriptPath: opts.scriptFile,
+	}, nil
+}
+
+// nativeShell returns the shell that the native runtime runs step scripts
+// with. As in containers, bash is preferred over sh.
+func nativeShell() (string, error) {
+	for _, shell := range []string{"bash", "sh"} {
+		if path, err := goexec.LookPath(shell); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("the native runtime requires bash or sh to be available")
+}
+
+// containerCommand returns a command that runs the given container command
+// line tool. If binary is empty, docker is used.
+func containerCommand(ctx context.Context, binary string, args ...string) *goexec.Cmd {
+	if binary == "" {
+		binary = "docker"
+	}
+	return exec.CommandContext(ctx, binary, args...)
+}
+
+// removeContainer removes the container whose ID was written to cidFile, as
+// well as cidFile itself.
+func removeContainer(ctx context.Context, binary, cidFile string) {
+	cid, err := ioutil.ReadFile(cidFile)
+	_ = os.Remove(cidFile)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		_ = containerCommand(ctx, binary, "rm", "-f", "--", string(cid)).Run()
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+package batches
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/src-cli/internal/exec/expect"
+)
+
+func TestNewRuntime(t *testing.T) {
+	for name, wantBinary := range map[string]string{
+		"":       "docker",
+		"docker": "docker",
+		"podman": "podman",
+		"native": "",
+	} {
+		runtime, err := NewRuntime(name)
+		if err != nil {
+			t.Fatalf("unexpected error for runtime %q: %s", name, err)
+		}
+		if have := runtime.ContainerBinary(); have != wantBinary {
+			t.Errorf("wrong binary for runtime %q: have=%q want=%q", name, have, wantBinary)
+		}
+	}
+
+	if _, err := NewRuntime("rkt"); err == nil {
+		t.Error("unexpected nil error for unknown runtime")
+	}
+}
+
+func TestContainerRuntime_Podman(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "runtime-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	w := &dockerBindWorkspace{dir: dir}
+
+	expect.Commands(
+		t,
+		expect.NewGlob(
+			expect.Behaviour{Stdout: []byte("/tmp/step.sh\n")},
+			"podman", "run", "--rm", "--entrypoint", "/bin/bash", "digest", "-c", "mktemp",
+		),
+		expect.NewGlob(
+			expect.Success,
+			"podman", "run", "--rm", "--init",
+			"--cidfile", "*",
+			"--workdir", "/work/sub",
+			"--mount", "type=bind,source=script,target=/tmp/step.sh,ro",
+			"--mount", "type=bind,source="+dir+",target=/work",
+			"--cpus", "0.5",
+			"--memory", "512m",
+			"--network", "none",
+			"-e", "GREETING=hello",
+			"-e", "TOKEN",
+			"--entrypoint", "/bin/bash",
+			"--", "digest", "/tmp/step.sh",
+		),
+	)
+
+	runtime, err := NewRuntime("podman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prepared, err := runtime.prepareStep(ctx, &stepRunOpts{
+		step:       &Step{image: &mockImage{digest: "digest"}},
+		workspace:  w,
+		path:       "sub",
+		tempDir:    dir,
+		repo:       "repo",
+		scriptFile: "script",
+		env:        map[string]string{"GREETING": "hello"},
+		secrets:    map[string]string{"TOKEN": "hunter2"},
+		resources:  StepResources{CPUs: 0.5, Memory: "512m"},
+		network:    "none",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prepared.cleanup(ctx)
+
+	if have, want := prepared.scriptPath, "/tmp/step.sh"; have != want {
+		t.Errorf("wrong script path: have=%q want=%q", have, want)
+	}
+	if err := prepared.command(ctx).Run(); err != nil {
+		t.Errorf("unexpected error running step: %s", err)
+	}
+}
+
+func TestNativeRuntime(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "runtime-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	script := filepath.Join(dir, "script.sh")
+	if err := ioutil.WriteFile(script, []byte(`echo "$GREETING" > greeting.txt`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runtime, err := NewRuntime("native")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.Check(ctx); err != nil {
+		t.Skipf("native runtime unavailable: %s", err)
+	}
+
+	opts := &stepRunOpts{
+		step:       &Step{},
+		workspace:  &dockerBindWorkspace{dir: dir},
+		path:       "sub",
+		tempDir:    dir,
+		repo:       "repo",
+		scriptFile: script,
+		env:        map[string]string{"GREETING": "hello"},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		prepared, err := runtime.prepareStep(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer prepared.cleanup(ctx)
+
+		if out, err := prepared.command(ctx).CombinedOutput(); err != nil {
+			t.Fatalf("unexpected error running step: %s\n%s", err, out)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "sub", "greeting.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := strings.TrimSpace(string(data)), "hello"; have != want {
+			t.Errorf("wrong greeting: have=%q want=%q", have, want)
+		}
+	})
+
+	t.Run("files", func(t *testing.T) {
+		opts := *opts
+		opts.files = map[string]string{"/tmp/file.txt": script}
+		if _, err := runtime.prepareStep(ctx, &opts); err == nil {
+			t.Error("unexpected nil error for step with files")
+		}
+	})
+
+	t.Run("resource limits", func(t *testing.T) {
+		opts := *opts
+		opts.resources = StepResources{Memory: "1g"}
+		if _, err := runtime.prepareStep(ctx, &opts); err == nil {
+			t.Error("unexpected nil error for step with resource limits")
+		}
+	})
+
+	t.Run("network isolation", func(t *testing.T) {
+		opts := *opts
+		opts.network = "none"
+		if _, err := runtime.prepareStep(ctx, &opts); err == nil {
+			t.Error("unexpected nil error for step without network")
+		}
+	})
+
+	t.Run("volume workspace", func(t *testing.T) {
+		opts := *opts
+		opts.workspace = &dockerVolumeWorkspace{volume: "volume"}
+		if _, err := runtime.prepareStep(ctx, &opts); err == nil {
+			t.Error("unexpected nil error for volume workspace")
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package batches
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Secret is a value that is passed to a step in an environment variable, like
+// the step's env, but that never appears in logs, errors, the output of the
+// step or the execution cache.
+type Secret struct {
+	// Env is the name of the environment variable of src that contains the
+	// secret.
+	Env string `json:"env,omitempty" yaml:"env,omitempty"`
+	// File is the path of a file that contains the secret. Trailing newlines
+	// are removed.
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+}
+
+// Secrets maps the names of the environment variables that a step receives
+// secrets in to the secrets.
+type Secrets map[string]Secret
+
+func (s Secret) validate() error {
+	if (s.Env == "") == (s.File == "") {
+		return errors.New("exactly one of env and file must be set")
+	}
+	return nil
+}
+
+// resolve reads the values of the secrets, using the given environment, and
+// returns them by name.
+func (s Secrets) resolve(environ []string) (map[string]string, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	values := make(map[string]string, len(s))
+	for name, secret := range s {
+		if err := secret.validate(); err != nil {
+			return nil, errors.Wrapf(err, "secret %s", name)
+		}
+
+		if secret.Env != "" {
+			value, ok := env[secret.Env]
+			if !ok {
+				return nil, errors.Errorf("secret %s: environment variable %s is not set", name, secret.Env)
+			}
+			values[name] = value
+			continue
+		}
+
+		data, err := ioutil.ReadFile(expandHome(secret.File))
+		if err != nil {
+			return nil, errors.Wrapf(err, "secret %s: reading file", name)
+		}
+		values[name] = strings.TrimRight(string(data), "\r\n")
+	}
+	return values, nil
+}
+
+// expandHome replaces a leading ~ in path with the home directory of the
+// user.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// hashSecrets returns the SHA-256 hashes of the given secret values, so that
+// changes to them can be detected without storing them.
+func hashSecrets(values map[string]string) map[string]string {
+	hashes := make(map[string]string, len(values))
+	for name, value := range values {
+		hash := sha256.Sum256([]byte(value))
+		hashes[name] = hex.EncodeToString(hash[:])
+	}
+	return hashes
+}
+
+// redactedSecret replaces secrets in the output of steps.
+const redactedSecret = "***"
+
+// redactingWriter replaces secrets in everything written to it before passing
+// it on. Since a secret can be split across writes, output that could be the
+// start of a secret is held back until more output arrives or Flush is
+// called.
+type redactingWriter struct {
+	w       io.Writer
+	secrets [][]byte
+	maxLen  int
+	buf     []byte
+}
+
+func newRedactingWriter(w io.Writer, values map[string]string) *redactingWriter {
+	rw := &redactingWriter{w: w}
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		rw.secrets = append(rw.secrets, []byte(value))
+		if len(value) > rw.maxLen {
+			rw.maxLen = len(value)
+		}
+	}
+	// Replace longer secrets first, in case one secret contains another.
+	sort.Slice(rw.secrets, func(i, j int) bool { return len(rw.secrets[i]) > len(rw.secrets[j]) })
+	return rw
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	if rw.maxLen == 0 {
+		return rw.w.Write(p)
+	}
+
+	rw.buf = rw.redact(append(rw.buf, p...))
+
+	// Anything before cutoff can't be the start of a secret that is only
+	// partially written yet.
+	cutoff := len(rw.buf) - (rw.maxLen - 1)
+	if cutoff <= 0 {
+		return len(p), nil
+	}
+	// Pass on whole lines where possible, since they end up in the log.
+	if i := bytes.LastIndexByte(rw.buf[:cutoff], '\n'); i >= 0 {
+		cutoff = i + 1
+	}
+
+	if _, err := rw.w.Write(rw.buf[:cutoff]); err != nil {
+		return 0, err
+	}
+	rw.buf = append(rw.buf[:0], rw.buf[cutoff:]...)
+	return len(p), nil
+}
+
+// Flush passes on the output that has been held back.
+func (rw *redactingWriter) Flush() error {
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	_, err := rw.w.Write(rw.buf)
+	rw.buf = rw.buf[:0]
+	return err
+}
+
+func (rw *redactingWriter) redact(data []byte) []byte {
+	for _, secret := range rw.secrets {
+		data = bytes.ReplaceAll(data, secret, []byte(redactedSecret))
+	}
+	return data
+}
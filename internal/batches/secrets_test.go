@@ -0,0 +1,88 @@
+package batches
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSecretsResolve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	file := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	environ := []string{"HOST_TOKEN=from-env", "EMPTY="}
+
+	values, err := Secrets{
+		"A": {Env: "HOST_TOKEN"},
+		"B": {File: file},
+		"C": {Env: "EMPTY"},
+	}.resolve(environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"A": "from-env", "B": "from-file", "C": ""}
+	if diff := cmp.Diff(want, values); diff != "" {
+		t.Errorf("wrong values (-want +got):\n%s", diff)
+	}
+
+	for name, secrets := range map[string]Secrets{
+		"unset env":    {"A": {Env: "MISSING"}},
+		"missing file": {"A": {File: filepath.Join(dir, "missing")}},
+		"both":         {"A": {Env: "HOST_TOKEN", File: file}},
+		"neither":      {"A": {}},
+	} {
+		if _, err := secrets.resolve(environ); err == nil {
+			t.Errorf("%s: unexpected nil error", name)
+		}
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	secrets := map[string]string{"A": "hunter2", "B": "s3cr3t-value", "C": ""}
+
+	for name, writes := range map[string][]string{
+		"single write":     {"the password is hunter2\nand the value is s3cr3t-value\n"},
+		"split secret":     {"the password is hun", "ter2\nand the value is s3cr", "3t-val", "ue\n"},
+		"byte by byte":     strings.Split("the password is hunter2\nand the value is s3cr3t-value\n", ""),
+		"no trailing line": {"the password is hunter2\nand the value is s3cr3t-value"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := newRedactingWriter(&out, secrets)
+			for _, s := range writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("unexpected result: n=%d err=%v", n, err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := "the password is ***\nand the value is ***"
+			if have := strings.TrimSuffix(out.String(), "\n"); have != want {
+				t.Errorf("wrong output: have=%q want=%q", have, want)
+			}
+		})
+	}
+
+	t.Run("no secrets", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newRedactingWriter(&out, nil)
+		w.Write([]byte("hello"))
+		if have := out.String(); have != "hello" {
+			t.Errorf("output held back without secrets: %q", have)
+		}
+	})
+}
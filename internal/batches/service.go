@@ -26,6 +26,7 @@ type Service struct {
 	client           api.Client
 	features         featureFlags
 	imageCache       *docker.ImageCache
+	runtime          Runtime
 	workspace        string
 }
 
@@ -33,6 +34,9 @@ type ServiceOpts struct {
 	AllowUnsupported bool
 	Client           api.Client
 	Workspace        string
+
+	// Runtime runs the steps of batch specs. If nil, Docker is used.
+	Runtime Runtime
 }
 
 var (
@@ -40,14 +44,23 @@ var (
 )
 
 func NewService(opts *ServiceOpts) *Service {
+	runtime := opts.Runtime
+	if runtime == nil {
+		runtime = defaultRuntime
+	}
+
 	return &Service{
 		allowUnsupported: opts.AllowUnsupported,
 		client:           opts.Client,
-		imageCache:       docker.NewImageCache(),
+		imageCache:       docker.NewImageCache(runtime.ContainerBinary()),
+		runtime:          runtime,
 		workspace:        opts.Workspace,
 	}
 }
 
+// Runtime returns the runtime that runs the steps of batch specs.
+func (svc *Service) Runtime() Runtime { return svc.runtime }
+
 const sourcegraphVersionQuery = `query SourcegraphVersion {
 	site {
 	  productVersion
@@ -104,7 +117,14 @@ func (svc *Service) ApplyBatchChange(ctx context.Context, spec graphql.BatchSpec
 	return svc.newOperations().ApplyBatchChange(ctx, spec)
 }
 
+// CreateBatchSpec creates the raw batch spec on Sourcegraph. Fields that only
+// src-cli knows about are removed from it first.
 func (svc *Service) CreateBatchSpec(ctx context.Context, namespace, spec string, ids []graphql.ChangesetSpecID) (graphql.BatchSpecID, string, error) {
+	spec, err := serverBatchSpec(spec)
+	if err != nil {
+		return "", "", err
+	}
+
 	result, err := svc.newOperations().CreateBatchSpec(ctx, namespace, spec, ids)
 	if err != nil {
 		return "", "", err
@@ -113,6 +133,50 @@ func (svc *Service) CreateBatchSpec(ctx context.Context, namespace, spec string,
 	return result.ID, result.ApplyURL, nil
 }
 
+func (svc *Service) ListBatchChanges(ctx context.Context, opts graphql.ListBatchChangesOpts, fn func(*graphql.BatchChange) error) error {
+	return svc.newOperations().ListBatchChanges(ctx, opts, fn)
+}
+
+// BatchChangeByName returns the batch change with the given name in the
+// namespace with the given ID, or an error if there is none.
+func (svc *Service) BatchChangeByName(ctx context.Context, namespaceID, name string) (*graphql.BatchChange, error) {
+	batchChange, err := svc.newOperations().BatchChangeByName(ctx, namespaceID, name)
+	if err != nil {
+		return nil, err
+	}
+	if batchChange == nil {
+		return nil, errors.Errorf("batch change %q not found", name)
+	}
+	return batchChange, nil
+}
+
+func (svc *Service) ListChangesets(ctx context.Context, batchChangeID string, opts graphql.ListChangesetsOpts, fn func(*graphql.Changeset) error) error {
+	return svc.newOperations().ListChangesets(ctx, batchChangeID, opts, fn)
+}
+
+func (svc *Service) CloseBatchChange(ctx context.Context, batchChangeID string, closeChangesets bool) (*graphql.BatchChange, error) {
+	return svc.newOperations().CloseBatchChange(ctx, batchChangeID, closeChangesets)
+}
+
+func (svc *Service) ReenqueueChangeset(ctx context.Context, changesetID string) (*graphql.Changeset, error) {
+	return svc.newOperations().ReenqueueChangeset(ctx, changesetID)
+}
+
+func (svc *Service) DetachChangesets(ctx context.Context, batchChangeID string, changesetIDs []string) error {
+	return svc.newOperations().DetachChangesets(ctx, batchChangeID, changesetIDs)
+}
+
+func (svc *Service) PublishChangesets(ctx context.Context, batchChangeID string, changesetIDs []string, draft bool) error {
+	return svc.newOperations().PublishChangesets(ctx, batchChangeID, changesetIDs, draft)
+}
+
+// ApplyPreview calls fn with the preview of what applying the batch spec
+// would do to each changeset, compared to the batch change that is currently
+// applied.
+func (svc *Service) ApplyPreview(ctx context.Context, id graphql.BatchSpecID, fn func(*graphql.ChangesetApplyPreview) error) error {
+	return svc.newOperations().ApplyPreview(ctx, id, fn)
+}
+
 const createChangesetSpecMutation = `
 mutation CreateChangesetSpec($spec: String!) {
     createChangesetSpec(changesetSpec: $spec) {
@@ -137,15 +201,52 @@ func (svc *Service) CreateChangesetSpec(ctx context.Context, spec *ChangesetSpec
 			ID string
 		}
 	}
+	// Changeset specs that aren't referenced by a batch spec are discarded by
+	// the server, so creating a duplicate on retry is harmless.
 	if ok, err := svc.newRequest(createChangesetSpecMutation, map[string]interface{}{
 		"spec": string(raw),
-	}).Do(ctx, &result); err != nil || !ok {
+	}).Do(api.WithRetrySafe(ctx), &result); err != nil || !ok {
 		return "", err
 	}
 
 	return graphql.ChangesetSpecID(result.CreateChangesetSpec.ID), nil
 }
 
+// MissingChangesetSpecs returns those of the given changeset specs that don't
+// exist on the Sourcegraph instance anymore. The server discards changeset
+// specs that aren't referenced by a batch spec after a while.
+func (svc *Service) MissingChangesetSpecs(ctx context.Context, ids []graphql.ChangesetSpecID) ([]graphql.ChangesetSpecID, error) {
+	const chunkSize = 100
+
+	var missing []graphql.ChangesetSpecID
+	for start := 0; start < len(ids); start += chunkSize {
+		chunk := ids[start:]
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+
+		var params, fields []string
+		vars := make(map[string]interface{}, len(chunk))
+		for i, id := range chunk {
+			params = append(params, fmt.Sprintf("$id%d: ID!", i))
+			fields = append(fields, fmt.Sprintf("spec%d: node(id: $id%d) { id }", i, i))
+			vars[fmt.Sprintf("id%d", i)] = id
+		}
+		query := fmt.Sprintf("query ChangesetSpecsExist(%s) {\n    %s\n}", strings.Join(params, ", "), strings.Join(fields, "\n    "))
+
+		var result map[string]*struct{ ID string }
+		if ok, err := svc.client.NewRequest(query, vars).Do(ctx, &result); err != nil || !ok {
+			return nil, err
+		}
+		for i, id := range chunk {
+			if result[fmt.Sprintf("spec%d", i)] == nil {
+				missing = append(missing, id)
+			}
+		}
+	}
+	return missing, nil
+}
+
 func (svc *Service) NewExecutionCache(dir string) ExecutionCache {
 	if dir == "" {
 		return &ExecutionNoOpCache{}
@@ -162,14 +263,43 @@ func (svc *Service) NewRepoFetcher(dir string, cleanArchives bool) RepoFetcher {
 	}
 }
 
+// NewGitRepoFetcher returns a RepoFetcher that clones repositories with git
+// into dir. If baseURL is empty, repositories are cloned from the Sourcegraph
+// instance. Otherwise, the name of each repository is appended to it, such as
+// for a local 'src serve-git'. Git uses the given TLS and proxy settings.
+//
+// Clones can only be used by the workspace creator returned by
+// NewBindWorkspaceCreator.
+func (svc *Service) NewGitRepoFetcher(dir, baseURL string, transport api.TransportSettings) RepoFetcher {
+	return &gitRepoFetcher{
+		client:    svc.client,
+		dir:       dir,
+		baseURL:   baseURL,
+		transport: transport,
+	}
+}
+
+// NewBindWorkspaceCreator returns a WorkspaceCreator that creates workspaces
+// on the host filesystem in dir, regardless of the workspace mode of the
+// service.
+func (svc *Service) NewBindWorkspaceCreator(dir string) WorkspaceCreator {
+	return &dockerBindWorkspaceCreator{dir: dir}
+}
+
 func (svc *Service) NewWorkspaceCreator(ctx context.Context, cacheDir, tempDir string, steps []Step) WorkspaceCreator {
 	if svc.workspaceCreatorType(ctx, steps) == workspaceCreatorVolume {
-		return &dockerVolumeWorkspaceCreator{tempDir: tempDir}
+		return &dockerVolumeWorkspaceCreator{tempDir: tempDir, binary: svc.runtime.ContainerBinary()}
 	}
 	return &dockerBindWorkspaceCreator{dir: cacheDir}
 }
 
 func (svc *Service) workspaceCreatorType(ctx context.Context, steps []Step) workspaceCreatorType {
+	// Steps that don't run in containers can only use workspaces on the host
+	// filesystem.
+	if svc.runtime.ContainerBinary() == "" {
+		return workspaceCreatorBind
+	}
+
 	if svc.workspace == "volume" {
 		return workspaceCreatorVolume
 	} else if svc.workspace == "bind" {
@@ -186,6 +316,12 @@ func (svc *Service) workspaceCreatorType(ctx context.Context, steps []Step) work
 // Progress information is reported back to the given progress function: perc
 // will be a value between 0.0 and 1.0, inclusive.
 func (svc *Service) SetDockerImages(ctx context.Context, spec *BatchSpec, progress func(perc float64)) error {
+	// Runtimes that don't use containers don't need any images.
+	if svc.runtime.ContainerBinary() == "" {
+		progress(1)
+		return nil
+	}
+
 	total := len(spec.Steps) + 1
 	progress(0)
 
@@ -277,28 +413,34 @@ func (svc *Service) BuildTasks(ctx context.Context, repos []*graphql.Repository,
 					}
 				}
 
-				tasks = append(tasks, &Task{
-					Repository:            repo,
-					Path:                  d,
-					Steps:                 spec.Steps,
-					TransformChanges:      spec.TransformChanges,
-					Template:              spec.ChangesetTemplate,
-					BatchChangeAttributes: attr,
-					OnlyFetchWorkspace:    workspaceConfig.OnlyFetchWorkspace,
-				})
+				for _, entry := range spec.matrixEntries() {
+					tasks = append(tasks, &Task{
+						Repository:            repo,
+						Path:                  d,
+						Steps:                 spec.Steps,
+						Matrix:                entry,
+						TransformChanges:      spec.TransformChanges,
+						Template:              spec.ChangesetTemplate,
+						BatchChangeAttributes: attr,
+						OnlyFetchWorkspace:    workspaceConfig.OnlyFetchWorkspace,
+					})
+				}
 			}
 		}
 	}
 
 	for r := range rootWorkspace {
-		tasks = append(tasks, &Task{
-			Repository:            r,
-			Path:                  "",
-			Steps:                 spec.Steps,
-			TransformChanges:      spec.TransformChanges,
-			Template:              spec.ChangesetTemplate,
-			BatchChangeAttributes: attr,
-		})
+		for _, entry := range spec.matrixEntries() {
+			tasks = append(tasks, &Task{
+				Repository:            r,
+				Path:                  "",
+				Steps:                 spec.Steps,
+				Matrix:                entry,
+				TransformChanges:      spec.TransformChanges,
+				Template:              spec.ChangesetTemplate,
+				BatchChangeAttributes: attr,
+			})
+		}
 	}
 
 	return tasks, nil
@@ -446,7 +588,7 @@ func (e *duplicateBranchesErr) Error() string {
 		}
 	}
 
-	fmt.Fprint(&out, "\nMake sure that the changesetTemplate.branch field in the batch spec produces unique values for each changeset in a single repository and rerun this command.")
+	fmt.Fprint(&out, "\nMake sure that the changesetTemplate.branch field in the batch spec produces unique values for each changeset in a single repository, for example by including values from the matrix, and rerun this command.")
 
 	return out.String()
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/sourcegraph/src-cli/internal/api"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
+	"gopkg.in/yaml.v3"
 )
 
 func TestSetDefaultQueryCount(t *testing.T) {
@@ -133,6 +134,83 @@ func mockGraphQLClient(response string) (client api.Client, done func()) {
 	return client, ts.Close
 }
 
+func TestService_MissingChangesetSpecs(t *testing.T) {
+	client, done := mockGraphQLClient(`{"data": {"spec0": {"id": "spec-1"}, "spec1": null, "spec2": {"id": "spec-3"}}}`)
+	defer done()
+
+	svc := &Service{client: client}
+	missing, err := svc.MissingChangesetSpecs(context.Background(), []graphql.ChangesetSpecID{"spec-1", "spec-2", "spec-3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]graphql.ChangesetSpecID{"spec-2"}, missing); diff != "" {
+		t.Errorf("wrong missing changeset specs (-want +got):\n%s", diff)
+	}
+}
+
+func TestService_CreateBatchSpec(t *testing.T) {
+	var uploaded string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.api/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables struct{ Spec string }
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %s", err)
+		}
+		uploaded = req.Variables.Spec
+		w.Write([]byte(`{"data": {"createBatchSpec": {"id": "batch-spec-1", "applyURL": "/apply"}}}`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	svc := &Service{
+		client:   api.NewClient(api.ClientOpts{Endpoint: ts.URL, Out: &bytes.Buffer{}}),
+		features: featureFlags{batchChanges: true},
+	}
+	spec := `name: hello-world
+fetch: git
+matrix:
+  - version: 1
+steps:
+  - run: echo
+    container: alpine:3
+    if: "true"
+    timeout: 1m
+    retries: 1
+    allowFailure: true
+    network: none
+    resources:
+      cpus: 1
+    secrets:
+      - TOKEN
+    commit:
+      message: Update
+`
+	if _, _, err := svc.CreateBatchSpec(context.Background(), "namespace", spec, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var have map[string]interface{}
+	if err := yaml.Unmarshal([]byte(uploaded), &have); err != nil {
+		t.Fatalf("parsing uploaded batch spec: %s", err)
+	}
+	for _, field := range clientOnlySpecFields {
+		if _, ok := have[field]; ok {
+			t.Errorf("uploaded batch spec includes client-only field %q", field)
+		}
+	}
+	step := have["steps"].([]interface{})[0].(map[string]interface{})
+	for _, field := range clientOnlyStepFields {
+		if _, ok := step[field]; ok {
+			t.Errorf("uploaded batch spec includes client-only step field %q", field)
+		}
+	}
+	if step["run"] != "echo" {
+		t.Errorf("step not uploaded: %v", step)
+	}
+}
+
 func TestResolveRepositories_Unsupported(t *testing.T) {
 	client, done := mockGraphQLClient(testResolveRepositoriesUnsupported)
 	defer done()
@@ -312,6 +390,7 @@ func TestService_BuildTasks(t *testing.T) {
 	type wantTask struct {
 		Path               string
 		ArchivePathToFetch string
+		Matrix             string
 	}
 
 	tests := map[string]struct {
@@ -435,6 +514,34 @@ func TestService_BuildTasks(t *testing.T) {
 				},
 			},
 		},
+
+		"matrix with workspace configuration": {
+			spec: &BatchSpec{
+				Workspaces: []WorkspaceConfiguration{
+					{In: "*automation-testing", RootAtLocationOf: "package.json"},
+				},
+				Matrix: []map[string]interface{}{
+					{"package": "lodash", "version": "4.17.21"},
+					{"package": "react", "version": "17.0.2"},
+				},
+			},
+			searchResults: filesInRepos{
+				{"a/b/package.json"},
+				{},
+			},
+			repos:        repos,
+			wantNumTasks: 4,
+			wantTasks: map[string][]wantTask{
+				repos[0].ID: {
+					{Path: "a/b", Matrix: "package=lodash, version=4.17.21"},
+					{Path: "a/b", Matrix: "package=react, version=17.0.2"},
+				},
+				repos[1].ID: {
+					{Path: "", Matrix: "package=lodash, version=4.17.21"},
+					{Path: "", Matrix: "package=react, version=17.0.2"},
+				},
+			},
+		},
 	}
 
 	for name, tt := range tests {
@@ -458,11 +565,17 @@ func TestService_BuildTasks(t *testing.T) {
 				haveTasks[task.Repository.ID] = append(haveTasks[task.Repository.ID], wantTask{
 					Path:               task.Path,
 					ArchivePathToFetch: task.ArchivePathToFetch(),
+					Matrix:             describeMatrixEntry(task.Matrix),
 				})
 			}
 
 			for _, tasks := range haveTasks {
-				sort.Slice(tasks, func(i, j int) bool { return tasks[i].Path < tasks[j].Path })
+				sort.Slice(tasks, func(i, j int) bool {
+					if tasks[i].Path != tasks[j].Path {
+						return tasks[i].Path < tasks[j].Path
+					}
+					return tasks[i].Matrix < tasks[j].Matrix
+				})
 			}
 
 			if diff := cmp.Diff(tt.wantTasks, haveTasks); diff != "" {
@@ -509,6 +622,56 @@ func mockDirectoriesInReposResults(t *testing.T, filesPerRepo filesInRepos) (cli
 	return mockGraphQLClient(string(rawRes))
 }
 
+func TestService_ValidateChangesetSpecs_Matrix(t *testing.T) {
+	repo := &graphql.Repository{
+		ID:            "repo-graphql-id-1",
+		Name:          "github.com/sourcegraph/src-cli",
+		DefaultBranch: &graphql.Branch{Name: "main", Target: graphql.Target{OID: "d34db33f"}},
+	}
+	result := executionResult{Diff: testDiff}
+
+	specsForBranch := func(t *testing.T, branch string) []*ChangesetSpec {
+		var specs []*ChangesetSpec
+		for _, entry := range []map[string]interface{}{
+			{"package": "github.com/pkg/errors", "group": "errors"},
+			{"package": "golang.org/x/xerrors", "group": "errors"},
+		} {
+			task := &Task{
+				BatchChangeAttributes: &BatchChangeAttributes{Name: "bump-dependencies"},
+				Template: &ChangesetTemplate{
+					Title:  "Bump ${{ matrix.package }}",
+					Branch: branch,
+					Commit: ExpandedGitCommitDescription{Message: "Bump ${{ matrix.package }}"},
+				},
+				Repository: repo,
+				Matrix:     entry,
+			}
+			taskSpecs, err := createChangesetSpecs(task, result, featureFlags{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			specs = append(specs, taskSpecs...)
+		}
+		return specs
+	}
+
+	svc := &Service{}
+
+	// Both entries render the same branch, even though it uses the matrix.
+	err := svc.ValidateChangesetSpecs([]*graphql.Repository{repo}, specsForBranch(t, "bump-${{ matrix.group }}"))
+	if err == nil {
+		t.Fatal("no error for matrix entries with the same branch")
+	}
+	if want := `github.com/sourcegraph/src-cli: 2 changeset specs have the branch "bump-errors"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected %q to be included in error, but was not. error=%q", want, err.Error())
+	}
+
+	err = svc.ValidateChangesetSpecs([]*graphql.Repository{repo}, specsForBranch(t, `bump-${{ replace matrix.package "/" "-" }}`))
+	if err != nil {
+		t.Errorf("unexpected error for matrix entries with different branches: %s", err)
+	}
+}
+
 func TestService_ValidateChangesetSpecs(t *testing.T) {
 	repo1 := &graphql.Repository{ID: "repo-graphql-id-1", Name: "github.com/sourcegraph/src-cli"}
 	repo2 := &graphql.Repository{ID: "repo-graphql-id-2", Name: "github.com/sourcegraph/sourcegraph"}
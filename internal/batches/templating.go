@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"reflect"
 	"strings"
 	"text/template"
 
@@ -20,6 +21,39 @@ func renderStepTemplate(name, tmpl string, out io.Writer, stepCtx *StepContext)
 	return t.Execute(out, stepCtx)
 }
 
+// evalStepCondition renders the "if" condition of a step and reports whether
+// the step should be executed. An empty condition is always true.
+func evalStepCondition(condition string, stepCtx *StepContext) (bool, error) {
+	if condition == "" {
+		return true, nil
+	}
+
+	var out bytes.Buffer
+	if err := renderStepTemplate("step-if", condition, &out, stepCtx); err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out.String()) == "true", nil
+}
+
+// contains reports whether the given list contains item, or whether the given
+// string contains item as a substring.
+func contains(in interface{}, item string) (bool, error) {
+	if s, ok := in.(string); ok {
+		return strings.Contains(s, item), nil
+	}
+
+	list := reflect.ValueOf(in)
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return false, errors.Errorf("contains: expected a list or a string, got %T", in)
+	}
+	for i := 0; i < list.Len(); i++ {
+		if e, ok := list.Index(i).Interface().(string); ok && e == item {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func parseAsTemplate(name, input string, stepCtx *StepContext) (*template.Template, error) {
 	return template.New(name).Delims("${{", "}}").Funcs(stepCtx.ToFuncMap()).Parse(input)
 }
@@ -60,6 +94,8 @@ type StepContext struct {
 	PreviousStep StepResult
 	// Repository is the Sourcegraph repository in which the steps are executed.
 	Repository graphql.Repository
+	// Matrix is the entry of the matrix that the steps are executed with.
+	Matrix map[string]interface{}
 }
 
 // ToFuncMap returns a template.FuncMap to access fields on the StepContext in a
@@ -95,9 +131,10 @@ func (stepCtx *StepContext) ToFuncMap() template.FuncMap {
 	}
 
 	return template.FuncMap{
-		"join":    strings.Join,
-		"split":   strings.Split,
-		"replace": strings.ReplaceAll,
+		"join":     strings.Join,
+		"split":    strings.Split,
+		"replace":  strings.ReplaceAll,
+		"contains": contains,
 		"join_if": func(sep string, elems ...string) string {
 			var nonBlank []string
 			for _, e := range elems {
@@ -128,6 +165,9 @@ func (stepCtx *StepContext) ToFuncMap() template.FuncMap {
 				"description": stepCtx.BatchChange.Description,
 			}
 		},
+		"matrix": func() map[string]interface{} {
+			return stepCtx.Matrix
+		},
 	}
 }
 
@@ -205,15 +245,19 @@ type ChangesetTemplateContext struct {
 
 	// Repository is the repository in which the steps were executed.
 	Repository graphql.Repository
+
+	// Matrix is the entry of the matrix that the steps were executed with.
+	Matrix map[string]interface{}
 }
 
 // ToFuncMap returns a template.FuncMap to access fields on the StepContext in a
 // text/template.
 func (tmplCtx *ChangesetTemplateContext) ToFuncMap() template.FuncMap {
 	return template.FuncMap{
-		"join":    strings.Join,
-		"split":   strings.Split,
-		"replace": strings.ReplaceAll,
+		"join":     strings.Join,
+		"split":    strings.Split,
+		"replace":  strings.ReplaceAll,
+		"contains": contains,
 		"join_if": func(sep string, elems ...string) string {
 			var nonBlank []string
 			for _, e := range elems {
@@ -238,6 +282,9 @@ func (tmplCtx *ChangesetTemplateContext) ToFuncMap() template.FuncMap {
 		"outputs": func() map[string]interface{} {
 			return tmplCtx.Outputs
 		},
+		"matrix": func() map[string]interface{} {
+			return tmplCtx.Matrix
+		},
 		"steps": func() map[string]interface{} {
 			// Wrap the *StepChanges in a StepResult so we can use nil-safe
 			// methods.
@@ -309,6 +309,14 @@ CGO_ENABLED=0
 [renamed-file.txt]
 infrastructure/sub-project`,
 		},
+		{
+			name: "matrix",
+			tmplCtx: &ChangesetTemplateContext{
+				Matrix: map[string]interface{}{"package": "github.com/pkg/errors", "version": "v0.9.1"},
+			},
+			run:  `bump/${{ replace matrix.package "/" "-" }}-${{ matrix.version }}`,
+			want: `bump/github.com-pkg-errors-v0.9.1`,
+		},
 		{
 			name:    "empty context",
 			tmplCtx: &ChangesetTemplateContext{},
@@ -343,3 +351,52 @@ ${{ steps.renamed_files }}
 		})
 	}
 }
+
+func TestEvalStepCondition(t *testing.T) {
+	stepCtx := &StepContext{
+		Repository: graphql.Repository{
+			Name: "github.com/sourcegraph/src-cli",
+			FileMatches: map[string]bool{
+				"package.json": true,
+				"README.md":    true,
+			},
+		},
+		Outputs: map[string]interface{}{"count": "3"},
+	}
+
+	tests := []struct {
+		condition string
+		want      bool
+		wantErr   bool
+	}{
+		{condition: "", want: true},
+		{condition: "true", want: true},
+		{condition: "false", want: false},
+		{condition: "  true\n", want: true},
+		{condition: `${{ contains repository.search_result_paths "package.json" }}`, want: true},
+		{condition: `${{ contains repository.search_result_paths "go.mod" }}`, want: false},
+		{condition: `${{ contains repository.name "sourcegraph" }}`, want: true},
+		{condition: `${{ eq outputs.count "3" }}`, want: true},
+		{condition: `${{ not (eq repository.name "github.com/sourcegraph/src-cli") }}`, want: false},
+		{condition: `${{ repository.name }}`, want: false},
+		{condition: `${{ contains outputs "count" }}`, wantErr: true},
+		{condition: `${{ eq `, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		have, err := evalStepCondition(tc.condition, stepCtx)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("condition %q: unexpected nil error", tc.condition)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("condition %q: unexpected error: %s", tc.condition, err)
+			continue
+		}
+		if have != tc.want {
+			t.Errorf("condition %q: have=%v want=%v", tc.condition, have, tc.want)
+		}
+	}
+}
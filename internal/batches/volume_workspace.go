@@ -15,15 +15,24 @@ import (
 
 	"github.com/sourcegraph/src-cli/internal/batches/docker"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
-	"github.com/sourcegraph/src-cli/internal/exec"
 	"github.com/sourcegraph/src-cli/internal/version"
 )
 
-type dockerVolumeWorkspaceCreator struct{ tempDir string }
+type dockerVolumeWorkspaceCreator struct {
+	tempDir string
+
+	// binary is the Docker compatible command line tool used to manage
+	// volumes and containers. If empty, docker is used.
+	binary string
+}
 
 var _ WorkspaceCreator = &dockerVolumeWorkspaceCreator{}
 
 func (wc *dockerVolumeWorkspaceCreator) Create(ctx context.Context, repo *graphql.Repository, steps []Step, archive RepoZip) (Workspace, error) {
+	if _, ok := archive.(*repoClone); ok {
+		return nil, errors.New("repositories fetched with git can only be used in bind workspaces")
+	}
+
 	volume, err := wc.createVolume(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "creating Docker volume")
@@ -40,6 +49,7 @@ func (wc *dockerVolumeWorkspaceCreator) Create(ctx context.Context, repo *graphq
 
 	w := &dockerVolumeWorkspace{
 		tempDir: wc.tempDir,
+		binary:  wc.binary,
 		volume:  volume,
 		uidGid:  ug,
 	}
@@ -54,8 +64,8 @@ func (wc *dockerVolumeWorkspaceCreator) Create(ctx context.Context, repo *graphq
 	return w, errors.Wrap(wc.prepareGitRepo(ctx, w), "preparing local git repo")
 }
 
-func (*dockerVolumeWorkspaceCreator) createVolume(ctx context.Context) (string, error) {
-	out, err := exec.CommandContext(ctx, "docker", "volume", "create").CombinedOutput()
+func (wc *dockerVolumeWorkspaceCreator) createVolume(ctx context.Context) (string, error) {
+	out, err := containerCommand(ctx, wc.binary, "volume", "create").CombinedOutput()
 	if err != nil {
 		return "", err
 	}
@@ -126,7 +136,7 @@ func (wc *dockerVolumeWorkspaceCreator) unzipRepoIntoVolume(ctx context.Context,
 		fmt.Sprintf("touch /work/%s; chown -R %s /work", dummy, w.uidGid.String()),
 	)
 
-	if out, err := exec.CommandContext(ctx, "docker", opts...).CombinedOutput(); err != nil {
+	if out, err := containerCommand(ctx, w.binary, opts...).CombinedOutput(); err != nil {
 		return errors.Wrapf(err, "chown output:\n\n%s\n\n", string(out))
 	}
 
@@ -145,7 +155,7 @@ func (wc *dockerVolumeWorkspaceCreator) unzipRepoIntoVolume(ctx context.Context,
 		fmt.Sprintf("unzip /tmp/zip; rm /work/%s", dummy),
 	)
 
-	if out, err := exec.CommandContext(ctx, "docker", opts...).CombinedOutput(); err != nil {
+	if out, err := containerCommand(ctx, w.binary, opts...).CombinedOutput(); err != nil {
 		return errors.Wrapf(err, "unzip output:\n\n%s\n\n", string(out))
 	}
 
@@ -188,7 +198,7 @@ func (wc *dockerVolumeWorkspaceCreator) copyFilesIntoVolumes(ctx context.Context
 		strings.Join(copyCmds, " && ")+";",
 	)
 
-	if out, err := exec.CommandContext(ctx, "docker", opts...).CombinedOutput(); err != nil {
+	if out, err := containerCommand(ctx, w.binary, opts...).CombinedOutput(); err != nil {
 		return errors.Wrapf(err, "unzip output:\n\n%s\n\n", string(out))
 	}
 	return nil
@@ -200,6 +210,7 @@ func (wc *dockerVolumeWorkspaceCreator) copyFilesIntoVolumes(ctx context.Context
 // debugging harder and is slower when it's time to actually retrieve the diff.
 type dockerVolumeWorkspace struct {
 	tempDir string
+	binary  string
 	volume  string
 	uidGid  docker.UIDGID
 }
@@ -208,7 +219,7 @@ var _ Workspace = &dockerVolumeWorkspace{}
 
 func (w *dockerVolumeWorkspace) Close(ctx context.Context) error {
 	// Cleanup here is easy: we just get rid of the Docker volume.
-	return exec.CommandContext(ctx, "docker", "volume", "rm", w.volume).Run()
+	return containerCommand(ctx, w.binary, "volume", "rm", w.volume).Run()
 }
 
 func (w *dockerVolumeWorkspace) DockerRunOpts(ctx context.Context, target string) ([]string, error) {
@@ -259,6 +270,69 @@ exec git diff --cached --no-prefix --binary
 	return out, nil
 }
 
+func (w *dockerVolumeWorkspace) Snapshot(ctx context.Context) (string, error) {
+	// The tree of the index is a snapshot of all files that doesn't need a
+	// commit, so HEAD stays at the base revision.
+	script := `#!/bin/sh
+
+set -e
+# No set -x here, since we're going to parse the output.
+
+git add --all > /dev/null
+exec git write-tree
+`
+
+	out, err := w.runScript(ctx, "/work", script)
+	if err != nil {
+		return "", errors.Wrapf(err, "git write-tree:\n\n%s", string(out))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (w *dockerVolumeWorkspace) DiffSnapshots(ctx context.Context, from, to string) ([]byte, error) {
+	if err := validateSnapshot(to); err != nil {
+		return nil, err
+	}
+	if from == "" {
+		from = "HEAD"
+	} else if err := validateSnapshot(from); err != nil {
+		return nil, err
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+
+exec git diff --no-prefix --binary %s %s
+`, from, to)
+
+	out, err := w.runScript(ctx, "/work", script)
+	if err != nil {
+		return nil, errors.Wrapf(err, "git diff:\n\n%s", string(out))
+	}
+
+	return out, nil
+}
+
+func (w *dockerVolumeWorkspace) Restore(ctx context.Context, snapshot string) error {
+	if err := validateSnapshot(snapshot); err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+
+set -e
+set -x
+
+git read-tree %s
+git checkout-index --all --force
+git clean -d --force
+`, snapshot)
+
+	out, err := w.runScript(ctx, "/work", script)
+	if err != nil {
+		return errors.Wrapf(err, "restoring workspace:\n\n%s", string(out))
+	}
+	return nil
+}
+
 // dockerVolumeWorkspaceImage is the Docker image we'll run our unzip and git
 // commands in. This needs to match the name defined in
 // .github/workflows/docker.yml.
@@ -307,7 +381,7 @@ func (w *dockerVolumeWorkspace) runScript(ctx context.Context, target, script st
 	}, common...)
 	opts = append(opts, dockerVolumeWorkspaceImage, "sh", "/run.sh")
 
-	out, err := exec.CommandContext(ctx, "docker", opts...).CombinedOutput()
+	out, err := containerCommand(ctx, w.binary, opts...).CombinedOutput()
 	if err != nil {
 		return out, errors.Wrapf(err, "Docker output:\n\n%s\n\n", string(out))
 	}
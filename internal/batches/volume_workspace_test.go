@@ -563,6 +563,70 @@ index 06471f4..5f9d3fa 100644
 	})
 }
 
+func TestVolumeWorkspace_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	w := &dockerVolumeWorkspace{volume: volumeID}
+
+	runScript := func(behaviour expect.Behaviour) *expect.Expectation {
+		return expect.NewGlob(
+			behaviour,
+			"docker", "run", "--rm", "--init", "--workdir", "/work",
+			"--mount", "type=bind,source=*,target=/run.sh,ro",
+			"--user", "0:0",
+			"--mount", "type=volume,source="+volumeID+",target=/work",
+			dockerVolumeWorkspaceImage,
+			"sh", "/run.sh",
+		)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		const tree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+		const diff = "diff --git go.mod go.mod\n"
+
+		expect.Commands(
+			t,
+			runScript(expect.Behaviour{Stdout: []byte(tree + "\n")}),
+			runScript(expect.Behaviour{Stdout: []byte(diff)}),
+		)
+
+		snapshot, err := w.Snapshot(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if snapshot != tree {
+			t.Errorf("wrong snapshot: have=%q want=%q", snapshot, tree)
+		}
+
+		have, err := w.DiffSnapshots(ctx, "", snapshot)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(have) != diff {
+			t.Errorf("wrong diff: have=%q want=%q", have, diff)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		expect.Commands(
+			t,
+			runScript(expect.Behaviour{ExitCode: 1}),
+			runScript(expect.Behaviour{ExitCode: 1}),
+		)
+
+		if _, err := w.Snapshot(ctx); err == nil {
+			t.Error("unexpected nil error")
+		}
+		if _, err := w.DiffSnapshots(ctx, "", "4b825dc642cb6eb9a060e54bf8d69288fbee4904"); err == nil {
+			t.Error("unexpected nil error")
+		}
+
+		// Invalid snapshots are rejected before a script is run.
+		if _, err := w.DiffSnapshots(ctx, "HEAD; rm -rf /", "4b825dc642cb6eb9a060e54bf8d69288fbee4904"); err == nil {
+			t.Error("unexpected nil error for invalid snapshot")
+		}
+	})
+}
+
 func TestVolumeWorkspace_runScript(t *testing.T) {
 	// Since the above tests have thoroughly tested our error handling, this
 	// test just fills in the one logical gap we have in our test coverage: is
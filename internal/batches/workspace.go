@@ -2,8 +2,10 @@ package batches
 
 import (
 	"context"
+	"regexp"
 	"runtime"
 
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/src-cli/internal/batches/graphql"
 )
 
@@ -25,7 +27,8 @@ type Workspace interface {
 
 	// WorkDir allows workspaces to specify the working directory that should be
 	// used when running Docker. If no specific working directory is needed,
-	// then the function should return nil.
+	// then the function should return nil. The native runtime runs steps in
+	// this directory, and so requires it to be set.
 	WorkDir() *string
 
 	// Close is called once, after all steps have been executed and the diff has
@@ -40,6 +43,32 @@ type Workspace interface {
 	// Diff should return the total diff for the workspace. This may be called
 	// multiple times in the life of a workspace.
 	Diff(ctx context.Context) ([]byte, error)
+
+	// Snapshot records the current state of the files in the workspace and
+	// returns an identifier for it, without changing what Changes and Diff
+	// return.
+	Snapshot(ctx context.Context) (string, error)
+
+	// DiffSnapshots returns the diff between two snapshots returned by
+	// Snapshot, in the same format as Diff. An empty from is the state of the
+	// workspace before any step was executed.
+	DiffSnapshots(ctx context.Context, from, to string) ([]byte, error)
+
+	// Restore resets the files in the workspace to a snapshot returned by
+	// Snapshot, discarding all changes made since.
+	Restore(ctx context.Context, snapshot string) error
+}
+
+// snapshotPattern matches the git tree IDs that workspaces use as snapshots.
+var snapshotPattern = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// validateSnapshot returns an error if snapshot isn't a git tree ID, so that
+// it can safely be used in scripts.
+func validateSnapshot(snapshot string) error {
+	if !snapshotPattern.MatchString(snapshot) {
+		return errors.Errorf("invalid workspace snapshot %q", snapshot)
+	}
+	return nil
 }
 
 type workspaceCreatorType int
@@ -2,15 +2,53 @@ package codeintel
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/lib/codeintel/utils"
 )
 
 type UploadIndexOpts = codeintelutils.UploadIndexOpts
 
-func UploadIndex(opts UploadIndexOpts) (string, error) {
-	id, err := codeintelutils.UploadIndex(opts)
+// UploadIndex uploads the index described by opts with the given client, or
+// http.DefaultClient if client is nil.
+//
+// This follows the upload protocol of codeintelutils.UploadIndex, which
+// always sends its requests with http.DefaultClient and so can't be used
+// with the TLS and proxy settings of the API client: the index is
+// compressed, then sent in a single request if it fits into
+// opts.MaxPayloadSizeBytes, or split into several parts otherwise.
+func UploadIndex(opts UploadIndexOpts, client *http.Client) (string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	u := &uploader{opts: opts, client: client}
+
+	compressed, err := compressFile(opts.File)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(compressed)
+
+	fi, err := os.Stat(compressed)
+	if err != nil {
+		return "", err
+	}
+
+	var id int
+	if opts.MaxPayloadSizeBytes <= 0 || fi.Size() <= int64(opts.MaxPayloadSizeBytes) {
+		id, err = u.uploadSingle(compressed)
+	} else {
+		id, err = u.uploadMultipart(compressed, fi.Size())
+	}
 	if err != nil {
 		return "", err
 	}
@@ -23,3 +61,227 @@ func UploadIndex(opts UploadIndexOpts) (string, error) {
 func uploadIDToGraphQLID(uploadID int) string {
 	return string(base64.URLEncoding.EncodeToString([]byte(fmt.Sprintf(`LSIFUpload:"%d"`, uploadID))))
 }
+
+type uploader struct {
+	opts   UploadIndexOpts
+	client *http.Client
+}
+
+// uploadSingle sends the whole compressed index in one request.
+func (u *uploader) uploadSingle(path string) (int, error) {
+	var id int
+	err := u.withRetries(func() (bool, error) {
+		return u.post(u.query(url.Values{}), path, 0, -1, &id)
+	})
+	if err != nil {
+		return 0, err
+	}
+	u.progress(1, 1)
+	return id, nil
+}
+
+// uploadMultipart announces an upload of several parts, sends each part of
+// the compressed index and then marks the upload as done.
+func (u *uploader) uploadMultipart(path string, size int64) (int, error) {
+	partSize := int64(u.opts.MaxPayloadSizeBytes)
+	numParts := int((size + partSize - 1) / partSize)
+
+	var id int
+	err := u.withRetries(func() (bool, error) {
+		return u.post(u.query(url.Values{
+			"multiPart": {"true"},
+			"numParts":  {strconv.Itoa(numParts)},
+		}), "", 0, 0, &id)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < numParts; i++ {
+		part := int64(i)
+		err := u.withRetries(func() (bool, error) {
+			return u.post(url.Values{
+				"uploadId": {strconv.Itoa(id)},
+				"index":    {strconv.Itoa(int(part))},
+			}, path, part*partSize, partSize, nil)
+		})
+		if err != nil {
+			return 0, err
+		}
+		u.progress(i+1, numParts)
+	}
+
+	err = u.withRetries(func() (bool, error) {
+		return u.post(url.Values{
+			"uploadId": {strconv.Itoa(id)},
+			"done":     {"true"},
+		}, "", 0, 0, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// query adds the parameters describing the index to qs.
+func (u *uploader) query(qs url.Values) url.Values {
+	if u.opts.GitHubToken != "" {
+		qs.Set("github_token", u.opts.GitHubToken)
+	}
+	if u.opts.Repo != "" {
+		qs.Set("repository", u.opts.Repo)
+	}
+	if u.opts.Commit != "" {
+		qs.Set("commit", u.opts.Commit)
+	}
+	if u.opts.Root != "" {
+		qs.Set("root", u.opts.Root)
+	}
+	if u.opts.Indexer != "" {
+		qs.Set("indexerName", u.opts.Indexer)
+	}
+	if u.opts.AssociatedIndexID != nil {
+		qs.Set("associatedIndexId", strconv.Itoa(*u.opts.AssociatedIndexID))
+	}
+	return qs
+}
+
+// post sends a request with the given query to the upload endpoint. If path
+// is not empty, limit bytes of the file starting at offset are sent as the
+// body, or the whole file if limit is negative. If target is not nil, the
+// upload ID returned by the endpoint is stored in it. The returned bool
+// reports whether the request may be retried.
+func (u *uploader) post(qs url.Values, path string, offset, limit int64, target *int) (bool, error) {
+	endpoint, err := url.Parse(u.opts.Endpoint + u.uploadPath())
+	if err != nil {
+		return false, err
+	}
+	endpoint.RawQuery = qs.Encode()
+
+	var body io.Reader
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return false, err
+		}
+		body = f
+		if limit >= 0 {
+			body = io.LimitReader(f, limit)
+		}
+	}
+
+	req, err := http.NewRequest("POST", endpoint.String(), body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson+lsif")
+	if u.opts.AccessToken != "" {
+		req.Header.Set("Authorization", "token "+u.opts.AccessToken)
+	}
+	for k, v := range u.opts.AdditionalHeaders {
+		req.Header.Set(k, v)
+	}
+
+	if u.opts.Logger != nil {
+		u.opts.Logger.LogRequest(req)
+	}
+	started := time.Now()
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if u.opts.Logger != nil {
+		u.opts.Logger.LogResponse(req, resp, respBody, time.Since(started))
+	}
+	if err != nil {
+		return true, err
+	}
+
+	if resp.StatusCode >= 300 {
+		if resp.StatusCode == http.StatusUnauthorized {
+			return false, codeintelutils.ErrUnauthorized
+		}
+		return resp.StatusCode >= 500, errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if target != nil {
+		var payload struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(respBody, &payload); err != nil {
+			return false, errors.Wrap(err, "parsing upload response")
+		}
+		if *target, err = strconv.Atoi(payload.ID); err != nil {
+			return false, errors.Wrap(err, "parsing upload ID")
+		}
+	}
+	return false, nil
+}
+
+func (u *uploader) uploadPath() string {
+	if u.opts.Path != "" {
+		return u.opts.Path
+	}
+	return "/.api/lsif/upload"
+}
+
+// withRetries calls f until it succeeds, returns an error that can't be
+// retried, or opts.MaxRetries retries have been made.
+func (u *uploader) withRetries(f func() (bool, error)) error {
+	for attempt := 0; ; attempt++ {
+		retry, err := f()
+		if err == nil || !retry || attempt >= u.opts.MaxRetries {
+			return err
+		}
+		time.Sleep(u.opts.RetryInterval)
+	}
+}
+
+// progress reports that part of numParts parts has been uploaded. Events are
+// dropped if nobody is receiving them.
+func (u *uploader) progress(part, numParts int) {
+	if u.opts.UploadProgressEvents == nil {
+		return
+	}
+	select {
+	case u.opts.UploadProgressEvents <- codeintelutils.UploadProgressEvent{
+		NumParts:      numParts,
+		Part:          part,
+		Progress:      1,
+		TotalProgress: float64(part) / float64(numParts),
+	}:
+	default:
+	}
+}
+
+// compressFile writes a gzipped copy of the file at path to a temporary file
+// and returns its path.
+func compressFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tmp, err := ioutil.TempFile("", "src-lsif-upload-*.gz")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, codeintelutils.Gzip(f)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", errors.Wrap(err, "compressing index")
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
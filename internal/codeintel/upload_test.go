@@ -0,0 +1,125 @@
+package codeintel
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestUploadIndex(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("uploadId") == "" {
+			w.Write([]byte(`{"id":"42"}`))
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "upload-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "dump.lsif")
+	if err := ioutil.WriteFile(file, []byte(`{"id":1,"type":"vertex","label":"metaData"}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(t *testing.T, maxPayloadSize int) []*http.Request {
+		requests = nil
+		// The transport of the given client must be used for all requests,
+		// without touching http.DefaultClient.
+		client := &http.Client{Transport: &countingTransport{}}
+		id, err := UploadIndex(UploadIndexOpts{
+			Endpoint:            ts.URL,
+			AccessToken:         "secret",
+			Repo:                "github.com/sourcegraph/src-cli",
+			Commit:              "deadbeef",
+			File:                file,
+			MaxPayloadSizeBytes: maxPayloadSize,
+		}, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := uploadIDToGraphQLID(42); id != want {
+			t.Errorf("wrong ID: have=%q want=%q", id, want)
+		}
+		if have, want := client.Transport.(*countingTransport).n, len(requests); have != want {
+			t.Errorf("client was used for %d of %d requests", have, want)
+		}
+		if http.DefaultClient.Transport != nil {
+			t.Errorf("http.DefaultClient.Transport was changed")
+		}
+		return requests
+	}
+
+	t.Run("single", func(t *testing.T) {
+		requests := upload(t, 1000*1000)
+		if len(requests) != 1 {
+			t.Fatalf("wrong number of requests: %d", len(requests))
+		}
+		q := requests[0].URL.Query()
+		if q.Get("repository") != "github.com/sourcegraph/src-cli" || q.Get("commit") != "deadbeef" {
+			t.Errorf("wrong query: %s", requests[0].URL.RawQuery)
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		requests := upload(t, 4)
+		if len(requests) < 3 {
+			t.Fatalf("wrong number of requests: %d", len(requests))
+		}
+
+		q := requests[0].URL.Query()
+		if q.Get("multiPart") != "true" {
+			t.Errorf("first request doesn't start a multipart upload: %s", requests[0].URL.RawQuery)
+		}
+		numParts, err := strconv.Atoi(q.Get("numParts"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have, want := len(requests), numParts+2; have != want {
+			t.Fatalf("wrong number of requests: have=%d want=%d", have, want)
+		}
+		for i, r := range requests[1 : numParts+1] {
+			q := r.URL.Query()
+			if q.Get("uploadId") != "42" || q.Get("index") != strconv.Itoa(i) {
+				t.Errorf("wrong query for part %d: %s", i, r.URL.RawQuery)
+			}
+		}
+		last := requests[len(requests)-1].URL.Query()
+		if last.Get("uploadId") != "42" || last.Get("done") != "true" {
+			t.Errorf("last request doesn't finish the upload: %s", requests[len(requests)-1].URL.RawQuery)
+		}
+	})
+}
+
+type countingTransport struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.n++
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
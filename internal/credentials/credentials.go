@@ -0,0 +1,75 @@
+// Package credentials provides storage backends for Sourcegraph access tokens,
+// so that they don't need to be stored in plain text in the src config file or
+// the environment.
+package credentials
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned by Store.Get if no access token is stored for the
+// endpoint.
+var ErrNotFound = errors.New("no access token found in credential store")
+
+// Store instances store access tokens keyed by the Sourcegraph endpoint they
+// belong to.
+type Store interface {
+	// Get returns the access token for the endpoint, or ErrNotFound.
+	Get(ctx context.Context, endpoint string) (string, error)
+
+	// Store stores the access token for the endpoint, replacing any existing
+	// one.
+	Store(ctx context.Context, endpoint, token string) error
+
+	// Erase removes the access token for the endpoint, if any.
+	Erase(ctx context.Context, endpoint string) error
+}
+
+// FileHelper is the name of the built-in helper that stores access tokens in
+// a file, encrypted if a passphrase is given and obfuscated otherwise.
+const FileHelper = "file"
+
+// Opts are the options given to New.
+type Opts struct {
+	// Dir is the directory the built-in file store keeps its files in.
+	Dir string
+
+	// Passphrase is used to derive the encryption key of the built-in file
+	// store. If empty, a random key is generated and stored next to the
+	// file, which only obfuscates the stored tokens.
+	Passphrase string
+}
+
+// New returns the Store for the given credential helper, using the same
+// conventions as git's credential.helper setting:
+//
+//   - "file" selects the built-in file store.
+//   - A value starting with "!" is run as a shell command.
+//   - An absolute path is run as-is.
+//   - Any other value NAME runs the command src-credential-NAME from $PATH.
+//
+// External helpers are invoked with an additional argument of "get", "store"
+// or "erase", and speak the git credential helper protocol on stdin and
+// stdout.
+func New(helper string, opts Opts) (Store, error) {
+	switch {
+	case helper == "":
+		return nil, errors.New("no credential helper given")
+
+	case helper == FileHelper:
+		if opts.Dir == "" {
+			return nil, errors.New("no directory given for the file credential store")
+		}
+		return &fileStore{
+			path:       filepath.Join(opts.Dir, "credentials.enc"),
+			keyPath:    filepath.Join(opts.Dir, "credentials.key"),
+			passphrase: opts.Passphrase,
+		}, nil
+
+	default:
+		return newHelperStore(helper)
+	}
+}
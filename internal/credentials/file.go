@@ -0,0 +1,212 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// fileStore is a Store that keeps access tokens in a file sealed with
+// AES-GCM.
+//
+// Only if a passphrase is given are the tokens actually encrypted: the key is
+// then derived from the passphrase and never written to disk. Otherwise, a
+// random key is generated and stored next to the file, readable only by the
+// current user. That is obfuscation, not encryption: anyone who can read the
+// file can also read the key. It merely keeps tokens out of config files and
+// environment variables that are easily shared or printed by accident.
+type fileStore struct {
+	path       string
+	keyPath    string
+	passphrase string
+
+	mu sync.Mutex
+}
+
+const (
+	fileMagic        = "src-credentials-v1\n"
+	saltSize         = 16
+	keySize          = 32
+	pbkdf2Iterations = 100000
+)
+
+func (s *fileStore) Get(ctx context.Context, endpoint string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	token, ok := tokens[endpoint]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return token, nil
+}
+
+func (s *fileStore) Store(ctx context.Context, endpoint, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+	tokens[endpoint] = token
+	return s.write(tokens)
+}
+
+func (s *fileStore) Erase(ctx context.Context, endpoint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := tokens[endpoint]; !ok {
+		return nil
+	}
+	delete(tokens, endpoint)
+	return s.write(tokens)
+}
+
+// read decrypts and returns the stored tokens. A missing file is treated as
+// an empty store.
+func (s *fileStore) read() (map[string]string, error) {
+	tokens := map[string]string{}
+
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(fileMagic)) || len(data) < len(fileMagic)+saltSize {
+		return nil, errors.Errorf("%s is not a src credentials file", s.path)
+	}
+	data = data[len(fileMagic):]
+	salt, sealed := data[:saltSize], data[saltSize:]
+
+	aead, err := s.cipher(salt, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.Errorf("%s is truncated", s.path)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(fileMagic))
+	if err != nil {
+		return nil, errors.Errorf("decrypting %s: wrong passphrase or corrupted file", s.path)
+	}
+	if err := json.Unmarshal(plaintext, &tokens); err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", s.path)
+	}
+	return tokens, nil
+}
+
+// write encrypts tokens with a fresh salt and nonce and atomically replaces
+// the stored file.
+func (s *fileStore) write(tokens map[string]string) error {
+	plaintext, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return errors.Wrap(err, "generating salt")
+	}
+	aead, err := s.cipher(salt, true)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrap(err, "generating nonce")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(fileMagic)
+	buf.Write(salt)
+	buf.Write(nonce)
+	buf.Write(aead.Seal(nil, nonce, plaintext, []byte(fileMagic)))
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), ".credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// cipher returns the AEAD used to encrypt the file. If create is true and no
+// passphrase is set, a random key is generated if none exists yet.
+func (s *fileStore) cipher(salt []byte, create bool) (cipher.AEAD, error) {
+	var key []byte
+	if s.passphrase != "" {
+		key = pbkdf2.Key([]byte(s.passphrase), salt, pbkdf2Iterations, keySize, sha256.New)
+	} else {
+		var err error
+		if key, err = s.readOrCreateKey(create); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *fileStore) readOrCreateKey(create bool) ([]byte, error) {
+	key, err := ioutil.ReadFile(s.keyPath)
+	if err == nil {
+		if len(key) != keySize {
+			return nil, errors.Errorf("invalid key in %s", s.keyPath)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) || !create {
+		return nil, errors.Wrap(err, "reading credentials key")
+	}
+
+	key = make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrap(err, "generating credentials key")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.keyPath), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(s.keyPath, key, 0600); err != nil {
+		return nil, errors.Wrap(err, "writing credentials key")
+	}
+	return key, nil
+}
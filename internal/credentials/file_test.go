@@ -0,0 +1,84 @@
+package credentials
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+
+	for name, passphrase := range map[string]string{
+		"generated key": "",
+		"passphrase":    "correct horse battery staple",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "src-credentials")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			store, err := New(FileHelper, Opts{Dir: dir, Passphrase: passphrase})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := store.Get(ctx, "https://example.com"); err != ErrNotFound {
+				t.Fatalf("unexpected error for empty store: %v", err)
+			}
+
+			if err := store.Store(ctx, "https://example.com", "secret-token"); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Store(ctx, "https://other.example.com", "other-token"); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(dir, "credentials.enc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "secret-token") {
+				t.Fatal("token is stored in plain text")
+			}
+
+			// A new store instance must be able to read what was written.
+			store, err = New(FileHelper, Opts{Dir: dir, Passphrase: passphrase})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token, err := store.Get(ctx, "https://example.com"); err != nil {
+				t.Fatal(err)
+			} else if token != "secret-token" {
+				t.Errorf("wrong token: have=%q want=%q", token, "secret-token")
+			}
+
+			if err := store.Erase(ctx, "https://example.com"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get(ctx, "https://example.com"); err != ErrNotFound {
+				t.Fatalf("unexpected error for erased token: %v", err)
+			}
+			if token, err := store.Get(ctx, "https://other.example.com"); err != nil {
+				t.Fatal(err)
+			} else if token != "other-token" {
+				t.Errorf("wrong token: have=%q want=%q", token, "other-token")
+			}
+
+			if passphrase != "" {
+				wrong, err := New(FileHelper, Opts{Dir: dir, Passphrase: "wrong"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := wrong.Get(ctx, "https://other.example.com"); err == nil {
+					t.Error("unexpected nil error with wrong passphrase")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/pkg/errors"
+
+	"github.com/sourcegraph/src-cli/internal/exec"
+)
+
+// helperStore is a Store backed by an external credential helper program.
+type helperStore struct {
+	// shell is set if command is a shell snippet rather than a program and
+	// its arguments.
+	shell   bool
+	command []string
+}
+
+func newHelperStore(helper string) (*helperStore, error) {
+	if strings.HasPrefix(helper, "!") {
+		return &helperStore{shell: true, command: []string{helper[1:]}}, nil
+	}
+
+	command, err := shellquote.Split(helper)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing credential helper %q", helper)
+	}
+	if len(command) == 0 {
+		return nil, errors.Errorf("invalid credential helper %q", helper)
+	}
+	if !filepath.IsAbs(command[0]) {
+		command[0] = "src-credential-" + command[0]
+	}
+	return &helperStore{command: command}, nil
+}
+
+func (s *helperStore) Get(ctx context.Context, endpoint string) (string, error) {
+	out, err := s.run(ctx, "get", endpoint, "")
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) == 2 && parts[0] == "password" && parts[1] != "" {
+			return parts[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.Wrap(err, "reading credential helper output")
+	}
+	return "", ErrNotFound
+}
+
+func (s *helperStore) Store(ctx context.Context, endpoint, token string) error {
+	_, err := s.run(ctx, "store", endpoint, token)
+	return err
+}
+
+func (s *helperStore) Erase(ctx context.Context, endpoint string) error {
+	_, err := s.run(ctx, "erase", endpoint, "")
+	return err
+}
+
+// run invokes the helper with the given action, and writes a credential
+// description for the endpoint and token to its stdin.
+func (s *helperStore) run(ctx context.Context, action, endpoint, token string) ([]byte, error) {
+	input, err := helperInput(endpoint, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var name string
+	var args []string
+	if s.shell {
+		name, args = shellCommand(s.command[0] + " " + action)
+	} else {
+		name, args = s.command[0], append(append([]string{}, s.command[1:]...), action)
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "running credential helper %s: %s", action, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// helperInput builds the input for a credential helper in the format used by
+// git: one key=value pair per line, terminated by an empty line.
+func helperInput(endpoint, token string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing endpoint %q", endpoint)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "protocol=%s\n", u.Scheme)
+	fmt.Fprintf(&b, "host=%s\n", u.Host)
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		fmt.Fprintf(&b, "path=%s\n", path)
+	}
+	if token != "" {
+		fmt.Fprintln(&b, "username=src")
+		fmt.Fprintf(&b, "password=%s\n", token)
+	}
+	fmt.Fprintln(&b)
+	return b.String(), nil
+}
+
+func shellCommand(script string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/C", script}
+	}
+	return "sh", []string{"-c", script}
+}
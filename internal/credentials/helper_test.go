@@ -0,0 +1,106 @@
+// +build !windows
+
+package credentials
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testHelper is a stand-in credential helper that stores a single token in a
+// file next to it, and logs the input it receives.
+const testHelper = `#!/bin/sh
+dir=$(dirname "$0")
+input=$(cat)
+echo "$1" >> "$dir/log"
+echo "$input" >> "$dir/log"
+case "$1" in
+  get)
+    if [ -f "$dir/token" ]; then
+      echo "username=src"
+      echo "password=$(cat "$dir/token")"
+    fi
+    ;;
+  store)
+    echo "$input" | sed -n 's/^password=//p' > "$dir/token"
+    ;;
+  erase)
+    rm -f "$dir/token"
+    ;;
+esac
+`
+
+func TestHelperStore(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "src-credential-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	helperPath := filepath.Join(dir, "src-credential-test")
+	if err := ioutil.WriteFile(helperPath, []byte(testHelper), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the helper available by name on $PATH.
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	for name, helper := range map[string]string{
+		"name":    "test",
+		"path":    helperPath,
+		"shell":   "!" + helperPath,
+		"invalid": "does-not-exist",
+	} {
+		t.Run(name, func(t *testing.T) {
+			os.Remove(filepath.Join(dir, "log"))
+			os.Remove(filepath.Join(dir, "token"))
+
+			store, err := New(helper, Opts{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if name == "invalid" {
+				if _, err := store.Get(ctx, "https://example.com"); err == nil || err == ErrNotFound {
+					t.Fatalf("unexpected error for missing helper: %v", err)
+				}
+				return
+			}
+
+			if _, err := store.Get(ctx, "https://example.com"); err != ErrNotFound {
+				t.Fatalf("unexpected error for empty store: %v", err)
+			}
+			if err := store.Store(ctx, "https://example.com/sg", "secret-token"); err != nil {
+				t.Fatal(err)
+			}
+			if token, err := store.Get(ctx, "https://example.com/sg"); err != nil {
+				t.Fatal(err)
+			} else if token != "secret-token" {
+				t.Errorf("wrong token: have=%q want=%q", token, "secret-token")
+			}
+			if err := store.Erase(ctx, "https://example.com/sg"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get(ctx, "https://example.com/sg"); err != ErrNotFound {
+				t.Fatalf("unexpected error for erased token: %v", err)
+			}
+
+			log, err := ioutil.ReadFile(filepath.Join(dir, "log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "store\nprotocol=https\nhost=example.com\npath=sg\nusername=src\npassword=secret-token\n"
+			if !strings.Contains(string(log), want) {
+				t.Errorf("helper did not receive expected input %q:\n%s", want, log)
+			}
+		})
+	}
+}
@@ -92,6 +92,16 @@ func NewOutput(w io.Writer, opts OutputOpts) *Output {
 	return o
 }
 
+// Width returns the detected width of the terminal in columns.
+func (o *Output) Width() int {
+	return o.caps.Width
+}
+
+// IsTTY returns true if the output is written to a terminal.
+func (o *Output) IsTTY() bool {
+	return o.caps.Isatty
+}
+
 func (o *Output) Lock() {
 	o.lock.Lock()
 
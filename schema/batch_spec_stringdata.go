@@ -162,10 +162,99 @@ const BatchSpecJSON = `{
             "type": "object",
             "description": "Files that should be mounted into or be created inside the Docker container.",
             "additionalProperties": { "type": "string" }
+          },
+          "secrets": {
+            "type": "object",
+            "description": "Environment variables to set in the step environment whose values are secret. Unlike ` + "`" + `env` + "`" + `, their values never appear in logs, errors, cached results or the output of the step.",
+            "additionalProperties": {
+              "title": "Secret",
+              "type": "object",
+              "additionalProperties": false,
+              "properties": {
+                "env": {
+                  "type": "string",
+                  "description": "The name of the environment variable on the host that contains the secret."
+                },
+                "file": {
+                  "type": "string",
+                  "description": "The path of a file on the host that contains the secret. Trailing newlines are removed."
+                }
+              },
+              "oneOf": [{ "required": ["env"] }, { "required": ["file"] }]
+            }
+          },
+          "if": {
+            "description": "A condition to check before executing steps. Supports templating. The step is skipped unless the condition evaluates to true.",
+            "oneOf": [
+              {
+                "type": "boolean"
+              },
+              {
+                "type": "string"
+              }
+            ],
+            "examples": ["${{ contains repository.search_result_paths \"package.json\" }}", "${{ eq repository.name \"github.com/sourcegraph/src-cli\" }}"]
+          },
+          "timeout": {
+            "type": "string",
+            "description": "The maximum duration of a single attempt to execute the step, as a Go duration. If it is exceeded, the attempt fails.",
+            "examples": ["30s", "10m", "1h30m"]
+          },
+          "retries": {
+            "type": "integer",
+            "description": "The number of times to retry the step if it fails, waiting longer between each attempt.",
+            "minimum": 0
+          },
+          "allowFailure": {
+            "type": "boolean",
+            "description": "If true, a failure of the step (after all retries) is logged and ignored, and execution continues with the next step."
+          },
+          "commit": {
+            "type": "object",
+            "description": "Creates a commit with the changes made since the previous commit once the step has been executed, so that the changeset consists of multiple commits. Changes made after the last commit are committed with the message of the changesetTemplate.",
+            "additionalProperties": false,
+            "required": ["message"],
+            "properties": {
+              "message": {
+                "type": "string",
+                "description": "The commit message. It can use the same templates as the outputs of a step.",
+                "minLength": 1
+              }
+            }
+          },
+          "resources": {
+            "$ref": "#/definitions/resources",
+            "description": "Limits on the resources that the container of the step can use. Limits that aren't set are taken from the top-level ` + "`" + `resources` + "`" + ` property."
+          },
+          "network": {
+            "$ref": "#/definitions/network",
+            "description": "The network that the container of the step is attached to. If not set, the top-level ` + "`" + `network` + "`" + ` property is used."
           }
         }
       }
     },
+    "resources": {
+      "$ref": "#/definitions/resources",
+      "description": "Limits on the resources that the containers of all steps can use, unless a step sets its own."
+    },
+    "network": {
+      "$ref": "#/definitions/network",
+      "description": "The network that the containers of all steps are attached to, unless a step sets its own."
+    },
+    "fetch": {
+      "type": "string",
+      "description": "How repositories are fetched before the steps are run in them. ` + "`" + `archive` + "`" + `, the default, downloads an archive of the files in each repository. ` + "`" + `git` + "`" + ` makes a partial clone with git, which includes the history of the repository, but not the contents of files in other commits, and only checks out the workspace if ` + "`" + `onlyFetchWorkspace` + "`" + ` is set.",
+      "enum": ["archive", "git"]
+    },
+    "matrix": {
+      "type": "array",
+      "description": "Parameters to run the steps with. The steps are run once per entry in each workspace, and each entry is available in the steps and the changesetTemplate as ` + "`" + `${{ matrix.<key> }}` + "`" + `. The changesetTemplate.branch must render to a different branch for each entry, so that each entry produces its own changeset.",
+      "items": {
+        "type": "object",
+        "description": "The parameters of a single run of the steps.",
+        "minProperties": 1
+      }
+    },
     "transformChanges": {
       "type": "object",
       "description": "Optional transformations to apply to the changes produced in each repository.",
@@ -293,6 +382,36 @@ const BatchSpecJSON = `{
         }
       }
     }
+  },
+  "definitions": {
+    "resources": {
+      "title": "StepResources",
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "cpus": {
+          "type": "number",
+          "description": "The number of CPUs the container can use.",
+          "exclusiveMinimum": 0,
+          "examples": [0.5, 2]
+        },
+        "memory": {
+          "type": "string",
+          "description": "The maximum amount of memory the container can use, as a number of bytes with an optional unit (b, k, m or g).",
+          "pattern": "^[0-9]+[bkmgBKMG]?$",
+          "examples": ["512m", "2g"]
+        },
+        "pidsLimit": {
+          "type": "integer",
+          "description": "The maximum number of processes the container can run.",
+          "minimum": 1
+        }
+      }
+    },
+    "network": {
+      "type": "string",
+      "enum": ["none", "bridge", "host"]
+    }
   }
 }
 `